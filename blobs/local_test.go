@@ -0,0 +1,63 @@
+package blobs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	setup := func(t *testing.T) (*LocalStore, string) {
+		directory := filepath.Join(t.TempDir(), "blobs")
+		store, err := NewLocalStore(directory)
+		assert.IsNil(t, err)
+		return store, directory
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		store, directory := setup(t)
+		key := NewKey()
+
+		err := store.Put(key, strings.NewReader("beans"), 5, "text/plain")
+		assert.IsNil(t, err)
+		content, err := store.Get(key)
+		assert.IsNil(t, err)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equals(t, string(data), "beans")
+		entries, _ := os.ReadDir(directory)
+		assert.HasLength(t, entries, 1) // the temporary file is gone
+
+		assert.IsNil(t, store.Delete(key))
+		_, err = store.Get(key)
+		assert.Equals(t, err, ErrNotFound)
+		assert.IsNil(t, store.Delete(key))
+	})
+
+	t.Run("WrongSize", func(t *testing.T) {
+		store, directory := setup(t)
+		key := NewKey()
+
+		err := store.Put(key, strings.NewReader("beans"), 6, "text/plain")
+		assert.Contains(t, err.Error(), "expected 6 bytes, got 5")
+		_, err = store.Get(key)
+		assert.Equals(t, err, ErrNotFound)
+		entries, _ := os.ReadDir(directory)
+		assert.HasLength(t, entries, 0)
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		store, _ := setup(t)
+
+		for _, key := range []string{"", "../escape", "{" + NewKey() + "}"} {
+			err := store.Put(key, strings.NewReader(""), 0, "text/plain")
+			assert.Equals(t, err, errInvalidKey)
+			_, err = store.Get(key)
+			assert.Equals(t, err, errInvalidKey)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package blobs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Keeps blobs in a bucket of an S3-compatible service, such as AWS S3 or
+// MinIO. Objects are addressed with path-style URLs, i.e. endpoint/bucket/key,
+// which every such service supports.
+type S3Store struct {
+	endpoint string
+	bucket   string
+	creds    credentials
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3Store(endpoint, region, bucket, accessKeyID, secretAccessKey string) (*S3Store, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %q", endpoint)
+	}
+	if region == "" || bucket == "" {
+		return nil, fmt.Errorf("S3 region and bucket must be set")
+	}
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("S3 credentials must be set")
+	}
+
+	return &S3Store{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   bucket,
+		creds:    credentials{region, accessKeyID, secretAccessKey},
+		client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (store *S3Store) request(method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, store.endpoint+"/"+store.bucket+"/"+key, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+	signRequest(req, UNSIGNED_PAYLOAD, store.creds, store.now())
+	return store.client.Do(req)
+}
+
+// Describes an error response, which S3 sends as an XML document
+func responseError(method string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("S3 %s failed with status %d: %s", method, resp.StatusCode, body)
+}
+
+func (store *S3Store) Put(key string, content io.Reader, size int64, contentType string) error {
+	resp, err := store.request(http.MethodPut, key, content, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPut, resp)
+	}
+	return nil
+}
+
+func (store *S3Store) Get(key string) (io.ReadCloser, error) {
+	resp, err := store.request(http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, responseError(http.MethodGet, resp)
+	}
+}
+
+func (store *S3Store) Delete(key string) error {
+	resp, err := store.request(http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return responseError(http.MethodDelete, resp)
+	}
+}
@@ -0,0 +1,35 @@
+package blobs
+
+import (
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+// Keeps the content of files, such as message attachments, under a key.
+// Keys are generated with NewKey, other keys are rejected by the stores.
+type Store interface {
+	Put(key string, content io.Reader, size int64, contentType string) error
+	// Returns ErrNotFound if nothing is stored under the key
+	Get(key string) (io.ReadCloser, error)
+	// Deleting a key that does not exist is not an error
+	Delete(key string) error
+}
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	errInvalidKey = errors.New("invalid blob key")
+)
+
+func NewKey() string {
+	return uuid.NewString()
+}
+
+// Keys end up in file paths and URLs, so only those from NewKey are allowed
+func validateKey(key string) error {
+	if _, err := uuid.Parse(key); err != nil || len(key) != 36 {
+		return errInvalidKey
+	}
+	return nil
+}
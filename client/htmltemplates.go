@@ -57,11 +57,76 @@ var LoginPage string = `{{define "content"}}<span class="logo"><span>> Beango Me
 				>
 					Sign Up
 				</button>
+				<button hx-post="/login/forgot" type="submit" hx-swap="none" class="underline-button">
+					Forgot Password
+				</button>
 			</div>
 			<div id="errors" class="error"></div>
 		</form>
 	</div>{{end}}`
 
+// Replaces the login form once the password has been checked, for users with
+// two-factor authentication
+var LoginCodeForm string = `<form id="login-form" hx-ext="json-enc" hx-swap-oob="true">
+		<input type="hidden" name="preAuthToken" value="{{ .PreAuthToken }}">
+		<div class="form-row">
+			<label for="code">Code:</label>
+			<input
+				type="text"
+				name="code"
+				maxlength="12"
+				autocomplete="one-time-code"
+				placeholder="Authenticator or recovery code"
+				autofocus
+			>
+		</div>
+		<div class="form-row button-row">
+			<button hx-post="/login/code" type="submit" hx-swap="none" class="underline-button">
+				Verify
+			</button>
+		</div>
+		<div id="errors" class="error"></div>
+	</form>`
+
+// Replaces the login form once a password reset has been asked for
+var ForgotPasswordSent string = `<form id="login-form" hx-swap-oob="true">
+		<span class="info">
+			If this account has a verified email address, a link to reset its password has been sent to it.
+		</span>
+	</form>`
+
+var ResetPasswordPage string = `{{define "content"}}<span class="logo"><span>> Beango Messenger </span></span>
+	<div>
+		<form id="login-form" hx-ext="json-enc">
+			<input type="hidden" name="token" value="{{ .Token }}">
+			<div class="form-row">
+				<label for="newPassword">New Password:</label>
+				<input type="password" name="newPassword" maxlength="25" placeholder="Type your new password" autofocus>
+			</div>
+			<div class="form-row button-row">
+				<button hx-post="/login/reset" type="submit" hx-swap="none" class="underline-button">
+					Reset Password
+				</button>
+			</div>
+			<div id="errors" class="error"></div>
+		</form>
+	</div>{{end}}`
+
+var PasswordResetDone string = `<form id="login-form" hx-swap-oob="true">
+		<span class="info">Your password has been reset, and you have been logged out on every device.</span>
+		<div class="form-row button-row">
+			<a href="/login" class="underline-button">Log In</a>
+		</div>
+	</form>`
+
+var EmailVerifiedPage string = `{{define "content"}}<span class="logo"><span>> Beango Messenger </span></span>
+	<div>
+		<span class="info">{{ .Message }}</span>
+		<div class="form-row button-row">
+			<a href="/home" class="underline-button">Go to Beango</a>
+		</div>
+	</div>{{end}}`
+
 var SignUpButton = `<button 
 		hx-post="/login/signup" 
 		type="submit" 
@@ -83,6 +148,18 @@ var Header string = `{{define "header"}}
 			<span class="welcome-message">> Welcome to beango!</span>
 		</div>
 		<div>
+			<button type="submit" class="underline-button" hx-get="/home/sessions" hx-target="#main-pane">
+				Devices
+			</button>
+			<button type="submit" class="underline-button" hx-get="/home/password" hx-target="#main-pane">
+				Password
+			</button>
+			<button type="submit" class="underline-button" hx-get="/home/email" hx-target="#main-pane">
+				Email
+			</button>
+			<button type="submit" class="underline-button" hx-get="/home/totp" hx-target="#main-pane">
+				2FA
+			</button>
 			<button type="submit" class="underline-button" hx-get="/logout" hx-swap="none">
 				Log Out
 			</button>
@@ -93,7 +170,15 @@ var Header string = `{{define "header"}}
 var HomePage string = `{{define "content"}}
 		<div id="errors" class="error"></div>
 		<div class="chat-container">
-			<div class="sidebar">
+			<div class="sidebar" hx-ext="sse" sse-connect="/registerSSE/user">
+				<div hx-get="/" hx-trigger="sse:redirect"></div>
+				<div hx-get="/home/chats" hx-target="#chat-list"` + sseTrigger(
+	"sse:new-message throttle:1s",
+	"sse:read-chat throttle:1s",
+	"sse:new-chat",
+	"sse:rename-chat",
+	"sse:leave-chat",
+) + `</div>
 				<div class="column-header">
 					<span class="heading-1">Chats</span>
 					<div>
@@ -103,23 +188,27 @@ var HomePage string = `{{define "content"}}
 						<button type="submit" class="fill-button" hx-get="/home/newChat" hx-target="#main-pane">
 							Create
 						</button>
+						<button type="submit" class="fill-button" hx-get="/home/search" hx-target="#main-pane">
+							Search
+						</button>
 					</div>
 				</div>
-				<div id=chat-list class="homepage-column chat-list">` + chatList + `</div>
+				<div id=chat-list class="homepage-column chat-list">` + ChatList + `</div>
 			</div>
 			<div id="main-pane" class="main-pane"></div>
 		</div>
 	{{end}}`
 
-var ChatListRefresh string = `<div id=chat-list hx-swap-oob="innerHTML">` + chatList + `</div>`
+var ChatListRefresh string = `<div id=chat-list hx-swap-oob="innerHTML">` + ChatList + `</div>`
 
-var chatList string = `{{ range .Chats }}
+var ChatList string = `{{ range .Chats }}
 	<div 
 		class="chat-selector list-item"
 		hx-get="/home/chat/{{ .ID }}?name={{ .Name }}" 
 		hx-target="#main-pane"
 	>
 		[{{ .Type}}] <b>{{ .Name }}</b>
+		{{ if .UnreadCount }}<span class="unread-badge">{{ .UnreadCount }}</span>{{ end }}
 	</div>
 	{{ end }}`
 
@@ -132,6 +221,24 @@ var MessagePane string = `<div hx-ext="sse" sse-connect="/registerSSE/messages/{
 		id="message-table"
 		class="homepage-column message-list"
 	>` + messageRows + `</table>
+	<div hx-get="/home/chat/{{ .ID }}/receipts" hx-target="find .read-receipts"` +
+	sseTrigger("load", "sse:read-receipt", "sse:new-messages") + `
+		<div class="list-item read-receipts"></div>
+	</div>
+	<div
+		class="list-item"
+		hx-get="/home/chat/{{ .ID }}/typing"
+		hx-trigger="sse:typing"
+	></div>
+	<div
+		hx-post="/home/chat/{{ .ID }}/typing"
+		hx-trigger="input from:.message-input throttle:2s"
+		hx-swap="none"
+	></div>
+	<div id="reply-bar" class="list-item reply-bar" hidden>
+		<span class="message-marker">replying to <span id="reply-target"></span></span>
+		<span class="message-action" hx-on:click="cancelReply()">cancel</span>
+	</div>
 	<div class="input-bar">
 		<span class="input-prompt">> </span>
 		<textarea
@@ -143,12 +250,29 @@ var MessagePane string = `<div hx-ext="sse" sse-connect="/registerSSE/messages/{
 			hx-post="/home/chat/{{ .ID }}/sendMessage"
 			hx-trigger="send-message consume"
 			hx-swap="none"
-			hx-on::after-request="if(event.detail.successful) this.value = '';"
+			hx-vals="js:{replyToMessageID: replyToMessageID}"
+			hx-on::after-request="if(event.detail.successful) { this.value = ''; cancelReply(); }"
 			hx-ext="json-enc"
 		></textarea>
-	</div>` + newMessageFetcher +
+		<form
+			hx-post="/home/chat/{{ .ID }}/attachments"
+			hx-encoding="multipart/form-data"
+			hx-trigger="change"
+			hx-swap="none"
+			hx-vals="js:{replyToMessageID: replyToMessageID ?? ''}"
+			hx-on::after-request="if(event.detail.successful) { this.reset(); cancelReply(); }"
+		>
+			<label class="message-action">attach<input type="file" name="file" multiple hidden></label>
+		</form>
+	</div>
+	<div id="thread-pane"></div>
+	<div id="new-messages-listener" hx-trigger="sse:new-messages"></div>` + newMessageFetcher +
 	`</div>`
 
+var ReadReceipts string = `<span class="message-marker">{{ if .SeenBy }}seen by {{ .SeenBy }}{{ end }}</span>`
+
+var TypingIndicator string = `<span class="message-marker">{{ .Typing }}</span>`
+
 var MessagePaneRefresh string = newMessageFetcher + `
 	<table id="message-table" hx-swap-oob="afterbegin">` + messageRows + `</table>`
 
@@ -159,27 +283,192 @@ var messageRows string = `
 	{{ range $i, $m := .Messages }}
 		{{ if and (eq $i 0) (not (or $.IsRefresh false)) }}
 			<tr
+				id="message-{{ $m.ID }}"
 				hx-get="/home/chat/{{ $.ID }}/scrollUp?to={{ $.ToMessageID }}"
 				hx-swap="none"
-				hx-trigger="intersect once"
-				class="list-item"
+				hx-trigger="intersect once, load-older once"
+				hx-on::after-request="this.classList.remove('scroll-loader')"
+				class="list-item scroll-loader"
 			>
 				<td class="cue">{{ $m.UserDisplayName }}</td>
-				<td class="message">{{ $m.Content }}</td>
+				` + messageCell + `
 			</tr>
 		{{ else }}
-			<tr class="list-item">
+			<tr id="message-{{ $m.ID }}" class="list-item">
 				<td class="cue">{{ $m.UserDisplayName }}</td>
-				<td class="message">{{ $m.Content }}</td>
+				` + messageCell + `
 			</tr>
 		{{ end }}
 	{{ end }}`
 
+// Re-rendered on its own when the message changes, must be used inside a range over .Messages
+var messageCell string = `<td class="message">` +
+	`<span
+						hidden
+						hx-get="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}"
+						hx-target="closest td"
+						hx-swap="outerHTML"
+					` + sseTrigger("sse:edit-message-{{$m.ID}}", "sse:delete-message-{{$m.ID}}") + `</span>` +
+	`{{ if $m.ReplyToMessageID }}<a
+						class="message-quote"
+						href="#message-{{ $m.ReplyToMessageID }}"
+						hx-on:click="scrollToMessage(event, {{ $m.ReplyToMessageID }})"
+					>{{ $m.ReplyToUserDisplayName }}: {{ $m.ReplyToSnippet }}</a>
+{{ end }}` +
+	`{{ if $m.DeletedAt }}<span class="message-marker">{{ $m.Content }}</span>{{ else }}` +
+	`{{ markdown $m.Content }}` +
+	`{{ if $m.IsEdited }} <span class="message-marker">(edited)</span>{{ end }}` +
+	messageAttachments +
+	`{{ if not $m.ThreadID }} <span
+						class="message-action"
+						data-author="{{ $m.UserDisplayName }}"
+						data-snippet="{{ $m.Content }}"
+						hx-on:click="startReply(this, {{ $m.ID }})"
+					>reply</span>{{ end }}` +
+	`{{ if $m.CanStartThread }} <span
+						class="message-action"
+						hx-get="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/thread"
+						hx-target="#thread-pane"
+					>thread</span>{{ end }}` +
+	reactionPicker +
+	`{{ if eq $m.UserID $.UserID }} <span
+						class="message-action"
+						hx-get="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/edit"
+						hx-target="closest td"
+						hx-swap="outerHTML"
+					>edit</span> <span
+						class="message-action"
+						hx-delete="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}"
+						hx-confirm="Delete this message?"
+						hx-target="closest td"
+						hx-swap="outerHTML"
+					>delete</span>{{ end }}` +
+	messageReactions +
+	`{{ end }}` +
+	`{{ if $m.ThreadReplyCount }} <span
+						class="thread-link"
+						hx-get="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/thread"
+						hx-target="#thread-pane"
+					>{{ $m.ThreadReplyCount }} {{ if eq $m.ThreadReplyCount 1 }}reply{{ else }}replies{{ end }}</span>{{ end }}` +
+	`</td>`
+
+// Images are shown inline, other files are links to download them
+var messageAttachments string = `{{ range $m.Attachments }}
+					<div class="attachment">{{ if .IsImage }}<a
+						href="/chat/{{ $m.ChatID }}/attachment/{{ .ID }}"
+						target="_blank"
+					><img
+						class="attachment-image"
+						src="/chat/{{ $m.ChatID }}/attachment/{{ .ID }}"
+						alt="{{ .Filename }}"
+						loading="lazy"
+					></a>{{ else }}<a
+						href="/chat/{{ $m.ChatID }}/attachment/{{ .ID }}"
+						download="{{ .Filename }}"
+					>{{ .Filename }}</a> <span class="message-marker">({{ .FormattedSize }})</span>{{ end }}</div>
+{{ end }}`
+
+// Shown below the message pane, it re-renders itself when a message is added to the thread
+var ThreadPane string = `<div
+		hx-get="/home/chat/{{ .ID }}/message/{{ .ThreadID }}/thread"
+		hx-trigger="sse:thread-{{ .ThreadID }}"
+		hx-target="#thread-pane"
+	></div>
+	<div class="column-header">
+		<span class="heading-1">Thread</span>
+		<div>
+			<button type="submit" class="fill-button" hx-on:click="htmx.find('#thread-pane').innerHTML = ''">
+				Close
+			</button>
+		</div>
+	</div>
+	<table class="homepage-column">
+		{{ range $i, $m := .Messages }}
+			<tr class="list-item">
+				<td class="cue">{{ $m.UserDisplayName }}</td>
+				` + messageCell + `
+			</tr>
+		{{ end }}
+	</table>
+	<div class="input-bar">
+		<span class="input-prompt">> </span>
+		<textarea
+			class="input-value thread-input"
+			placeholder="Reply in the thread"
+			hx-on:keypress="sendMessageOnEnter(event)"
+			name="content"
+			maxlength="5000"
+			hx-post="/home/chat/{{ .ID }}/sendMessage"
+			hx-trigger="send-message consume"
+			hx-swap="none"
+			hx-vals='{"threadID": {{ .ThreadID }}}'
+			hx-on::after-request="if(event.detail.successful) this.value = '';"
+			hx-ext="json-enc"
+		></textarea>
+	</div>`
+
+// Re-rendered on its own when someone reacts to the message, must be used inside a range over .Messages
+var messageReactions string = ` <span
+						class="reactions"
+						hx-get="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/reactions"
+						hx-trigger="sse:reaction-{{ $m.ID }}"
+						hx-swap="outerHTML"
+					>{{ range $m.Reactions }}<span
+						class="reaction{{ if .HasUser $.UserID }} reacted{{ end }}"
+						{{ if .HasUser $.UserID }}hx-delete="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/reactions?emoji={{ .Emoji }}"{{ else }}hx-post="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/reactions"
+						hx-vals='{"emoji": "{{ .Emoji }}"}'
+						hx-ext="json-enc"{{ end }}
+						hx-swap="none"
+					>{{ .Emoji }} {{ .Count }}</span>{{ end }}</span>`
+
+var MessageReactions string = `{{ range $i, $m := .Messages }}` + messageReactions + `{{ end }}`
+
+// Offered on each message, any other emoji can be sent through the API
+var quickReactions = []string{"👍", "❤️", "😂", "😮", "😢"}
+
+var reactionPicker string = func() string {
+	picker := ""
+	for _, emoji := range quickReactions {
+		picker += ` <span
+						class="message-action"
+						hx-post="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}/reactions"
+						hx-vals='{"emoji": "` + emoji + `"}'
+						hx-ext="json-enc"
+						hx-swap="none"
+					>` + emoji + `</span>`
+	}
+	return picker
+}()
+
+var MessageCell string = `{{ range $i, $m := .Messages }}` + messageCell + `{{ end }}`
+
+var MessageEditCell string = `{{ range $i, $m := .Messages }}<td class="message">
+		<textarea
+			class="input-value message-edit-input"
+			name="content"
+			maxlength="5000"
+			hx-patch="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}"
+			hx-on:keypress="sendMessageOnEnter(event)"
+			hx-trigger="send-message consume"
+			hx-target="closest td"
+			hx-swap="outerHTML"
+			hx-ext="json-enc"
+		>{{ $m.Content }}</textarea>
+		<span
+			class="message-action"
+			hx-get="/home/chat/{{ $m.ChatID }}/message/{{ $m.ID }}"
+			hx-target="closest td"
+			hx-swap="outerHTML"
+		>cancel</span>
+	</td>{{ end }}`
+
+// Replaced on each refresh, so it listens for the event on an element of the
+// message pane that the SSE extension knows about
 var newMessageFetcher string = `<div 
 		hx-get="/home/chat/{{ .ID }}/refresh?from={{ .FromMessageID }}"
 		hx-swap="outerHTML"
 		class="chat-selector list-item"
-		hx-trigger="sse:new-messages throttle:10s"
+		hx-trigger="sse:new-messages throttle:10s from:#new-messages-listener"
 	/>`
 
 var NewChatPane string = `<div class="column-header">
@@ -220,6 +509,66 @@ var ChangeNamePane string = `<div class="column-header">
 		<div id="search-results"/>
 	</div>`
 
+var ChangePasswordPane string = `<div class="column-header">
+		<span class="heading-1">Change your password</span>
+	</div>
+	<form hx-post="/home/password" hx-target="#password-result" hx-ext="json-enc">
+		<div class="form-row">
+			<label for="currentPassword">Current:</label>
+			<input type="password" name="currentPassword" maxlength="25" placeholder="Type your current password">
+		</div>
+		<div class="form-row">
+			<label for="newPassword">New:</label>
+			<input type="password" name="newPassword" maxlength="25" placeholder="Type your new password">
+		</div>
+		<div class="form-row button-row">
+			<button type="submit" class="underline-button">Change</button>
+		</div>
+	</form>
+	<div id="password-result"></div>`
+
+var EmailPane string = `<div class="column-header">
+		<span class="heading-1">Email address</span>
+	</div>
+	{{ if .Email }}
+		<span class="info">
+			<span class="accent">{{ .Email }}</span>
+			{{ if .Verified }}
+				is verified, a link to reset your password can be sent to it.
+			{{ else }}
+				is not verified yet, follow the link that was sent to it.
+			{{ end }}
+		</span>
+	{{ else }}
+		<span class="info">Add an email address to be able to reset your password if you forget it.</span>
+	{{ end }}
+	<form hx-post="/home/email" hx-target="#main-pane" hx-ext="json-enc">
+		<div class="form-row">
+			<label for="email">{{ if .Email }}New email:{{ else }}Email:{{ end }}</label>
+			<input type="text" name="email" maxlength="254" placeholder="Type an email address">
+		</div>
+		<div class="form-row">
+			<label for="currentPassword">Password:</label>
+			<input type="password" name="currentPassword" maxlength="25" placeholder="Type your current password">
+		</div>
+		<div class="form-row button-row">
+			<button type="submit" class="underline-button">{{ if .Email }}Change{{ else }}Add{{ end }}</button>
+			{{ if .Email }}
+				<button
+					type="button"
+					class="underline-button"
+					hx-delete="/home/email"
+					hx-include="[name='currentPassword']"
+					hx-confirm="Remove your email address?"
+					hx-target="#main-pane"
+					hx-ext="json-enc"
+				>
+					Remove
+				</button>
+			{{ end }}
+		</div>
+	</form>`
+
 var UserSearchResults string = `
 	{{ if not .Users }}
 		<span class="info">No results.</span>
@@ -237,3 +586,133 @@ var UserSearchResults string = `
 		{{ end }}
 	{{ end }}
 `
+
+var MessageSearchPane string = `<div class="column-header">
+		<span class="heading-1">Search messages</span>
+	</div>
+	<div class="input-bar">
+		<span class="input-prompt">> </span>
+		<textarea
+			class="input-value"
+			placeholder="Search the messages of your chats"
+			name="q"
+			hx-get="/home/search/messages"
+			hx-trigger="keyup changed delay:500ms"
+			hx-target="#search-results"
+		></textarea>
+		<div id="search-results"/>
+	</div>`
+
+var MessageSearchResults string = `
+	{{ if and (not .Results) (not .Cursor) }}
+		<span class="info">No results.</span>
+	{{ end }}
+	{{ range .Results }}
+		<div
+			class="chat-selector list-item"
+			hx-get="/home/chat/{{ .ChatID }}?name={{ .ChatName }}"
+			hx-target="#main-pane"
+			hx-on::after-request="if(event.detail.successful) scrollToMessage(event, {{ .AnchorID }})"
+		>
+			[{{ .ChatType }}] <b>{{ .ChatName }}</b>
+			<span class="cue">{{ .UserDisplayName }}</span>
+			<div class="search-snippet">{{ .Snippet }}</div>
+		</div>
+	{{ end }}
+	{{ if .NextCursor }}
+		<div
+			hx-get="/home/search/messages?q={{ .Query }}&cursor={{ .NextCursor }}"
+			hx-trigger="revealed"
+			hx-swap="outerHTML"
+		></div>
+	{{ end }}
+`
+
+var TOTPPane string = `<div class="column-header">
+		<span class="heading-1">Two-factor authentication</span>
+	</div>
+	{{ if .Enabled }}
+		<span class="info">On, with {{ .RecoveryCodesLeft }} recovery code(s) left.</span>
+		<div class="input-bar">
+			<span class="input-prompt">> </span>
+			<textarea
+				class="input-value"
+				placeholder="Enter a code to turn it off"
+				name="code"
+				maxlength="12"
+				hx-delete="/home/totp"
+				hx-on:keypress="sendMessageOnEnter(event)"
+				hx-trigger="send-message consume"
+				hx-target="#main-pane"
+				hx-ext="json-enc"
+			></textarea>
+		</div>
+	{{ else }}
+		<span class="info">Off. Once on, logging in takes a code from an authenticator app as well as your password.</span>
+		<div class="input-bar">
+			<button type="submit" class="fill-button" hx-post="/home/totp/setup" hx-target="#main-pane">
+				Turn on
+			</button>
+		</div>
+	{{ end }}`
+
+var TOTPSetupPane string = `<div class="column-header">
+		<span class="heading-1">Two-factor authentication</span>
+	</div>
+	<span class="info">Scan this QR code with an authenticator app, or enter the key by hand.</span>
+	<div class="qr-code">{{ .QRCode }}</div>
+	<span class="info">Key: <code>{{ .Secret }}</code></span>
+	<div class="input-bar">
+		<span class="input-prompt">> </span>
+		<textarea
+			class="input-value"
+			placeholder="Enter the code shown by the app"
+			name="code"
+			maxlength="12"
+			hx-post="/home/totp/enable"
+			hx-on:keypress="sendMessageOnEnter(event)"
+			hx-trigger="send-message consume"
+			hx-target="#main-pane"
+			hx-ext="json-enc"
+		></textarea>
+	</div>`
+
+var RecoveryCodesPane string = `<div class="column-header">
+		<span class="heading-1">Two-factor authentication</span>
+	</div>
+	<span class="info">
+		On. If you lose your authenticator app, each of these codes can be used once instead.
+		Keep them somewhere safe, they will not be shown again.
+	</span>
+	<ul class="recovery-codes">
+		{{ range .RecoveryCodes }}<li><code>{{ . }}</code></li>{{ end }}
+	</ul>`
+
+var SessionsPane string = `<div class="column-header">
+		<span class="heading-1">Devices</span>
+		<div>
+			<button
+				type="submit"
+				class="fill-button"
+				hx-delete="/home/sessions"
+				hx-confirm="Log out on every other device?"
+				hx-target="#main-pane"
+			>
+				Log out everywhere else
+			</button>
+		</div>
+	</div>
+	<table class="homepage-column">
+		{{ range .Sessions }}
+			<tr class="list-item">
+				<td class="cue">{{ .IPAddress }}</td>
+				<td class="message">{{ or .UserAgent "unknown device" }} <span class="message-marker">` +
+	`last seen {{ .LastSeenAt.Format "02 Jan 2006 15:04" }} UTC</span>` +
+	`{{ if .IsCurrent }} <span class="message-marker">(this device)</span>{{ else }} <span
+						class="message-action"
+						hx-delete="/home/session/{{ .ID }}"
+						hx-target="#main-pane"
+					>log out</span>{{ end }}</td>
+			</tr>
+		{{ end }}
+	</table>`
@@ -15,3 +15,49 @@ const clearAfterTimeout = (event, timeout) => setTimeout(() => {
     const elt = event.detail.elt; 
     elt.parentElement.removeChild(elt); 
 }, timeout);
+
+// The message that the next message sent replies to, if any
+let replyToMessageID = null;
+
+const startReply = (action, messageID) => {
+    replyToMessageID = messageID;
+    const snippet = action.dataset.snippet;
+    document.getElementById("reply-target").textContent = `${action.dataset.author}: ${snippet.length > 100 ? snippet.slice(0, 100) + "…" : snippet}`;
+    document.getElementById("reply-bar").hidden = false;
+    document.querySelector(".message-input").focus();
+};
+
+const cancelReply = () => {
+    replyToMessageID = null;
+    const replyBar = document.getElementById("reply-bar");
+    if (replyBar) replyBar.hidden = true;
+};
+
+// Scrolls to a message, loading older batches of messages until it is found
+const scrollToMessage = (event, messageID) => {
+    event.preventDefault();
+    const message = document.getElementById(`message-${messageID}`);
+    if (message) {
+        message.scrollIntoView({ behavior: "smooth", block: "center" });
+        message.classList.add("highlighted");
+        setTimeout(() => message.classList.remove("highlighted"), 2000);
+        return;
+    }
+
+    // the loader of the oldest batch is the last one, the others have fired already
+    const loaders = document.querySelectorAll("#message-table .scroll-loader");
+    if (loaders.length === 0) return;
+    const loader = loaders[loaders.length - 1];
+    loader.addEventListener("htmx:afterSettle", () => scrollToMessage(event, messageID), { once: true });
+    // a loader that is already fetching its batch only needs to be waited for
+    if (!loader.classList.contains("htmx-request")) htmx.trigger(loader, "load-older");
+};
+
+// HTMX leaves error responses out by default, but rate limited requests come
+// with a message to show (see DisplayHTTPErrorWithStatus)
+document.addEventListener("htmx:beforeSwap", (event) => {
+    if (event.detail.xhr.status === 429) {
+        event.detail.shouldSwap = true;
+        event.detail.isError = false;
+    }
+});
@@ -3,20 +3,44 @@ package client
 import (
 	"html/template"
 	"net/http"
+	"strings"
 
 	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/markdown"
 	"github.com/raphael-p/beango/utils/response"
 )
 
 var templateMap map[string]*template.Template = make(map[string]*template.Template)
 
+// Functions available to every template
+var templateFuncs template.FuncMap = template.FuncMap{
+	"markdown": markdown.Render,
+}
+
+// Makes the hx-trigger attribute of an element from the given triggers, and
+// closes its opening tag. The SSE extension only listens for an hx-trigger
+// that is a single event, so each SSE event also gets a hidden child element
+// of its own to listen for it, from which the event bubbles up to be handled
+// with the modifiers of the trigger, such as throttle. Event names end at the
+// first space, so template actions within them must not contain any.
+func sseTrigger(triggers ...string) string {
+	var listeners strings.Builder
+	for _, trigger := range triggers {
+		event, _, _ := strings.Cut(trigger, " ")
+		if strings.HasPrefix(event, "sse:") {
+			listeners.WriteString(`<span hidden hx-trigger="` + event + `"></span>`)
+		}
+	}
+	return ` hx-trigger="` + strings.Join(triggers, ", ") + `">` + listeners.String()
+}
+
 func getTemplate(name, value string) (*template.Template, error) {
 	templateFromMap := templateMap[name]
 	if templateFromMap != nil {
 		return templateFromMap, nil
 	}
 
-	newTemplate, err := template.New(name).Parse(value)
+	newTemplate, err := template.New(name).Funcs(templateFuncs).Parse(value)
 	if err != nil {
 		return nil, err
 	}
@@ -21,3 +21,16 @@ func TestGetTemplate(t *testing.T) {
 		assert.DeepEquals(t, template1, template1Cached)
 	})
 }
+
+func TestSseTrigger(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		html := sseTrigger("load", "sse:new-chat", "sse:new-message throttle:1s")
+		assert.Equals(
+			t,
+			html,
+			` hx-trigger="load, sse:new-chat, sse:new-message throttle:1s">`+
+				`<span hidden hx-trigger="sse:new-chat"></span>`+
+				`<span hidden hx-trigger="sse:new-message"></span>`,
+		)
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/raphael-p/beango/utils/path"
 	"github.com/raphael-p/beango/utils/validate"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var Values *config
@@ -39,4 +40,7 @@ func CreateConfig() {
 	if len(fields) != 0 {
 		panic(fmt.Sprint("missing required config field(s): ", fields))
 	}
+	if cost := int(Values.Password.HashCost); cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		panic(fmt.Sprintf("password hash cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
 }
@@ -5,13 +5,23 @@ type envarType struct {
 	DatabaseHost,
 	DatabaseName,
 	DatabaseUsername,
-	DatabasePassword string
+	DatabasePassword,
+	S3AccessKeyID,
+	S3SecretAccessKey,
+	SMTPUsername,
+	SMTPPassword,
+	SigningKey string
 }
 
 var Envars envarType = envarType{
-	configFilepath:   "BG_CONFIG_FILEPATH",
-	DatabaseHost:     "BG_DB_HOST",
-	DatabaseName:     "BG_DB_NAME",
-	DatabaseUsername: "BG_DB_USERNAME",
-	DatabasePassword: "BG_DB_PASSWORD",
+	configFilepath:    "BG_CONFIG_FILEPATH",
+	DatabaseHost:      "BG_DB_HOST",
+	DatabaseName:      "BG_DB_NAME",
+	DatabaseUsername:  "BG_DB_USERNAME",
+	DatabasePassword:  "BG_DB_PASSWORD",
+	S3AccessKeyID:     "BG_S3_ACCESS_KEY_ID",
+	S3SecretAccessKey: "BG_S3_SECRET_ACCESS_KEY",
+	SMTPUsername:      "BG_SMTP_USERNAME",
+	SMTPPassword:      "BG_SMTP_PASSWORD",
+	SigningKey:        "BG_SIGNING_KEY",
 }
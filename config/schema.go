@@ -3,9 +3,16 @@ package config
 import "github.com/raphael-p/beango/utils/validate"
 
 type config struct {
-	Server  serverConfig  `json:"server"`
-	Logger  loggerConfig  `json:"logger"`
-	Session sessionConfig `json:"session"`
+	Server      serverConfig      `json:"server"`
+	Logger      loggerConfig      `json:"logger"`
+	Session     sessionConfig     `json:"session"`
+	SSE         sseConfig         `json:"sse"`
+	Events      eventsConfig      `json:"events"`
+	Typing      typingConfig      `json:"typing"`
+	Attachments attachmentsConfig `json:"attachments"`
+	RateLimit   rateLimitConfig   `json:"rateLimit"`
+	Password    passwordConfig    `json:"password"`
+	Mail        mailConfig        `json:"mail"`
 }
 
 type serverConfig struct {
@@ -19,5 +26,74 @@ type loggerConfig struct {
 }
 
 type sessionConfig struct {
-	SecondsUntilExpiry uint32 `json:"secondsUntilExpiry"`
+	SecondsUntilExpiry   uint32 `json:"secondsUntilExpiry"`
+	SecondsBetweenSweeps uint32 `json:"secondsBetweenSweeps"`
+}
+
+type sseConfig struct {
+	BufferSize               uint16 `json:"bufferSize"`
+	SecondsBetweenHeartbeats uint16 `json:"secondsBetweenHeartbeats"`
+}
+
+// Bus is either "local", for a single server instance, or "postgres"
+type eventsConfig struct {
+	Bus string `json:"bus"`
+}
+
+type typingConfig struct {
+	SecondsUntilExpiry uint16 `json:"secondsUntilExpiry"`
+}
+
+// Store is either "local", which keeps files in Directory, or "s3". The S3
+// credentials are read from the environment, see Envars.
+type attachmentsConfig struct {
+	MaxFileSizeBytes   uint32   `json:"maxFileSizeBytes"`
+	MaxFilesPerMessage uint8    `json:"maxFilesPerMessage"`
+	AllowedTypes       []string `json:"allowedTypes"`
+	Store              string   `json:"store"`
+	Directory          string   `json:"directory"`
+	S3                 s3Config `json:"s3"`
+}
+
+// Only needed when the attachments store is "s3"
+type s3Config struct {
+	Endpoint validate.JSONField[string] `json:"endpoint" zeroable:"true"`
+	Region   validate.JSONField[string] `json:"region" zeroable:"true"`
+	Bucket   validate.JSONField[string] `json:"bucket" zeroable:"true"`
+}
+
+// Applies to login attempts. Store is either "local", which only counts the
+// attempts made to this instance, or "postgres". Past FreeAttempts, each
+// failure locks the username and IP address for twice as long as the last,
+// up to MaxDelaySeconds.
+type rateLimitConfig struct {
+	Store             string `json:"store"`
+	FreeAttempts      uint16 `json:"freeAttempts"`
+	BaseDelaySeconds  uint32 `json:"baseDelaySeconds"`
+	MaxDelaySeconds   uint32 `json:"maxDelaySeconds"`
+	SecondsUntilReset uint32 `json:"secondsUntilReset"`
+}
+
+// HashCost is the bcrypt cost of password hashes, between 4 and 31. Hashes
+// with a lower cost are replaced when their user next logs in.
+type passwordConfig struct {
+	HashCost uint8 `json:"hashCost"`
+}
+
+// Mailer is either "smtp", "file", which appends emails to File instead of
+// sending them, or "log", which writes them to the server log. The SMTP
+// credentials are read from the environment, see Envars. BaseURL is the
+// address of the server that links in emails point to.
+type mailConfig struct {
+	Mailer  string                     `json:"mailer"`
+	From    string                     `json:"from"`
+	BaseURL string                     `json:"baseURL"`
+	File    validate.JSONField[string] `json:"file" zeroable:"true"`
+	SMTP    smtpConfig                 `json:"smtp"`
+}
+
+// Only needed when the mailer is "smtp"
+type smtpConfig struct {
+	Host validate.JSONField[string] `json:"host" zeroable:"true"`
+	Port validate.JSONField[uint16] `json:"port" zeroable:"true"`
 }
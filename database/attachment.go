@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// A file attached to a message, its content is kept in a blob store under BlobKey
+type Attachment struct {
+	ID          int64  `json:"id"`
+	MessageID   int64  `json:"messageID"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	BlobKey     string `json:"-"`
+}
+
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// The size in the largest unit that keeps it at or above 1
+func (a Attachment) FormattedSize() string {
+	if a.Size < 1024 {
+		return fmt.Sprintf("%d B", a.Size)
+	}
+	size := float64(a.Size) / 1024
+	for _, unit := range []string{"KB", "MB"} {
+		if size < 1024 {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return fmt.Sprintf("%.1f GB", size)
+}
+
+// The attachments of a message. They are aggregated as JSON by the
+// database, see selectMessage.
+type Attachments []Attachment
+
+func (a *Attachments) Scan(value any) error {
+	switch value := value.(type) {
+	case []byte:
+		return json.Unmarshal(value, a)
+	case string:
+		return json.Unmarshal([]byte(value), a)
+	case nil:
+		*a = Attachments{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Attachments", value)
+	}
+}
+
+func (conn *MongoConnection) GetAttachment(id int64) (*Attachment, error) {
+	attachment, err := scanRow[Attachment](conn.QueryRow(
+		`SELECT id, message_id, filename, content_type, size, blob_key
+		FROM attachment WHERE id = $1`,
+		id,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return attachment, err
+}
+
+func (conn *MongoConnection) SetAttachment(attachment *Attachment) (*Attachment, error) {
+	return scanRow[Attachment](conn.QueryRow(
+		`INSERT INTO attachment (message_id, filename, content_type, size, blob_key)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, message_id, filename, content_type, size, blob_key`,
+		attachment.MessageID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.BlobKey,
+	))
+}
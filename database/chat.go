@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lib/pq"
@@ -25,10 +27,43 @@ type Chat struct {
 }
 
 type ChatUser struct {
-	ID        int64     `json:"id"`
-	ChatID    int64     `json:"chatID"`
-	UserID    int64     `json:"userID"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID                int64     `json:"id"`
+	ChatID            int64     `json:"chatID"`
+	UserID            int64     `json:"userID"`
+	CreatedAt         time.Time `json:"createdAt"`
+	LastReadMessageID int64     `json:"lastReadMessageID"`
+}
+
+// The number of messages in a chat that a user has not read yet,
+// their own messages and deleted messages are not counted
+type UnreadCount struct {
+	ChatID int64 `json:"chatID"`
+	Count  int64 `json:"count"`
+}
+
+// How far a member of a chat has read, used to show who has seen a message
+type ReadReceipt struct {
+	UserID            int64  `json:"userID"`
+	UserDisplayName   string `json:"userDisplayName"`
+	LastReadMessageID int64  `json:"lastReadMessageID"`
+}
+
+// The members who have read up to a message, aggregated as JSON by the
+// database, see selectMessage.
+type ReadReceipts []ReadReceipt
+
+func (r *ReadReceipts) Scan(value any) error {
+	switch value := value.(type) {
+	case []byte:
+		return json.Unmarshal(value, r)
+	case string:
+		return json.Unmarshal([]byte(value), r)
+	case nil:
+		*r = ReadReceipts{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into ReadReceipts", value)
+	}
 }
 
 func (conn *MongoConnection) GetChat(id, userID int64) (*Chat, error) {
@@ -121,3 +156,138 @@ func (conn *MongoConnection) SetChat(chat *Chat, userIDs ...int64) (*Chat, error
 	}
 	return chat, nil
 }
+
+func (conn *MongoConnection) AddChatUsers(chatID int64, userIDs ...int64) error {
+	_, err := conn.Exec(
+		`INSERT INTO chat_users (chat_id, user_id)
+		SELECT $1, unnest($2::INT[])
+		ON CONFLICT ON CONSTRAINT chat_users_unique_constraint DO NOTHING`,
+		chatID, pq.Array(userIDs),
+	)
+	return err
+}
+
+// The owner of a chat is its longest-standing member, its creator until they
+// leave. Returns 0 if the chat has no members.
+func (conn *MongoConnection) GetChatOwnerID(chatID int64) (int64, error) {
+	var ownerID int64
+	err := conn.QueryRow(
+		`SELECT user_id FROM chat_users
+		WHERE chat_id = $1
+		ORDER BY id
+		LIMIT 1`,
+		chatID,
+	).Scan(&ownerID)
+	if err != nil && err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return ownerID, err
+}
+
+// Removes a user from a chat. If they were its last member, the chat is
+// deleted along with its messages, and the attachments that were deleted are
+// returned so that their blobs can be deleted too.
+func (conn *MongoConnection) RemoveChatUser(chatID, userID int64) ([]Attachment, error) {
+	txn, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	// locks the chat so that members leaving at the same time see each other leave
+	if _, err := txn.Exec(`SELECT 1 FROM chat WHERE id = $1 FOR UPDATE`, chatID); err != nil {
+		return nil, err
+	}
+	if _, err := txn.Exec(
+		`DELETE FROM chat_users
+		WHERE chat_id = $1 AND user_id = $2`,
+		chatID, userID,
+	); err != nil {
+		return nil, err
+	}
+
+	var isEmpty bool
+	err = txn.QueryRow(
+		`SELECT NOT EXISTS (SELECT 1 FROM chat_users WHERE chat_id = $1)`,
+		chatID,
+	).Scan(&isEmpty)
+	if err != nil {
+		return nil, err
+	}
+	if !isEmpty {
+		return nil, txn.Commit()
+	}
+
+	attachments, err := scanRows[Attachment](txn.Query(
+		`DELETE FROM attachment
+		WHERE message_id IN (SELECT id FROM message WHERE chat_id = $1)
+		RETURNING id, message_id, filename, content_type, size, blob_key`,
+		chatID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range []string{
+		`DELETE FROM message_reaction
+		WHERE message_id IN (SELECT id FROM message WHERE chat_id = $1)`,
+		`DELETE FROM message_revision
+		WHERE message_id IN (SELECT id FROM message WHERE chat_id = $1)`,
+		`DELETE FROM message WHERE chat_id = $1`,
+		`DELETE FROM chat WHERE id = $1`,
+	} {
+		if _, err := txn.Exec(query, chatID); err != nil {
+			return nil, err
+		}
+	}
+	return attachments, txn.Commit()
+}
+
+func (conn *MongoConnection) GetUnreadCounts(userID int64) ([]UnreadCount, error) {
+	return scanRows[UnreadCount](conn.Query(
+		`SELECT cu.chat_id, COUNT(m.id)
+		FROM chat_users cu
+		LEFT JOIN message m ON m.chat_id = cu.chat_id
+			AND m.id > cu.last_read_message_id
+			AND m.user_id <> cu.user_id
+			AND m.deleted_at IS NULL
+		WHERE cu.user_id = $1
+		GROUP BY cu.chat_id;`,
+		userID,
+	))
+}
+
+// Moves the user's read marker forward to the given message, or to the
+// latest message of the chat if messageID is 0. The marker never moves back.
+// Returns the new position of the marker, or 0 if it did not move.
+func (conn *MongoConnection) MarkChatRead(chatID, userID, messageID int64) (int64, error) {
+	var lastReadMessageID int64
+	err := conn.QueryRow(
+		`UPDATE chat_users cu
+		SET last_read_message_id = target.id
+		FROM (
+			SELECT CASE WHEN $3 = 0
+				THEN (SELECT COALESCE(MAX(id), 0) FROM message WHERE chat_id = $1)
+				ELSE $3
+			END AS id
+		) target
+		WHERE cu.chat_id = $1 AND cu.user_id = $2
+		AND cu.last_read_message_id < target.id
+		RETURNING cu.last_read_message_id`,
+		chatID, userID, messageID,
+	).Scan(&lastReadMessageID)
+	if err != nil && err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return lastReadMessageID, err
+}
+
+func (conn *MongoConnection) GetReadReceipts(chatID int64) ([]ReadReceipt, error) {
+	return scanRows[ReadReceipt](conn.Query(
+		`SELECT cu.user_id, u.display_name, cu.last_read_message_id
+		FROM chat_users cu
+		INNER JOIN "user" u ON u.id = cu.user_id
+		WHERE cu.chat_id = $1
+		ORDER BY u.display_name;`,
+		chatID,
+	))
+}
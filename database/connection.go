@@ -13,26 +13,64 @@ var Users = make(map[int64]User)
 var Chats = make(map[int64]Chat)
 var ChatUsers = make(map[int64]ChatUser)
 var Messages = make(map[int64]MessageDatabase)
-var Sessions = make(map[string]Session)
 
 type Connection interface {
 	GetChat(id, userID int64) (*Chat, error)
 	GetChatsByUserID(userID int64) ([]Chat, error)
 	GetPrivateChatByUserIDs(userID1, userID2 int64) (*Chat, error)
 	SetChat(chat *Chat, userIDs ...int64) (*Chat, error)
+	AddChatUsers(chatID int64, userIDs ...int64) error
+	GetChatOwnerID(chatID int64) (int64, error)
+	RemoveChatUser(chatID, userID int64) ([]Attachment, error)
+	GetUnreadCounts(userID int64) ([]UnreadCount, error)
+	MarkChatRead(chatID, userID, messageID int64) (int64, error)
+	GetReadReceipts(chatID int64) ([]ReadReceipt, error)
 	GetMessagesByChatID(chatID, fromMessageID, toMessageID int64, limit int) ([]Message, error)
+	GetMessage(id int64) (*Message, error)
+	GetThreadMessages(threadID int64) ([]Message, error)
 	SetMessage(message *MessageDatabase) (*MessageDatabase, error)
+	SetMessageWithAttachments(message *MessageDatabase, attachments []Attachment) (*MessageDatabase, error)
+	UpdateMessage(id int64, content string) (*MessageDatabase, error)
+	DeleteMessage(id int64) error
+	GetMessageRevisions(messageID int64) ([]MessageRevision, error)
+	SearchMessages(userID int64, query string, beforeMessageID int64, limit int) ([]MessageSearchResult, error)
+	AddReaction(messageID, userID int64, emoji string) error
+	RemoveReaction(messageID, userID int64, emoji string) error
+	GetAttachment(id int64) (*Attachment, error)
+	SetAttachment(attachment *Attachment) (*Attachment, error)
 	GetUser(id int64) (*User, error)
 	GetUserByUsername(username string) (*User, error)
 	GetUsersByChatID(chatID int64) ([]User, error)
 	SetUser(user *User) (*User, error)
+	SetUserWithNoteChat(user *User) (*User, error)
 	SearchUsers(username string, searchUserID int64) ([]User, error)
 	RenameUser(id int64, displayName string) error
-	GetSession(id string) *Session
-	GetSessionByUserID(userID int64) (*Session, error)
-	SetSession(session Session)
-	CheckSession(id string) (*Session, bool)
-	DeleteSession(id string)
+	UpdateUserKey(id int64, key []byte) error
+	SetUserEmail(id int64, email *string) error
+	VerifyUserEmail(id int64, email string) (bool, error)
+	GetSession(id string) (*Session, error)
+	GetSessionByHandle(handle string) (*Session, error)
+	GetSessionsByUserID(userID int64) ([]Session, error)
+	SetSession(session Session) error
+	CheckSession(id string) (*Session, error)
+	DeleteSession(id string) error
+	DeleteOtherSessions(userID int64, keepID string) error
+	GetAPITokensByUserID(userID int64) ([]APIToken, error)
+	SetAPIToken(token *APIToken) (*APIToken, error)
+	DeleteAPIToken(id, userID int64) (bool, error)
+	CheckAPIToken(hash string) (*APIToken, error)
+	GetTOTP(userID int64) (*TOTP, error)
+	SetTOTP(userID int64, secret string) error
+	EnableTOTP(userID, step int64, recoveryCodeHashes []string) error
+	DeleteTOTP(userID int64) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	UseRecoveryCode(userID int64, hash string) (bool, error)
+	CountRecoveryCodes(userID int64) (int64, error)
+	SetPreAuthToken(token PreAuthToken) error
+	CheckPreAuthToken(id string, maxAttempts int64) (*PreAuthToken, error)
+	DeletePreAuthToken(id string) error
+	SetPasswordReset(reset PasswordReset) error
+	UsePasswordReset(id string) (*PasswordReset, error)
 }
 
 type MongoConnection struct {
@@ -46,14 +84,27 @@ func GetConnection() (*MongoConnection, error) {
 		return conn, nil
 	}
 
-	// check for db envars
+	connectionString, err := ConnectionString()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+	conn = &MongoConnection{db}
+	return conn, nil
+}
+
+// Builds the database URL from envars
+func ConnectionString() (string, error) {
 	host := os.Getenv(config.Envars.DatabaseHost)
 	if host == "" {
-		return nil, fmt.Errorf("$%s must be set", config.Envars.DatabaseHost)
+		return "", fmt.Errorf("$%s must be set", config.Envars.DatabaseHost)
 	}
 	name := os.Getenv(config.Envars.DatabaseName)
 	if name == "" {
-		return nil, fmt.Errorf("$%s must be set", config.Envars.DatabaseName)
+		return "", fmt.Errorf("$%s must be set", config.Envars.DatabaseName)
 	}
 
 	// generate credentials substring
@@ -64,13 +115,7 @@ func GetConnection() (*MongoConnection, error) {
 		credentials = username + ":" + password + "@"
 	}
 
-	connectionString := fmt.Sprintf("postgres://%s%s/%s?sslmode=disable", credentials, host, name)
-	db, err := sql.Open("postgres", connectionString)
-	if err != nil {
-		return nil, err
-	}
-	conn = &MongoConnection{db}
-	return conn, nil
+	return fmt.Sprintf("postgres://%s%s/%s?sslmode=disable", credentials, host, name), nil
 }
 
 func SetDummyConnection() {
@@ -1,36 +1,181 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
 	"time"
+
+	"github.com/raphael-p/beango/utils/markdown"
 )
 
 type MessageDatabase struct {
-	ID            int64     `json:"id"`
-	UserID        int64     `json:"userID"`
-	ChatID        int64     `json:"chatID"`
-	Content       string    `json:"content"`
-	CreatedAt     time.Time `json:"createdAt"`
-	LastUpdatedAt time.Time `json:"lastUpdatedAt"`
+	ID               int64      `json:"id"`
+	UserID           int64      `json:"userID"`
+	ChatID           int64      `json:"chatID"`
+	Content          string     `json:"content"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	LastUpdatedAt    time.Time  `json:"lastUpdatedAt"`
+	DeletedAt        *time.Time `json:"deletedAt"`
+	ReplyToMessageID *int64     `json:"replyToMessageID"`
+	ThreadID         *int64     `json:"threadID"`
 }
 
 type Message struct {
-	ID              int64     `json:"id"`
-	UserID          int64     `json:"userID"`
-	ChatID          int64     `json:"chatID"`
-	Content         string    `json:"content"`
-	CreatedAt       time.Time `json:"createdAt"`
-	LastUpdatedAt   time.Time `json:"lastUpdatedAt"`
-	UserDisplayName string    `json:"userDisplayName"`
+	ID                     int64          `json:"id"`
+	UserID                 int64          `json:"userID"`
+	ChatID                 int64          `json:"chatID"`
+	Content                string         `json:"content"`
+	CreatedAt              time.Time      `json:"createdAt"`
+	LastUpdatedAt          time.Time      `json:"lastUpdatedAt"`
+	DeletedAt              *time.Time     `json:"deletedAt"`
+	ReplyToMessageID       *int64         `json:"replyToMessageID"`
+	ThreadID               *int64         `json:"threadID"`
+	UserDisplayName        string         `json:"userDisplayName"`
+	ReplyToUserDisplayName string         `json:"replyToUserDisplayName"`
+	ReplyToSnippet         string         `json:"replyToSnippet"`
+	ThreadReplyCount       int64          `json:"threadReplyCount"`
+	ChatType               chatType       `json:"-"` // only needed to render the message
+	Reactions              ReactionCounts `json:"reactions"`
+	Attachments            Attachments    `json:"attachments"`
+	SeenBy                 ReadReceipts   `json:"seenBy"`
 }
 
-func (conn *MongoConnection) GetMessagesByChatID(chatID, fromMessageID, toMessageID int64, limit int) ([]Message, error) {
-	return scanRows[Message](conn.Query(
-		`SELECT
-			m.*,
-			u.display_name as user_display_name
+// The columns of a MessageDatabase, the message table has others that are
+// only used by the database (see Setup)
+const messageColumns string = `id, user_id, chat_id, content, created_at,
+		last_updated_at, deleted_at, reply_to_message_id, thread_id`
+
+// Replaces the content of deleted messages
+const DELETED_MESSAGE_CONTENT string = "message deleted"
+
+// Selects the fields of a Message from message m, its author u and chat c,
+// and from the message r it replies to and its author ru, along with the
+// reactions to m, its attachments, and the other members who have read it.
+// The content and attachments of a deleted message are never returned.
+const selectMessage string = `SELECT
+			m.id,
+			m.user_id,
+			m.chat_id,
+			CASE WHEN m.deleted_at IS NULL THEN m.content ELSE '` + DELETED_MESSAGE_CONTENT + `' END,
+			m.created_at,
+			m.last_updated_at,
+			m.deleted_at,
+			m.reply_to_message_id,
+			m.thread_id,
+			u.display_name as user_display_name,
+			COALESCE(ru.display_name, '') as reply_to_user_display_name,
+			COALESCE(
+				CASE WHEN r.deleted_at IS NULL THEN LEFT(r.content, 100) ELSE '` + DELETED_MESSAGE_CONTENT + `' END,
+				''
+			) as reply_to_snippet,
+			(
+				SELECT COUNT(*) FROM message t
+				WHERE t.thread_id = m.id AND t.deleted_at IS NULL
+			) as thread_reply_count,
+			c.type as chat_type,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'emoji', mr.emoji,
+					'count', mr.count,
+					'userIDs', mr.user_ids
+				) ORDER BY mr.first_created_at)
+				FROM (
+					SELECT
+						emoji,
+						COUNT(*) as count,
+						array_agg(user_id ORDER BY created_at) as user_ids,
+						MIN(created_at) as first_created_at
+					FROM message_reaction
+					WHERE message_id = m.id
+					GROUP BY emoji
+				) mr
+			), '[]') as reactions,
+			CASE WHEN m.deleted_at IS NULL THEN COALESCE((
+				SELECT json_agg(json_build_object(
+					'id', a.id,
+					'messageID', a.message_id,
+					'filename', a.filename,
+					'contentType', a.content_type,
+					'size', a.size
+				) ORDER BY a.id)
+				FROM attachment a
+				WHERE a.message_id = m.id
+			), '[]') ELSE '[]' END as attachments,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'userID', cu.user_id,
+					'userDisplayName', su.display_name,
+					'lastReadMessageID', cu.last_read_message_id
+				) ORDER BY su.display_name)
+				FROM chat_users cu
+				INNER JOIN "user" su ON su.id = cu.user_id
+				WHERE cu.chat_id = m.chat_id
+				AND cu.user_id <> m.user_id
+				AND cu.last_read_message_id >= m.id
+			), '[]') as seen_by
 		FROM message m
 		LEFT JOIN "user" u ON u.id = m.user_id
-		WHERE chat_id = $1 AND m.id > $2
+		LEFT JOIN chat c ON c.id = m.chat_id
+		LEFT JOIN message r ON r.id = m.reply_to_message_id
+		LEFT JOIN "user" ru ON ru.id = r.user_id`
+
+// Quoted messages are cut down to this many characters, as in selectMessage
+const REPLY_SNIPPET_LENGTH int = 100
+
+// A message's creation and update times only differ once it has been edited
+func (m Message) IsEdited() bool {
+	return m.LastUpdatedAt.After(m.CreatedAt)
+}
+
+// Threads can only be started in group chats, from a message that is not
+// itself part of a thread
+func (m Message) CanStartThread() bool {
+	return m.ChatType == GROUP_CHAT && m.ThreadID == nil
+}
+
+// Message content is written in Markdown, and sent both as it is and rendered
+// as sanitised HTML
+func (m MessageDatabase) MarshalJSON() ([]byte, error) {
+	type messageDatabase MessageDatabase // drops the methods, to avoid recursion
+	return json.Marshal(struct {
+		messageDatabase
+		ContentHTML template.HTML `json:"contentHTML"`
+	}{messageDatabase(m), markdown.Render(m.Content)})
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return json.Marshal(struct {
+		message
+		ContentHTML template.HTML `json:"contentHTML"`
+	}{message(m), markdown.Render(m.Content)})
+}
+
+type MessageRevision struct {
+	ID        int64     `json:"id"`
+	MessageID int64     `json:"messageID"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (conn *MongoConnection) GetMessage(id int64) (*Message, error) {
+	message, err := scanRow[Message](conn.QueryRow(
+		selectMessage+`
+		WHERE m.id = $1`,
+		id,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return message, err
+}
+
+func (conn *MongoConnection) GetMessagesByChatID(chatID, fromMessageID, toMessageID int64, limit int) ([]Message, error) {
+	return scanRows[Message](conn.Query(
+		selectMessage+`
+		WHERE m.chat_id = $1 AND m.thread_id IS NULL AND m.id > $2
 		AND ($3 = 0 OR m.id < $3)
 		ORDER BY m.created_at DESC
 		LIMIT CASE WHEN $4 = 0 THEN NULL ELSE $4 END;`,
@@ -38,11 +183,108 @@ func (conn *MongoConnection) GetMessagesByChatID(chatID, fromMessageID, toMessag
 	))
 }
 
+// Lists the replies in the thread started by a message, oldest first
+func (conn *MongoConnection) GetThreadMessages(threadID int64) ([]Message, error) {
+	return scanRows[Message](conn.Query(
+		selectMessage+`
+		WHERE m.thread_id = $1
+		ORDER BY m.created_at ASC`,
+		threadID,
+	))
+}
+
 func (conn *MongoConnection) SetMessage(message *MessageDatabase) (*MessageDatabase, error) {
 	return scanRow[MessageDatabase](conn.QueryRow(
-		`INSERT INTO message (user_id, chat_id, content)
-		VALUES ($1, $2, $3)
-		RETURNING *`,
-		message.UserID, message.ChatID, message.Content,
+		`INSERT INTO message (user_id, chat_id, content, reply_to_message_id, thread_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+messageColumns,
+		message.UserID, message.ChatID, message.Content, message.ReplyToMessageID, message.ThreadID,
+	))
+}
+
+// Sends a message and attaches the stored files to it, either both are saved
+// or neither is. The attachments are updated with their IDs.
+func (conn *MongoConnection) SetMessageWithAttachments(message *MessageDatabase, attachments []Attachment) (*MessageDatabase, error) {
+	txn, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	message, err = scanRow[MessageDatabase](txn.QueryRow(
+		`INSERT INTO message (user_id, chat_id, content, reply_to_message_id, thread_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+messageColumns,
+		message.UserID, message.ChatID, message.Content, message.ReplyToMessageID, message.ThreadID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	for i := range attachments {
+		attachments[i].MessageID = message.ID
+		err := txn.QueryRow(
+			`INSERT INTO attachment (message_id, filename, content_type, size, blob_key)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			message.ID, attachments[i].Filename, attachments[i].ContentType, attachments[i].Size, attachments[i].BlobKey,
+		).Scan(&attachments[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return message, txn.Commit()
+}
+
+// Replaces the content of a message, keeping the previous content as a revision
+func (conn *MongoConnection) UpdateMessage(id int64, content string) (*MessageDatabase, error) {
+	txn, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = txn.Exec(
+		`INSERT INTO message_revision (message_id, content, created_at)
+		SELECT id, content, last_updated_at FROM message
+		WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return nil, errors.Join(err, txn.Rollback())
+	}
+
+	message, err := scanRow[MessageDatabase](txn.QueryRow(
+		`UPDATE message
+		SET content = $1, last_updated_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE id = $2
+		RETURNING `+messageColumns,
+		content, id,
+	))
+	if err != nil {
+		return nil, errors.Join(err, txn.Rollback())
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (conn *MongoConnection) GetMessageRevisions(messageID int64) ([]MessageRevision, error) {
+	return scanRows[MessageRevision](conn.Query(
+		`SELECT * FROM message_revision
+		WHERE message_id = $1
+		ORDER BY created_at DESC`,
+		messageID,
 	))
 }
+
+func (conn *MongoConnection) DeleteMessage(id int64) error {
+	_, err := conn.Exec(
+		`UPDATE message
+		SET deleted_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+	)
+	return err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type MessageReaction struct {
+	MessageID int64     `json:"messageID"`
+	UserID    int64     `json:"userID"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// How many users reacted to a message with an emoji
+type ReactionCount struct {
+	Emoji   string  `json:"emoji"`
+	Count   int64   `json:"count"`
+	UserIDs []int64 `json:"userIDs"`
+}
+
+func (r ReactionCount) HasUser(userID int64) bool {
+	return slices.Contains(r.UserIDs, userID)
+}
+
+// The reactions to a message, in the order they were first added. They are
+// aggregated as JSON by the database, see selectMessage.
+type ReactionCounts []ReactionCount
+
+func (r *ReactionCounts) Scan(value any) error {
+	switch value := value.(type) {
+	case []byte:
+		return json.Unmarshal(value, r)
+	case string:
+		return json.Unmarshal([]byte(value), r)
+	case nil:
+		*r = ReactionCounts{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into ReactionCounts", value)
+	}
+}
+
+// Adding a reaction that already exists has no effect
+func (conn *MongoConnection) AddReaction(messageID, userID int64, emoji string) error {
+	_, err := conn.Exec(
+		`INSERT INTO message_reaction (message_id, user_id, emoji)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		messageID, userID, emoji,
+	)
+	return err
+}
+
+func (conn *MongoConnection) RemoveReaction(messageID, userID int64, emoji string) error {
+	_, err := conn.Exec(
+		`DELETE FROM message_reaction
+		WHERE message_id = $1 AND user_id = $2 AND emoji = $3`,
+		messageID, userID, emoji,
+	)
+	return err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// A request to reset a forgotten password, which can only be used once
+type PasswordReset struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"userID"`
+	ExpiryDate time.Time  `json:"expiryDate"`
+	UsedAt     *time.Time `json:"usedAt"`
+}
+
+func (conn *MongoConnection) SetPasswordReset(reset PasswordReset) error {
+	_, err := conn.Exec(
+		`INSERT INTO password_reset (id, user_id, expiry_date) VALUES ($1, $2, $3)`,
+		reset.ID, reset.UserID, reset.ExpiryDate,
+	)
+	return err
+}
+
+// Marks a password reset as used, along with any other reset of the same
+// user, so that only one of the links sent to them can be followed. Returns
+// nil if the reset has expired or was already used.
+func (conn *MongoConnection) UsePasswordReset(id string) (*PasswordReset, error) {
+	txn, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	reset, err := scanRow[PasswordReset](txn.QueryRow(
+		`UPDATE password_reset SET used_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE id = $1 AND used_at IS NULL AND expiry_date > (NOW() AT TIME ZONE 'UTC')
+		RETURNING *`,
+		id,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := txn.Exec(
+		`UPDATE password_reset SET used_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE user_id = $1 AND used_at IS NULL`,
+		reset.UserID,
+	); err != nil {
+		return nil, err
+	}
+	return reset, txn.Commit()
+}
+
+func (conn *MongoConnection) DeleteExpiredPasswordResets() (int64, error) {
+	result, err := conn.Exec(
+		`DELETE FROM password_reset WHERE expiry_date <= (NOW() AT TIME ZONE 'UTC')`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
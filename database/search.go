@@ -0,0 +1,68 @@
+package database
+
+import "time"
+
+// Text search configuration used to index and query message content
+const SEARCH_CONFIG string = "english"
+
+// Surround the matching words in the snippet of a MessageSearchResult. They
+// are control characters, stripped from the content before it is highlighted,
+// so that they cannot be confused with the text of the message.
+const (
+	SEARCH_MATCH_START string = "\x02"
+	SEARCH_MATCH_END   string = "\x03"
+)
+
+// A message that matches a search, with a snippet of its content where the
+// matching words are delimited by SEARCH_MATCH_START and SEARCH_MATCH_END
+type MessageSearchResult struct {
+	ID              int64     `json:"id"`
+	ChatID          int64     `json:"chatID"`
+	ThreadID        *int64    `json:"threadID"`
+	ChatName        string    `json:"chatName"`
+	ChatType        chatType  `json:"chatType"`
+	UserDisplayName string    `json:"userDisplayName"`
+	Snippet         string    `json:"snippet"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// The message to show a result at, replies to a thread are not in the chat's
+// timeline so it is the message that started their thread
+func (r MessageSearchResult) AnchorID() int64 {
+	if r.ThreadID != nil {
+		return *r.ThreadID
+	}
+	return r.ID
+}
+
+// Searches the content of the messages in every chat the user is a member of,
+// most recent first. Only messages older than beforeMessageID are returned,
+// unless it is 0, so that the ID of the last result can be used as a cursor.
+func (conn *MongoConnection) SearchMessages(userID int64, query string, beforeMessageID int64, limit int) ([]MessageSearchResult, error) {
+	return scanRows[MessageSearchResult](conn.Query(
+		`SELECT
+			m.id,
+			m.chat_id,
+			m.thread_id,
+			c.name,
+			c.type,
+			u.display_name,
+			ts_headline(
+				'`+SEARCH_CONFIG+`',
+				translate(m.content, chr(2) || chr(3), ''),
+				q.query,
+				'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2, MaxWords=20, MinWords=5'
+			),
+			m.created_at
+		FROM message m
+		JOIN chat_users cu ON cu.chat_id = m.chat_id AND cu.user_id = $1
+		JOIN chat c ON c.id = m.chat_id
+		JOIN "user" u ON u.id = m.user_id,
+		websearch_to_tsquery('`+SEARCH_CONFIG+`', $2) q(query)
+		WHERE m.search_vector @@ q.query AND m.deleted_at IS NULL
+		AND ($3 = 0 OR m.id < $3)
+		ORDER BY m.id DESC
+		LIMIT $4`,
+		userID, query, beforeMessageID, limit,
+	))
+}
@@ -1,61 +1,152 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/raphael-p/beango/utils/logger"
 )
 
+// ID is the secret held in the session cookie, Handle is the public
+// identifier used to refer to the session from other devices.
 type Session struct {
 	ID         string    `json:"id"`
 	UserID     int64     `json:"userID"`
 	ExpiryDate time.Time `json:"expiryDate"`
+	Handle     string    `json:"handle"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
 }
 
-func (conn *MongoConnection) GetSession(id string) *Session {
-	session, ok := Sessions[id]
-	if !ok {
-		return nil
-	} else {
-		return &session
+func (conn *MongoConnection) GetSession(id string) (*Session, error) {
+	session, err := scanRow[Session](conn.QueryRow(
+		`SELECT * FROM session WHERE id = $1`,
+		id,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
 	}
+	return session, err
 }
 
-func (conn *MongoConnection) SetSession(session Session) {
-	if session, err := conn.GetSessionByUserID(session.UserID); err == nil {
-		conn.DeleteSession(session.ID)
+func (conn *MongoConnection) GetSessionByHandle(handle string) (*Session, error) {
+	session, err := scanRow[Session](conn.QueryRow(
+		`SELECT * FROM session WHERE handle = $1`,
+		handle,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
 	}
+	return session, err
+}
 
-	Sessions[session.ID] = session
-	fmt.Println("Active Sessions:")
-	for key := range Sessions {
-		fmt.Println("\t" + key)
-	}
+// Fetches all unexpired sessions of a user, most recently seen first
+func (conn *MongoConnection) GetSessionsByUserID(userID int64) ([]Session, error) {
+	return scanRows[Session](conn.Query(
+		`SELECT * FROM session
+		WHERE user_id = $1 AND expiry_date > (NOW() AT TIME ZONE 'UTC')
+		ORDER BY last_seen_at DESC`,
+		userID,
+	))
+}
+
+func (conn *MongoConnection) SetSession(session Session) error {
+	_, err := conn.Exec(
+		`INSERT INTO session (
+			id, user_id, expiry_date, handle, user_agent, ip_address, created_at, last_seen_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		session.ID,
+		session.UserID,
+		session.ExpiryDate,
+		session.Handle,
+		session.UserAgent,
+		session.IPAddress,
+		session.CreatedAt,
+		session.LastSeenAt,
+	)
+	return err
+}
+
+func (conn *MongoConnection) DeleteSession(id string) error {
+	_, err := conn.Exec(`DELETE FROM session WHERE id = $1`, id)
+	return err
 }
 
-func (conn *MongoConnection) DeleteSession(id string) {
-	delete(Sessions, id)
+// Deletes all sessions of a user except the one with the given ID
+func (conn *MongoConnection) DeleteOtherSessions(userID int64, keepID string) error {
+	_, err := conn.Exec(
+		`DELETE FROM session WHERE user_id = $1 AND id <> $2`,
+		userID, keepID,
+	)
+	return err
 }
 
-func (conn *MongoConnection) CheckSession(id string) (*Session, bool) {
+// How out of date the last time a session was seen may get, so that each
+// request does not have to write to the session
+const LAST_SEEN_PRECISION = time.Minute
+
+// Fetches a session that has not expired, and marks it as seen if it was last
+// seen longer ago than LAST_SEEN_PRECISION
+func (conn *MongoConnection) CheckSession(id string) (*Session, error) {
 	if id == "" {
-		return nil, false
+		return nil, nil
 	}
-	session := conn.GetSession(id)
-	if session == nil {
-		return nil, false
+	session, err := scanRow[Session](conn.QueryRow(
+		`WITH seen AS (
+			UPDATE session SET last_seen_at = (NOW() AT TIME ZONE 'UTC')
+			WHERE id = $1 AND expiry_date > (NOW() AT TIME ZONE 'UTC')
+			AND last_seen_at < (NOW() AT TIME ZONE 'UTC') - make_interval(secs => $2)
+			RETURNING *
+		)
+		SELECT * FROM seen
+		UNION ALL
+		SELECT * FROM session
+		WHERE id = $1 AND expiry_date > (NOW() AT TIME ZONE 'UTC')
+		AND NOT EXISTS (SELECT 1 FROM seen)`,
+		id, LAST_SEEN_PRECISION.Seconds(),
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
 	}
-	if session.ExpiryDate.Before(time.Now().UTC()) {
-		conn.DeleteSession(session.ID)
-		return nil, false
+	return session, err
+}
+
+func (conn *MongoConnection) DeleteExpiredSessions() (int64, error) {
+	result, err := conn.Exec(
+		`DELETE FROM session WHERE expiry_date <= (NOW() AT TIME ZONE 'UTC')`,
+	)
+	if err != nil {
+		return 0, err
 	}
-	return session, true
+	return result.RowsAffected()
 }
 
-func (conn *MongoConnection) GetSessionByUserID(userID int64) (*Session, error) {
-	for _, session := range Sessions {
-		if session.UserID == userID {
-			return &session, nil
-		}
+// Deletes expired sessions, pre-auth tokens and password resets at a regular
+// interval, in the background
+func (conn *MongoConnection) StartExpirySweeper(interval time.Duration) {
+	sweeps := []struct {
+		name   string
+		delete func() (int64, error)
+	}{
+		{"session", conn.DeleteExpiredSessions},
+		{"pre-auth token", conn.DeleteExpiredPreAuthTokens},
+		{"password reset", conn.DeleteExpiredPasswordResets},
 	}
-	return nil, fmt.Errorf("no session found for user ID %d", userID)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, sweep := range sweeps {
+				count, err := sweep.delete()
+				if err != nil {
+					logger.Error(fmt.Sprintf("failed to delete expired %ss: %s", sweep.name, err))
+					continue
+				}
+				logger.Trace(fmt.Sprintf("deleted %d expired %s(s)", count, sweep.name))
+			}
+		}
+	}()
 }
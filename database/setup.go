@@ -80,6 +80,11 @@ func Setup(conn *MongoConnection) {
 	)`)
 	handleError(tx, err)
 
+	_, err = tx.Exec(`
+		ALTER TABLE chat_users ADD COLUMN IF NOT EXISTS last_read_message_id INT NOT NULL DEFAULT 0;
+	`)
+	handleError(tx, err)
+
 	_, err = tx.Exec(`
 	CREATE TABLE IF NOT EXISTS message (
 		id SERIAL PRIMARY KEY,
@@ -91,6 +96,157 @@ func Setup(conn *MongoConnection) {
 	)`)
 	handleError(tx, err)
 
+	_, err = tx.Exec(`
+		ALTER TABLE message ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		ALTER TABLE message ADD COLUMN IF NOT EXISTS reply_to_message_id INT REFERENCES message(id);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		ALTER TABLE message ADD COLUMN IF NOT EXISTS thread_id INT REFERENCES message(id);
+		CREATE INDEX IF NOT EXISTS message_thread_id_idx ON message (thread_id);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		ALTER TABLE message ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+			GENERATED ALWAYS AS (to_tsvector('` + SEARCH_CONFIG + `', content)) STORED;
+		CREATE INDEX IF NOT EXISTS message_search_vector_idx ON message USING GIN (search_vector);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS message_revision (
+		id SERIAL PRIMARY KEY,
+		message_id INT NOT NULL REFERENCES message(id),
+		content TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC')
+	)`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		CREATE INDEX IF NOT EXISTS message_revision_message_id_idx ON message_revision (message_id);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS message_reaction (
+		message_id INT NOT NULL REFERENCES message(id),
+		user_id INT NOT NULL REFERENCES "user"(id),
+		emoji TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+		PRIMARY KEY (message_id, user_id, emoji)
+	)`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS attachment (
+		id SERIAL PRIMARY KEY,
+		message_id INT NOT NULL REFERENCES message(id),
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		blob_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC')
+	);
+	CREATE INDEX IF NOT EXISTS attachment_message_id_idx ON attachment (message_id);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS session (
+		id TEXT PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES "user"(id),
+		expiry_date TIMESTAMP NOT NULL
+	)`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		CREATE INDEX IF NOT EXISTS session_expiry_date_idx ON session (expiry_date);
+		CREATE INDEX IF NOT EXISTS session_user_id_idx ON session (user_id);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		ALTER TABLE session
+			ADD COLUMN IF NOT EXISTS handle TEXT NOT NULL DEFAULT md5(random()::TEXT || clock_timestamp()::TEXT),
+			ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS ip_address TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+			ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC');
+		CREATE UNIQUE INDEX IF NOT EXISTS session_handle_idx ON session (handle);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS api_token (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES "user"(id),
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		scopes TEXT[] NOT NULL,
+		expiry_date TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+		last_used_at TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS api_token_hash_idx ON api_token (hash);
+	CREATE INDEX IF NOT EXISTS api_token_user_id_idx ON api_token (user_id);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS user_totp (
+		user_id INT PRIMARY KEY REFERENCES "user"(id),
+		secret TEXT NOT NULL,
+		enabled_at TIMESTAMP,
+		last_used_step BIGINT NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS recovery_code (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES "user"(id),
+		hash TEXT NOT NULL,
+		used_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS recovery_code_user_id_idx ON recovery_code (user_id);
+	CREATE TABLE IF NOT EXISTS pre_auth_token (
+		id TEXT PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES "user"(id),
+		expiry_date TIMESTAMP NOT NULL,
+		attempts INT NOT NULL DEFAULT 0
+	);
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+		ALTER TABLE "user"
+			ADD COLUMN IF NOT EXISTS email TEXT,
+			ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+	`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS password_reset (
+		id TEXT PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES "user"(id),
+		expiry_date TIMESTAMP NOT NULL,
+		used_at TIMESTAMP
+	)`)
+	handleError(tx, err)
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS rate_limit (
+		key TEXT PRIMARY KEY,
+		failures INT NOT NULL,
+		last_failure_at TIMESTAMP NOT NULL,
+		locked_until TIMESTAMP NOT NULL
+	)`)
+	handleError(tx, err)
+
 	err = tx.Commit()
 	handleError(tx, err)
 }
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TokenScope string
+
+const (
+	// Requests that do not change anything, such as reading messages
+	READ_SCOPE TokenScope = "read"
+	// Requests that change something, such as sending messages
+	WRITE_SCOPE TokenScope = "write"
+)
+
+var TOKEN_SCOPES = []TokenScope{READ_SCOPE, WRITE_SCOPE}
+
+type TokenScopes []TokenScope
+
+func (s *TokenScopes) Scan(value any) error {
+	var scopes pq.StringArray
+	if err := scopes.Scan(value); err != nil {
+		return err
+	}
+	*s = make(TokenScopes, len(scopes))
+	for i, scope := range scopes {
+		(*s)[i] = TokenScope(scope)
+	}
+	return nil
+}
+
+func (s TokenScopes) Has(scope TokenScope) bool {
+	return slices.Contains(s, scope)
+}
+
+// A personal API token, used by non-browser clients. Only a hash of the
+// token is stored, Prefix is kept so that users can tell their tokens apart.
+type APIToken struct {
+	ID         int64       `json:"id"`
+	UserID     int64       `json:"userID"`
+	Name       string      `json:"name"`
+	Hash       string      `json:"-"`
+	Prefix     string      `json:"prefix"`
+	Scopes     TokenScopes `json:"scopes"`
+	ExpiryDate *time.Time  `json:"expiryDate"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	LastUsedAt *time.Time  `json:"lastUsedAt"`
+}
+
+const tokenColumns string = `id, user_id, name, hash, prefix, scopes, expiry_date, created_at, last_used_at`
+
+func (conn *MongoConnection) GetAPITokensByUserID(userID int64) ([]APIToken, error) {
+	return scanRows[APIToken](conn.Query(
+		`SELECT `+tokenColumns+` FROM api_token
+		WHERE user_id = $1
+		ORDER BY id`,
+		userID,
+	))
+}
+
+func (conn *MongoConnection) SetAPIToken(token *APIToken) (*APIToken, error) {
+	return scanRow[APIToken](conn.QueryRow(
+		`INSERT INTO api_token (user_id, name, hash, prefix, scopes, expiry_date, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+tokenColumns,
+		token.UserID,
+		token.Name,
+		token.Hash,
+		token.Prefix,
+		pq.Array(token.Scopes),
+		token.ExpiryDate,
+		token.CreatedAt,
+	))
+}
+
+// Deletes a token of the user, returns whether there was one
+func (conn *MongoConnection) DeleteAPIToken(id, userID int64) (bool, error) {
+	result, err := conn.Exec(`DELETE FROM api_token WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Fetches a token by its hash and marks it as used if it has not expired, returns nil otherwise
+func (conn *MongoConnection) CheckAPIToken(hash string) (*APIToken, error) {
+	token, err := scanRow[APIToken](conn.QueryRow(
+		`UPDATE api_token SET last_used_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE hash = $1 AND (expiry_date IS NULL OR expiry_date > (NOW() AT TIME ZONE 'UTC'))
+		RETURNING `+tokenColumns,
+		hash,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The TOTP secret of a user. Two-factor authentication is only enabled once
+// the user has confirmed that they can generate codes, until then EnabledAt
+// is nil. LastUsedStep stops codes from being used twice.
+type TOTP struct {
+	UserID       int64      `json:"userID"`
+	Secret       string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabledAt"`
+	LastUsedStep int64      `json:"-"`
+}
+
+func (t *TOTP) IsEnabled() bool {
+	return t != nil && t.EnabledAt != nil
+}
+
+// Issued once the password of a user with two-factor authentication has been
+// checked, and exchanged for a session along with a code
+type PreAuthToken struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"userID"`
+	ExpiryDate time.Time `json:"expiryDate"`
+	Attempts   int64     `json:"attempts"`
+}
+
+func (conn *MongoConnection) GetTOTP(userID int64) (*TOTP, error) {
+	totp, err := scanRow[TOTP](conn.QueryRow(
+		`SELECT user_id, secret, enabled_at, last_used_step FROM user_totp WHERE user_id = $1`,
+		userID,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return totp, err
+}
+
+// Sets a new secret that is not enabled yet, replacing any previous one
+func (conn *MongoConnection) SetTOTP(userID int64, secret string) error {
+	_, err := conn.Exec(
+		`INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, enabled_at = NULL, last_used_step = 0`,
+		userID, secret,
+	)
+	return err
+}
+
+// Enables two-factor authentication once the first code has been checked,
+// and replaces the recovery codes of the user
+func (conn *MongoConnection) EnableTOTP(userID, step int64, recoveryCodeHashes []string) error {
+	txn, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if _, err := txn.Exec(
+		`UPDATE user_totp
+		SET enabled_at = (NOW() AT TIME ZONE 'UTC'), last_used_step = $2
+		WHERE user_id = $1`,
+		userID, step,
+	); err != nil {
+		return err
+	}
+	if _, err := txn.Exec(`DELETE FROM recovery_code WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := txn.Exec(
+		`INSERT INTO recovery_code (user_id, hash)
+		SELECT $1, unnest($2::TEXT[])`,
+		userID, pq.Array(recoveryCodeHashes),
+	); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// Disables two-factor authentication, along with the recovery codes
+func (conn *MongoConnection) DeleteTOTP(userID int64) error {
+	txn, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if _, err := txn.Exec(`DELETE FROM recovery_code WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := txn.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// Records that a code from the given step was used, returns false if a code
+// from that step or a later one was already used
+func (conn *MongoConnection) UseTOTPStep(userID, step int64) (bool, error) {
+	result, err := conn.Exec(
+		`UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`,
+		userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Marks a recovery code as used, returns false if there is no unused code with that hash
+func (conn *MongoConnection) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	result, err := conn.Exec(
+		`UPDATE recovery_code SET used_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`,
+		userID, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+func (conn *MongoConnection) CountRecoveryCodes(userID int64) (int64, error) {
+	var count int64
+	err := conn.QueryRow(
+		`SELECT COUNT(*) FROM recovery_code WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+func (conn *MongoConnection) SetPreAuthToken(token PreAuthToken) error {
+	_, err := conn.Exec(
+		`INSERT INTO pre_auth_token (id, user_id, expiry_date, attempts) VALUES ($1, $2, $3, $4)`,
+		token.ID, token.UserID, token.ExpiryDate, token.Attempts,
+	)
+	return err
+}
+
+// Fetches a token and counts an attempt to use it, returns nil if it has
+// expired or has already been attempted maxAttempts times
+func (conn *MongoConnection) CheckPreAuthToken(id string, maxAttempts int64) (*PreAuthToken, error) {
+	token, err := scanRow[PreAuthToken](conn.QueryRow(
+		`UPDATE pre_auth_token SET attempts = attempts + 1
+		WHERE id = $1 AND attempts < $2 AND expiry_date > (NOW() AT TIME ZONE 'UTC')
+		RETURNING id, user_id, expiry_date, attempts`,
+		id, maxAttempts,
+	))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+func (conn *MongoConnection) DeletePreAuthToken(id string) error {
+	_, err := conn.Exec(`DELETE FROM pre_auth_token WHERE id = $1`, id)
+	return err
+}
+
+func (conn *MongoConnection) DeleteExpiredPreAuthTokens() (int64, error) {
+	result, err := conn.Exec(
+		`DELETE FROM pre_auth_token WHERE expiry_date <= (NOW() AT TIME ZONE 'UTC')`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
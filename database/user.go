@@ -5,13 +5,20 @@ import (
 	"time"
 )
 
+// Email is optional, and is only used once EmailVerifiedAt is set
 type User struct {
-	ID            int64     `json:"id"`
-	Username      string    `json:"username"`
-	DisplayName   string    `json:"displayName"`
-	Key           []byte    `json:"key"`
-	CreatedAt     time.Time `json:"createdAt"`
-	LastUpdatedAt time.Time `json:"LastUpdatedAt"`
+	ID              int64      `json:"id"`
+	Username        string     `json:"username"`
+	DisplayName     string     `json:"displayName"`
+	Key             []byte     `json:"key"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastUpdatedAt   time.Time  `json:"LastUpdatedAt"`
+	Email           *string    `json:"email"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+}
+
+func (user *User) HasVerifiedEmail() bool {
+	return user.Email != nil && user.EmailVerifiedAt != nil
 }
 
 func (conn *MongoConnection) GetUser(id int64) (*User, error) {
@@ -59,6 +66,38 @@ func (conn *MongoConnection) SetUser(user *User) (*User, error) {
 	))
 }
 
+// Inserts a user along with their personal chat for notes to self, so that no
+// user is left without one
+func (conn *MongoConnection) SetUserWithNoteChat(user *User) (*User, error) {
+	txn, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+
+	user, err = scanRow[User](txn.QueryRow(
+		`INSERT INTO "user" (username, display_name, key)
+		VALUES ($1, $2, $3)
+		RETURNING *`,
+		user.Username, user.DisplayName, user.Key,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := txn.Exec(
+		`WITH note AS (
+			INSERT INTO chat (type, name) VALUES ($1, '')
+			RETURNING id
+		)
+		INSERT INTO chat_users (chat_id, user_id)
+		SELECT id, $2 FROM note`,
+		NOTE, user.ID,
+	); err != nil {
+		return nil, err
+	}
+	return user, txn.Commit()
+}
+
 func (conn *MongoConnection) SearchUsers(username string, searchUserID int64) ([]User, error) {
 	return scanRows[User](conn.Query(
 		`SELECT * FROM "user" 
@@ -77,3 +116,40 @@ func (conn *MongoConnection) RenameUser(id int64, displayName string) error {
 	)
 	return err
 }
+
+func (conn *MongoConnection) UpdateUserKey(id int64, key []byte) error {
+	_, err := conn.Exec(
+		`UPDATE "user"
+		SET key = $1, last_updated_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE id = $2`,
+		key, id,
+	)
+	return err
+}
+
+// Sets an email address that is not verified yet, or removes it if nil
+func (conn *MongoConnection) SetUserEmail(id int64, email *string) error {
+	_, err := conn.Exec(
+		`UPDATE "user"
+		SET email = $1, email_verified_at = NULL, last_updated_at = (NOW() AT TIME ZONE 'UTC')
+		WHERE id = $2`,
+		email, id,
+	)
+	return err
+}
+
+// Marks the email address of a user as verified, returns false if the user
+// no longer has that address
+func (conn *MongoConnection) VerifyUserEmail(id int64, email string) (bool, error) {
+	result, err := conn.Exec(
+		`UPDATE "user"
+		SET email_verified_at = COALESCE(email_verified_at, (NOW() AT TIME ZONE 'UTC'))
+		WHERE id = $1 AND email = $2`,
+		id, email,
+	)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
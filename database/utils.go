@@ -6,7 +6,7 @@ import (
 )
 
 type databaseEntity interface {
-	User | Chat | ChatUser | MessageDatabase | Message
+	User | Chat | ChatUser | UnreadCount | ReadReceipt | MessageDatabase | Message | MessageRevision | MessageSearchResult | Attachment | Session | APIToken | TOTP | PreAuthToken | PasswordReset
 }
 
 // Maps a SQL row onto a struct of a database entity
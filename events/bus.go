@@ -0,0 +1,34 @@
+package events
+
+import "encoding/json"
+
+// An event to forward to the SSE connections of a stream, e.g. all the
+// connections listening to a given chat
+type Event struct {
+	Scope string `json:"scope"`
+	Key   int64  `json:"key"`
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Data  string `json:"data"`
+}
+
+type Handler func(event Event)
+
+// Carries events between server instances. Every subscriber receives every
+// published event, including those published by its own instance.
+type Bus interface {
+	Publish(event Event) error
+	Subscribe(handler Handler)
+	Close() error
+}
+
+func encodeEvent(event Event) (string, error) {
+	payload, err := json.Marshal(event)
+	return string(payload), err
+}
+
+func decodeEvent(payload string) (Event, error) {
+	var event Event
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
@@ -0,0 +1,45 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestLocalBus(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		bus := NewLocalBus()
+		var received1, received2 []Event
+		bus.Subscribe(func(event Event) { received1 = append(received1, event) })
+		bus.Subscribe(func(event Event) { received2 = append(received2, event) })
+		event := Event{Scope: "chat", Key: 1, ID: "5", Name: "new-messages", Data: "{}"}
+
+		err := bus.Publish(event)
+		assert.IsNil(t, err)
+		assert.DeepEquals(t, received1, []Event{event})
+		assert.DeepEquals(t, received2, []Event{event})
+	})
+
+	t.Run("NoSubscribers", func(t *testing.T) {
+		bus := NewLocalBus()
+		err := bus.Publish(Event{Name: "new-messages"})
+		assert.IsNil(t, err)
+	})
+}
+
+func TestEncodeEvent(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		event := Event{Scope: "user", Key: 3, Name: "new-chat", Data: `{"chatID":7}`}
+
+		payload, err := encodeEvent(event)
+		assert.IsNil(t, err)
+		decoded, err := decodeEvent(payload)
+		assert.IsNil(t, err)
+		assert.Equals(t, decoded, event)
+	})
+
+	t.Run("InvalidPayload", func(t *testing.T) {
+		_, err := decodeEvent("raisin")
+		assert.IsNotNil(t, err)
+	})
+}
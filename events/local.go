@@ -0,0 +1,33 @@
+package events
+
+import "sync"
+
+// Delivers events within the current process only, which is enough when
+// running a single server instance
+type LocalBus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+func (bus *LocalBus) Publish(event Event) error {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	for _, handler := range bus.handlers {
+		handler(event)
+	}
+	return nil
+}
+
+func (bus *LocalBus) Subscribe(handler Handler) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.handlers = append(bus.handlers, handler)
+}
+
+func (bus *LocalBus) Close() error {
+	return nil
+}
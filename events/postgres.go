@@ -0,0 +1,84 @@
+package events
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raphael-p/beango/utils/logger"
+)
+
+const POSTGRES_CHANNEL = "beango_events"
+
+// Delivers events to every server instance connected to the same database,
+// using LISTEN/NOTIFY. Events published while an instance's listener is
+// reconnecting are lost to that instance.
+type PostgresBus struct {
+	db       *sql.DB
+	listener *pq.Listener
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewPostgresBus(db *sql.DB, connectionString string) (*PostgresBus, error) {
+	listener := pq.NewListener(
+		connectionString,
+		time.Second,
+		time.Minute,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				logger.Error("event bus listener: " + err.Error())
+			}
+		},
+	)
+	if err := listener.Listen(POSTGRES_CHANNEL); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	bus := &PostgresBus{db: db, listener: listener}
+	go bus.listen()
+	return bus, nil
+}
+
+func (bus *PostgresBus) listen() {
+	for notification := range bus.listener.Notify {
+		if notification == nil { // the listener reconnected
+			logger.Warning("event bus listener reconnected, events may have been missed")
+			continue
+		}
+
+		event, err := decodeEvent(notification.Extra)
+		if err != nil {
+			logger.Error(fmt.Sprint("failed to decode event: ", err))
+			continue
+		}
+
+		bus.mu.RLock()
+		for _, handler := range bus.handlers {
+			handler(event)
+		}
+		bus.mu.RUnlock()
+	}
+}
+
+func (bus *PostgresBus) Publish(event Event) error {
+	payload, err := encodeEvent(event)
+	if err != nil {
+		return err
+	}
+	_, err = bus.db.Exec(`SELECT pg_notify($1, $2)`, POSTGRES_CHANNEL, payload)
+	return err
+}
+
+func (bus *PostgresBus) Subscribe(handler Handler) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.handlers = append(bus.handlers, handler)
+}
+
+func (bus *PostgresBus) Close() error {
+	return bus.listener.Close()
+}
@@ -6,4 +6,5 @@ require (
 	github.com/google/uuid v1.4.0
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0
 )
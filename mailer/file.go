@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Appends emails to a file instead of sending them, for development
+type FileMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+	now  func() time.Time
+}
+
+func NewFileMailer(path, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	return &FileMailer{path: path, from: from, now: time.Now}, nil
+}
+
+func (mailer *FileMailer) Send(message Message) error {
+	content, err := format(mailer.from, message, mailer.now())
+	if err != nil {
+		return err
+	}
+
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	file, err := os.OpenFile(mailer.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
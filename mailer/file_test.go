@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestFileMailer(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "mail", "outbox.eml")
+		mailer, err := NewFileMailer(path, "beango@example.com")
+		assert.IsNil(t, err)
+
+		assert.IsNil(t, mailer.Send(Message{To: "bean@example.com", Subject: "First", Body: "one"}))
+		assert.IsNil(t, mailer.Send(Message{To: "bean@example.com", Subject: "Second", Body: "two"}))
+		content, err := os.ReadFile(path)
+		assert.IsNil(t, err)
+		assert.Contains(t, string(content), "Subject: First", "Subject: Second")
+		assert.Equals(t, strings.Count(string(content), "From: beango@example.com"), 2)
+	})
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/raphael-p/beango/utils/logger"
+)
+
+// Writes emails to the server log instead of sending them, for development.
+// The body is logged as is, so that links can be copied from it.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (mailer *LogMailer) Send(message Message) error {
+	logger.Info(fmt.Sprintf(
+		"email to %s (not sent, no mail server set up)\nSubject: %s\n\n%s",
+		message.To, message.Subject, message.Body,
+	))
+	return nil
+}
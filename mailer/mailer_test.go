@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("Normal", func(t *testing.T) {
+		message := Message{To: "bean@example.com", Subject: "Réinitialiser", Body: "Hello\nthere"}
+		content, err := format("beango@example.com", message, date)
+		assert.IsNil(t, err)
+		assert.Contains(
+			t,
+			string(content),
+			"From: beango@example.com\r\nTo: bean@example.com\r\n",
+			"Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n",
+			"Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n",
+			"\r\n\r\nHello\r\nthere\r\n",
+		)
+	})
+
+	t.Run("HeaderInjection", func(t *testing.T) {
+		message := Message{To: "bean@example.com\r\nBcc: everyone@example.com", Subject: "Hi"}
+		_, err := format("beango@example.com", message, date)
+		assert.Equals(t, err, errInvalidHeader)
+	})
+}
+
+func TestValidAddress(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		assert.Equals(t, ValidAddress("bean@example.com"), true)
+		assert.Equals(t, ValidAddress("Bean <bean@example.com>"), false)
+		assert.Equals(t, ValidAddress("bean"), false)
+		assert.Equals(t, ValidAddress(""), false)
+	})
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Sends emails through an SMTP server. STARTTLS is used whenever the server
+// offers it, and the credentials are only sent over TLS, or to localhost.
+type SMTPMailer struct {
+	address string
+	from    string
+	auth    smtp.Auth
+	now     func() time.Time
+}
+
+func NewSMTPMailer(host string, port uint16, from, username, password string) (*SMTPMailer, error) {
+	if host == "" || port == 0 {
+		return nil, fmt.Errorf("SMTP host and port must be set")
+	}
+	if !ValidAddress(from) {
+		return nil, fmt.Errorf("invalid sender address: %q", from)
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		address: net.JoinHostPort(host, strconv.Itoa(int(port))),
+		from:    from,
+		auth:    auth,
+		now:     time.Now,
+	}, nil
+}
+
+func (mailer *SMTPMailer) Send(message Message) error {
+	content, err := format(mailer.from, message, mailer.now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(mailer.address, mailer.auth, mailer.from, []string{message.To}, content)
+}
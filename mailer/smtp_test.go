@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+// A stand-in SMTP server that accepts a single email, and records the
+// commands and content that it received
+type smtpStandIn struct {
+	listener net.Listener
+	commands []string
+	content  string
+	done     chan struct{}
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.IsNil(t, err)
+	server := &smtpStandIn{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (server *smtpStandIn) port() uint16 {
+	return uint16(server.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (server *smtpStandIn) serve() {
+	defer close(server.done)
+	conn, err := server.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		server.commands = append(server.commands, command)
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			reply("235 2.7.0 Authentication successful")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var content strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				content.WriteString(line)
+			}
+			server.content = content.String()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		server := startSMTPStandIn(t)
+		mailer, err := NewSMTPMailer("127.0.0.1", server.port(), "beango@example.com", "beango", "secret")
+		assert.IsNil(t, err)
+
+		err = mailer.Send(Message{To: "bean@example.com", Subject: "Hello", Body: "Hi bean"})
+		assert.IsNil(t, err)
+		<-server.done
+		assert.Contains(
+			t,
+			strings.Join(server.commands, "\n"),
+			"AUTH PLAIN",
+			"MAIL FROM:<beango@example.com>",
+			"RCPT TO:<bean@example.com>",
+		)
+		assert.Contains(t, server.content, "To: bean@example.com\r\n", "Subject: Hello\r\n", "Hi bean")
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		_, err := NewSMTPMailer("", 25, "beango@example.com", "", "")
+		assert.ErrorHasMessage(t, err, "SMTP host and port must be set")
+		_, err = NewSMTPMailer("127.0.0.1", 25, "Beango <beango@example.com>", "", "")
+		assert.ErrorHasMessage(t, err, `invalid sender address: "Beango <beango@example.com>"`)
+	})
+}
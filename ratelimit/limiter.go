@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/raphael-p/beango/utils/logger"
+)
+
+type Policy struct {
+	// Failures allowed before a key gets locked
+	FreeAttempts int64
+	// How long a key is locked after the first failure over FreeAttempts,
+	// doubling with each further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Failures are forgotten once there has not been one for this long
+	ResetAfter time.Duration
+}
+
+// How long a key is locked after its nth failure
+func (policy Policy) Delay(failures int64) time.Duration {
+	over := failures - policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := policy.BaseDelay
+	for i := int64(1); i < over && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, policy.MaxDelay)
+}
+
+// Attempts are tracked under one or more keys, such as a username and an IP
+// address. Only keys with ClearOnSuccess have their failures cleared by a
+// successful attempt, so that an IP address guessing the passwords of many
+// accounts cannot reset its count by logging into its own.
+type Key struct {
+	Value          string
+	ClearOnSuccess bool
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store, policy, time.Now}
+}
+
+// Returns how long until none of the keys are locked, or 0 if none are
+func (limiter *Limiter) Check(keys ...Key) (time.Duration, error) {
+	now := limiter.now()
+	var wait time.Duration
+	for _, key := range keys {
+		record, err := limiter.store.Get(key.Value)
+		if err != nil {
+			return 0, err
+		}
+		if record != nil && record.LockedUntil.Sub(now) > wait {
+			wait = record.LockedUntil.Sub(now)
+		}
+	}
+	return wait, nil
+}
+
+// Counts a failure against each of the keys, locking those with too many
+func (limiter *Limiter) Fail(keys ...Key) error {
+	now := limiter.now()
+	for _, key := range keys {
+		failures, err := limiter.store.AddFailure(key.Value, now, now.Add(-limiter.policy.ResetAfter))
+		if err != nil {
+			return err
+		}
+		if delay := limiter.policy.Delay(failures); delay > 0 {
+			if err := limiter.store.Lock(key.Value, now.Add(delay)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (limiter *Limiter) Succeed(keys ...Key) error {
+	for _, key := range keys {
+		if !key.ClearOnSuccess {
+			continue
+		}
+		if err := limiter.store.Delete(key.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes forgotten records at a regular interval, in the background
+func (limiter *Limiter) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			count, err := limiter.store.DeleteBefore(limiter.now().Add(-limiter.policy.ResetAfter))
+			if err != nil {
+				logger.Error("failed to delete rate limit records: " + err.Error())
+				continue
+			}
+			logger.Trace(fmt.Sprintf("deleted %d rate limit record(s)", count))
+		}
+	}()
+}
+
+// The keys of a request, so that the handler can report how it went once the
+// credentials have been checked
+type Attempt struct {
+	limiter *Limiter
+	keys    []Key
+}
+
+func (limiter *Limiter) NewAttempt(keys ...Key) *Attempt {
+	return &Attempt{limiter, keys}
+}
+
+func (attempt *Attempt) Fail() error {
+	return attempt.limiter.Fail(attempt.keys...)
+}
+
+func (attempt *Attempt) Succeed() error {
+	return attempt.limiter.Succeed(attempt.keys...)
+}
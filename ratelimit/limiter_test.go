@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	ResetAfter:   time.Hour,
+}
+
+// A limiter with a clock that only moves when told to
+func makeLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewLocalStore(), testPolicy)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestDelay(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		xDelays := map[int64]time.Duration{
+			0:  0,
+			3:  0,
+			4:  time.Second,
+			5:  2 * time.Second,
+			7:  8 * time.Second,
+			8:  10 * time.Second,
+			60: 10 * time.Second,
+		}
+		for failures, xDelay := range xDelays {
+			assert.Equals(t, testPolicy.Delay(failures), xDelay)
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	username := Key{Value: "username:admin", ClearOnSuccess: true}
+	ip := Key{Value: "ip:192.0.2.1"}
+
+	t.Run("Normal", func(t *testing.T) {
+		limiter, _ := makeLimiter()
+		for i := int64(0); i < testPolicy.FreeAttempts; i++ {
+			assert.IsNil(t, limiter.Fail(username, ip))
+		}
+		wait, err := limiter.Check(username, ip)
+		assert.IsNil(t, err)
+		assert.Equals(t, wait, time.Duration(0))
+
+		assert.IsNil(t, limiter.Fail(username, ip))
+		wait, _ = limiter.Check(username, ip)
+		assert.Equals(t, wait, time.Second)
+		wait, _ = limiter.Check(Key{Value: "username:someone"})
+		assert.Equals(t, wait, time.Duration(0))
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		limiter, now := makeLimiter()
+		for i := int64(0); i < testPolicy.FreeAttempts+2; i++ {
+			limiter.Fail(ip)
+		}
+		wait, _ := limiter.Check(ip)
+		assert.Equals(t, wait, 2*time.Second)
+
+		*now = now.Add(1500 * time.Millisecond)
+		wait, _ = limiter.Check(ip)
+		assert.Equals(t, wait, 500*time.Millisecond)
+		*now = now.Add(time.Second)
+		wait, _ = limiter.Check(ip)
+		assert.Equals(t, wait, time.Duration(0))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		limiter, now := makeLimiter()
+		for i := int64(0); i < testPolicy.FreeAttempts; i++ {
+			limiter.Fail(ip)
+		}
+		*now = now.Add(testPolicy.ResetAfter + time.Second)
+
+		limiter.Fail(ip)
+		wait, _ := limiter.Check(ip)
+		assert.Equals(t, wait, time.Duration(0))
+	})
+
+	t.Run("SucceedClearsSomeKeys", func(t *testing.T) {
+		limiter, _ := makeLimiter()
+		for i := int64(0); i <= testPolicy.FreeAttempts; i++ {
+			limiter.Fail(username, ip)
+		}
+
+		attempt := limiter.NewAttempt(username, ip)
+		assert.IsNil(t, attempt.Succeed())
+		wait, _ := limiter.Check(username)
+		assert.Equals(t, wait, time.Duration(0))
+		wait, _ = limiter.Check(ip)
+		assert.Equals(t, wait, time.Second)
+	})
+}
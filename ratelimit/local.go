@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Keeps records in memory, so attempts are only limited per server instance
+type LocalStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewLocalStore() *LocalStore {
+	return &LocalStore{records: make(map[string]Record)}
+}
+
+func (store *LocalStore) Get(key string) (*Record, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	record, ok := store.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (store *LocalStore) AddFailure(key string, now, resetBefore time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	record := store.records[key]
+	if record.LastFailureAt.Before(resetBefore) {
+		record.Failures = 0
+	}
+	record.Failures++
+	record.LastFailureAt = now
+	store.records[key] = record
+	return record.Failures, nil
+}
+
+func (store *LocalStore) Lock(key string, until time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	record, ok := store.records[key]
+	if ok && until.After(record.LockedUntil) {
+		record.LockedUntil = until
+		store.records[key] = record
+	}
+	return nil
+}
+
+func (store *LocalStore) Delete(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.records, key)
+	return nil
+}
+
+func (store *LocalStore) DeleteBefore(before time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var count int64
+	for key, record := range store.records {
+		if record.LastFailureAt.Before(before) && record.LockedUntil.Before(before) {
+			delete(store.records, key)
+			count++
+		}
+	}
+	return count, nil
+}
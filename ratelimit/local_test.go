@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		store := NewLocalStore()
+		now := time.Now()
+		record, err := store.Get("ip:192.0.2.1")
+		assert.IsNil(t, err)
+		assert.IsNil(t, record)
+
+		store.AddFailure("ip:192.0.2.1", now, now.Add(-time.Hour))
+		failures, err := store.AddFailure("ip:192.0.2.1", now, now.Add(-time.Hour))
+		assert.IsNil(t, err)
+		assert.Equals(t, failures, int64(2))
+		store.Lock("ip:192.0.2.1", now.Add(time.Minute))
+		store.Lock("ip:192.0.2.1", now.Add(time.Second)) // does not shorten the lock
+		record, _ = store.Get("ip:192.0.2.1")
+		assert.Equals(t, record.LockedUntil, now.Add(time.Minute))
+
+		assert.IsNil(t, store.Delete("ip:192.0.2.1"))
+		record, _ = store.Get("ip:192.0.2.1")
+		assert.IsNil(t, record)
+		assert.IsNil(t, store.Delete("ip:192.0.2.1"))
+	})
+
+	t.Run("DeleteBefore", func(t *testing.T) {
+		store := NewLocalStore()
+		now := time.Now()
+		store.AddFailure("old", now.Add(-2*time.Hour), now)
+		store.AddFailure("locked", now.Add(-2*time.Hour), now)
+		store.Lock("locked", now.Add(time.Minute))
+		store.AddFailure("recent", now, now)
+
+		count, err := store.DeleteBefore(now.Add(-time.Hour))
+		assert.IsNil(t, err)
+		assert.Equals(t, count, int64(1))
+		record, _ := store.Get("old")
+		assert.IsNil(t, record)
+		record, _ = store.Get("locked")
+		assert.IsNotNil(t, record)
+	})
+}
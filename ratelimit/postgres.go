@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Keeps records in the rate_limit table, so that attempts are limited across
+// every server instance connected to the same database
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db}
+}
+
+func (store *PostgresStore) Get(key string) (*Record, error) {
+	var record Record
+	err := store.db.QueryRow(
+		`SELECT failures, last_failure_at, locked_until FROM rate_limit WHERE key = $1`,
+		key,
+	).Scan(&record.Failures, &record.LastFailureAt, &record.LockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (store *PostgresStore) AddFailure(key string, now, resetBefore time.Time) (int64, error) {
+	var failures int64
+	err := store.db.QueryRow(
+		`INSERT INTO rate_limit (key, failures, last_failure_at, locked_until)
+		VALUES ($1, 1, $2, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN rate_limit.last_failure_at < $3 THEN 1
+				ELSE rate_limit.failures + 1
+			END,
+			last_failure_at = $2
+		RETURNING failures`,
+		key, now.UTC(), resetBefore.UTC(),
+	).Scan(&failures)
+	return failures, err
+}
+
+func (store *PostgresStore) Lock(key string, until time.Time) error {
+	_, err := store.db.Exec(
+		`UPDATE rate_limit SET locked_until = GREATEST(locked_until, $2) WHERE key = $1`,
+		key, until.UTC(),
+	)
+	return err
+}
+
+func (store *PostgresStore) Delete(key string) error {
+	_, err := store.db.Exec(`DELETE FROM rate_limit WHERE key = $1`, key)
+	return err
+}
+
+func (store *PostgresStore) DeleteBefore(before time.Time) (int64, error) {
+	result, err := store.db.Exec(
+		`DELETE FROM rate_limit WHERE last_failure_at < $1 AND locked_until < $1`,
+		before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
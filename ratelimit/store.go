@@ -0,0 +1,26 @@
+package ratelimit
+
+import "time"
+
+// The failed attempts counted against a key
+type Record struct {
+	Failures      int64
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Keeps the failed attempts of each key
+type Store interface {
+	// Returns nil if nothing is recorded against the key
+	Get(key string) (*Record, error)
+	// Counts a failure against the key and returns the number of failures,
+	// starting over if the previous one was before resetBefore
+	AddFailure(key string, now, resetBefore time.Time) (int64, error)
+	// Locks the key until the given time, unless it is already locked for longer
+	Lock(key string, until time.Time) error
+	// Deleting a key that does not exist is not an error
+	Delete(key string) error
+	// Deletes the records with no failure or lock since the given time,
+	// returns how many were deleted
+	DeleteBefore(before time.Time) (int64, error)
+}
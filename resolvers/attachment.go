@@ -0,0 +1,331 @@
+package resolvers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/raphael-p/beango/blobs"
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+// Attachments are kept in the blob store, either on the local filesystem or
+// in an S3 bucket depending on the config
+var blobStore blobs.Store
+
+func UseBlobStore(store blobs.Store) {
+	blobStore = store
+}
+
+const (
+	// Room left for the other parts of a multipart form, on top of the files
+	MULTIPART_OVERHEAD_BYTES int64 = 1 << 20
+	// Beyond this, the files of a multipart form are buffered on disk
+	MULTIPART_MEMORY_BYTES int64 = 1 << 20
+	MAX_FILENAME_LENGTH    int   = 255
+)
+
+type sendAttachmentsInput struct {
+	Content          string
+	ReplyToMessageID int64
+	ThreadID         int64
+	Files            []*multipart.FileHeader
+}
+
+// Parses a multipart form with one or more "file" parts, and optional
+// "content", "replyToMessageID" and "threadID" fields. The caller must
+// remove the form's temporary files once done with them.
+func getAttachmentsForm(w *response.Writer, r *http.Request) (*sendAttachmentsInput, *resolverutils.HTTPError) {
+	attachmentsConfig := config.Values.Attachments
+	maxFileSize := int64(attachmentsConfig.MaxFileSizeBytes)
+	maxFiles := int(attachmentsConfig.MaxFilesPerMessage)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize*int64(maxFiles)+MULTIPART_OVERHEAD_BYTES)
+	if err := r.ParseMultipartForm(MULTIPART_MEMORY_BYTES); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, &resolverutils.HTTPError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: "request body too large",
+			}
+		}
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "malformed multipart form: " + err.Error(),
+		}
+	}
+
+	input := &sendAttachmentsInput{
+		Content: r.FormValue("content"),
+		Files:   r.MultipartForm.File["file"],
+	}
+	for key, target := range map[string]*int64{
+		"replyToMessageID": &input.ReplyToMessageID,
+		"threadID":         &input.ThreadID,
+	} {
+		if value := r.FormValue(key); value != "" {
+			intValue, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, &resolverutils.HTTPError{
+					Status:  http.StatusBadRequest,
+					Message: fmt.Sprintf("form field '%s' must be an integer", key),
+				}
+			}
+			*target = intValue
+		}
+	}
+
+	if len(input.Files) == 0 {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "no file attached",
+		}
+	}
+	if len(input.Files) > maxFiles {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("cannot attach more than %d files to a message", maxFiles),
+		}
+	}
+	for _, file := range input.Files {
+		if file.Size > maxFileSize {
+			return nil, &resolverutils.HTTPError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("file '%s' is larger than %d bytes", file.Filename, maxFileSize),
+			}
+		}
+	}
+	return input, nil
+}
+
+// Keeps the name of an uploaded file short and printable, without any directory
+func sanitizeFilename(filename string) string {
+	filename = filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	filename = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename))
+	if filename == "" || filename == "." || filename == "/" {
+		return "attachment"
+	}
+	if runes := []rune(filename); len(runes) > MAX_FILENAME_LENGTH {
+		filename = string(runes[:MAX_FILENAME_LENGTH])
+	}
+	return filename
+}
+
+// The type of a file is detected from its content, rather than trusting the client
+func detectContentType(file multipart.File) (string, error) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(header[:n]))
+	return contentType, err
+}
+
+func storeAttachment(fileHeader *multipart.FileHeader) (*database.Attachment, *resolverutils.HTTPError) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		logger.Error("failed to open uploaded file: " + err.Error())
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to read attachment",
+		}
+	}
+	defer file.Close()
+
+	contentType, err := detectContentType(file)
+	if err != nil {
+		logger.Error("failed to detect type of uploaded file: " + err.Error())
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to read attachment",
+		}
+	}
+	if !slices.Contains(config.Values.Attachments.AllowedTypes, contentType) {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: "file type not allowed: " + contentType,
+		}
+	}
+
+	key := blobs.NewKey()
+	if err := blobStore.Put(key, file, fileHeader.Size, contentType); err != nil {
+		logger.Error("failed to store attachment: " + err.Error())
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to store attachment",
+		}
+	}
+	return &database.Attachment{
+		Filename:    sanitizeFilename(fileHeader.Filename),
+		ContentType: contentType,
+		Size:        fileHeader.Size,
+		BlobKey:     key,
+	}, nil
+}
+
+// Deletes the stored files of attachments, errors are only logged
+func deleteAttachmentBlobs(attachments []database.Attachment) {
+	for _, attachment := range attachments {
+		if err := blobStore.Delete(attachment.BlobKey); err != nil {
+			logger.Error(fmt.Sprintf("failed to delete attachment %s: %s", attachment.BlobKey, err))
+		}
+	}
+}
+
+// Stores the files, then sends a message with them attached. The stored
+// files are deleted if the message cannot be sent.
+func sendAttachmentsDatabase(userID, chatID int64, input *sendAttachmentsInput, conn database.Connection) (*database.MessageDatabase, *resolverutils.HTTPError) {
+	newMessage, httpError := makeMessage(
+		userID,
+		chatID,
+		input.Content,
+		input.ReplyToMessageID,
+		input.ThreadID,
+		conn,
+	)
+	if httpError != nil {
+		return nil, httpError
+	}
+
+	attachments := make([]database.Attachment, 0, len(input.Files))
+	deleteBlobs := func() { deleteAttachmentBlobs(attachments) }
+	for _, fileHeader := range input.Files {
+		attachment, httpError := storeAttachment(fileHeader)
+		if httpError != nil {
+			deleteBlobs()
+			return nil, httpError
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	newMessage, err := conn.SetMessageWithAttachments(newMessage, attachments)
+	if err != nil {
+		deleteBlobs()
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return newMessage, nil
+}
+
+func SendAttachments(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	input, httpError := getAttachmentsForm(w, r)
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	newMessage, httpError := sendAttachmentsDatabase(user.ID, params.ChatID, input, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	sendNewMessageEvents(newMessage, conn)
+
+	// fetched again to include the attachments
+	message, err := conn.GetMessage(newMessage.ID)
+	if resolverutils.ProcessHTTPError(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+	w.WriteJSON(http.StatusCreated, message)
+}
+
+// Fetches an attachment of a message that has not been deleted, from a chat
+// that the user is a member of
+func attachmentDatabase(userID, chatID, attachmentID int64, conn database.Connection) (*database.Attachment, *resolverutils.HTTPError) {
+	if chat, _ := conn.GetChat(chatID, userID); chat == nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "chat not found",
+		}
+	}
+
+	attachment, err := conn.GetAttachment(attachmentID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	var message *database.Message
+	if attachment != nil {
+		message, err = conn.GetMessage(attachment.MessageID)
+		if err != nil {
+			return nil, resolverutils.HandleDatabaseError(err)
+		}
+	}
+	if message == nil || message.ChatID != chatID || message.DeletedAt != nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "attachment not found",
+		}
+	}
+	return attachment, nil
+}
+
+// Downloads an attachment, images are shown inline by the browser
+func GetAttachment(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.ATTACHMENT_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	attachment, httpError := attachmentDatabase(user.ID, params.ChatID, params.AttachmentID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	content, err := blobStore.Get(attachment.BlobKey)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to fetch attachment %d: %s", attachment.ID, err))
+		w.WriteString(http.StatusInternalServerError, "failed to fetch attachment")
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	if attachment.IsImage() {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(attachment.Size))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(
+		disposition,
+		map[string]string{"filename": attachment.Filename},
+	))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400") // attachments never change
+	w.HideResponse = true
+	w.WriteHeader(http.StatusOK)
+	// written to the underlying writer, which does not keep a copy of the body
+	if _, err := io.Copy(w.ResponseWriter, content); err != nil {
+		logger.Error(fmt.Sprintf("failed to send attachment %d: %s", attachment.ID, err))
+	}
+}
@@ -0,0 +1,303 @@
+package resolvers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/raphael-p/beango/blobs"
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+const testPNG = "\x89PNG\r\n\x1a\n" + "not really an image"
+
+// Uses a blob store in a temporary directory, which is returned
+func setupAttachmentTests(t *testing.T) string {
+	config.CreateConfig()
+	directory := t.TempDir()
+	store, err := blobs.NewLocalStore(directory)
+	assert.IsNil(t, err)
+	UseBlobStore(store)
+	return directory
+}
+
+// Makes a request with a multipart form, files map their name to their content
+func makeAttachmentsRequest(t *testing.T, chatID int64, fields, files map[string]string) (*response.Writer, *http.Request) {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	for key, value := range fields {
+		form.WriteField(key, value)
+	}
+	for filename, content := range files {
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte(content))
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/test", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chatID)}
+	req = resolverutils.SetContext(t, req, mocks.Admin, params)
+	return response.NewWriter(httptest.NewRecorder()), req
+}
+
+func countBlobs(directory string) int {
+	entries, _ := os.ReadDir(directory)
+	return len(entries)
+}
+
+// Fails to save messages with attachments, as if the database had gone away
+type failingAttachmentsConnection struct {
+	database.Connection
+}
+
+func (conn failingAttachmentsConnection) SetMessageWithAttachments(*database.MessageDatabase, []database.Attachment) (*database.MessageDatabase, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	testCases := map[string]string{
+		"beans.png":             "beans.png",
+		"../../etc/passwd":      "passwd",
+		`C:\Users\me\beans.png`: "beans.png",
+		" be\x00ans\n.txt ":     "beans.txt",
+		"":                      "attachment",
+		"/":                     "attachment",
+	}
+	for filename, expected := range testCases {
+		assert.Equals(t, sanitizeFilename(filename), expected)
+	}
+	long := bytes.Repeat([]byte("é"), 300)
+	assert.HasLength(t, []rune(sanitizeFilename(string(long))), MAX_FILENAME_LENGTH)
+}
+
+func TestSendAttachments(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		directory := setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(
+			t,
+			chatID,
+			map[string]string{"content": "look at this"},
+			map[string]string{"beans.png": testPNG, "notes.txt": "beans"},
+		)
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, chatID}, 1)
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusCreated)
+		var output database.Message
+		json.Unmarshal(w.Body, &output)
+		assert.Equals(t, output.Content, "look at this")
+		assert.HasLength(t, output.Attachments, 2)
+		assert.Equals(t, countBlobs(directory), 2)
+		receiveEvent(t, client)
+
+		message, _ := conn.GetMessage(output.ID)
+		assert.HasLength(t, message.Attachments, 2)
+		types := map[string]string{}
+		for _, attachment := range message.Attachments {
+			types[attachment.Filename] = attachment.ContentType
+		}
+		assert.DeepEquals(t, types, map[string]string{
+			"beans.png": "image/png",
+			"notes.txt": "text/plain",
+		})
+	})
+
+	t.Run("TypeNotAllowed", func(t *testing.T) {
+		directory := setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(t, chatID, nil, map[string]string{
+			"beans.png":      testPNG,
+			"beans.png.html": "<html><script>alert('beans')</script></html>",
+		})
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusUnsupportedMediaType)
+		assert.Contains(t, string(w.Body), "file type not allowed: text/html")
+		assert.Equals(t, countBlobs(directory), 0)
+		messages, _ := conn.GetMessagesByChatID(chatID, 0, 0, 0)
+		assert.HasLength(t, messages, 0)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		setupAttachmentTests(t)
+		config.Values.Attachments.MaxFileSizeBytes = 10
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(t, chatID, nil, map[string]string{"beans.png": testPNG})
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusRequestEntityTooLarge)
+		assert.Equals(t, string(w.Body), "file 'beans.png' is larger than 10 bytes")
+	})
+
+	t.Run("TooManyFiles", func(t *testing.T) {
+		setupAttachmentTests(t)
+		config.Values.Attachments.MaxFilesPerMessage = 1
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(t, chatID, nil, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "cannot attach more than 1 files to a message")
+	})
+
+	t.Run("NoFile", func(t *testing.T) {
+		setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(t, chatID, map[string]string{"content": "beans"}, nil)
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "no file attached")
+	})
+
+	t.Run("InvalidField", func(t *testing.T) {
+		setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(
+			t,
+			chatID,
+			map[string]string{"threadID": "raisin"},
+			map[string]string{"a.txt": "a"},
+		)
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "form field 'threadID' must be an integer")
+	})
+
+	t.Run("InvalidReply", func(t *testing.T) {
+		directory := setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(
+			t,
+			chatID,
+			map[string]string{"replyToMessageID": "99"},
+			map[string]string{"a.txt": "a"},
+		)
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "message to reply to not found")
+		assert.Equals(t, countBlobs(directory), 0)
+	})
+
+	t.Run("DatabaseError", func(t *testing.T) {
+		directory := setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeAttachmentsRequest(t, chatID, nil, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+		SendAttachments(w, req, failingAttachmentsConnection{conn})
+		assert.Equals(t, w.Status, http.StatusInternalServerError)
+		assert.Equals(t, countBlobs(directory), 0)
+		messages, _ := conn.GetMessagesByChatID(chatID, 0, 0, 0)
+		assert.HasLength(t, messages, 0)
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		directory := setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(11, 12)
+		w, req := makeAttachmentsRequest(t, chatID, nil, map[string]string{"a.txt": "a"})
+
+		SendAttachments(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "chat not found")
+		assert.Equals(t, countBlobs(directory), 0)
+	})
+}
+
+func TestGetAttachment(t *testing.T) {
+	setup := func(t *testing.T, filename, content, contentType string, userIDs ...int64) (database.Connection, int64, *database.Attachment) {
+		setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(userIDs[0], userIDs[1])
+		message, _ := conn.SetMessage(mocks.MakeMessage(userIDs[1], chatID))
+		key := blobs.NewKey()
+		blobStore.Put(key, bytes.NewBufferString(content), int64(len(content)), contentType)
+		attachment, _ := conn.SetAttachment(&database.Attachment{
+			MessageID:   message.ID,
+			Filename:    filename,
+			ContentType: contentType,
+			Size:        int64(len(content)),
+			BlobKey:     key,
+		})
+		return conn, chatID, attachment
+	}
+	makeRequest := func(t *testing.T, chatID, attachmentID int64) (*response.Writer, *http.Request) {
+		w, req, _ := resolverutils.CommonSetup("")
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:       fmt.Sprint(chatID),
+			resolverutils.ATTACHMENT_ID_KEY: fmt.Sprint(attachmentID),
+		}
+		req = resolverutils.SetContext(t, req, mocks.Admin, params)
+		return w, req
+	}
+
+	t.Run("Image", func(t *testing.T) {
+		conn, chatID, attachment := setup(t, "beans.png", testPNG, "image/png", mocks.ADMIN_ID, 12)
+		recorder := httptest.NewRecorder()
+		w, req := makeRequest(t, chatID, attachment.ID)
+		w.ResponseWriter = recorder
+
+		GetAttachment(w, req, conn)
+		assert.Equals(t, recorder.Code, http.StatusOK)
+		assert.Equals(t, recorder.Body.String(), testPNG)
+		assert.Equals(t, recorder.Header().Get("Content-Type"), "image/png")
+		assert.Equals(t, recorder.Header().Get("Content-Disposition"), `inline; filename=beans.png`)
+		assert.Equals(t, recorder.Header().Get("X-Content-Type-Options"), "nosniff")
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		conn, chatID, attachment := setup(t, "my notes.txt", "beans", "text/plain", mocks.ADMIN_ID, 12)
+		recorder := httptest.NewRecorder()
+		w, req := makeRequest(t, chatID, attachment.ID)
+		w.ResponseWriter = recorder
+
+		GetAttachment(w, req, conn)
+		assert.Equals(t, recorder.Code, http.StatusOK)
+		assert.Equals(t, recorder.Body.String(), "beans")
+		assert.Equals(t, recorder.Header().Get("Content-Disposition"), `attachment; filename="my notes.txt"`)
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn, chatID, attachment := setup(t, "beans.png", testPNG, "image/png", 11, 12)
+		w, req := makeRequest(t, chatID, attachment.ID)
+
+		GetAttachment(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "chat not found")
+	})
+
+	t.Run("OtherChat", func(t *testing.T) {
+		conn, _, attachment := setup(t, "beans.png", testPNG, "image/png", 11, 12)
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), mocks.ADMIN_ID, 12)
+		w, req := makeRequest(t, chat.ID, attachment.ID)
+
+		GetAttachment(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "attachment not found")
+	})
+
+	t.Run("DeletedMessage", func(t *testing.T) {
+		conn, chatID, attachment := setup(t, "beans.png", testPNG, "image/png", mocks.ADMIN_ID, 12)
+		conn.DeleteMessage(attachment.MessageID)
+		w, req := makeRequest(t, chatID, attachment.ID)
+
+		GetAttachment(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "attachment not found")
+		message, _ := conn.GetMessage(attachment.MessageID)
+		assert.HasLength(t, message.Attachments, 0)
+	})
+}
@@ -1,6 +1,7 @@
 package resolvers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
@@ -9,13 +10,17 @@ import (
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/utils/response"
+	"github.com/raphael-p/beango/utils/validate"
 )
 
 type getChatsOutput struct {
 	database.Chat
-	Users []userOutput `json:"users"`
+	Users       []userOutput `json:"users"`
+	UnreadCount int64        `json:"unreadCount"`
 }
 
+const NOTE_CHAT_NAME string = "Notes to self"
+
 func generateChatName(userID int64, users []database.User) string {
 	var displayNames []string
 	for _, user := range users {
@@ -23,6 +28,9 @@ func generateChatName(userID int64, users []database.User) string {
 			displayNames = append(displayNames, user.DisplayName)
 		}
 	}
+	if len(displayNames) == 0 {
+		return NOTE_CHAT_NAME
+	}
 	sort.Strings(displayNames)
 
 	return strings.Join(displayNames, ", ")
@@ -34,6 +42,15 @@ func getChatsDatabase(userID int64, conn database.Connection) ([]getChatsOutput,
 		return nil, resolverutils.HandleDatabaseError(err)
 	}
 
+	unreadCounts, err := conn.GetUnreadCounts(userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	unreadCountByChatID := make(map[int64]int64, len(unreadCounts))
+	for _, unreadCount := range unreadCounts {
+		unreadCountByChatID[unreadCount.ChatID] = unreadCount.Count
+	}
+
 	chatOutput := make([]getChatsOutput, len(chats))
 	for i, chat := range chats {
 		users, err := conn.GetUsersByChatID(chat.ID)
@@ -44,7 +61,7 @@ func getChatsDatabase(userID int64, conn database.Connection) ([]getChatsOutput,
 		if chat.Name == "" {
 			chat.Name = generateChatName(userID, users)
 		}
-		chatOutput[i] = getChatsOutput{chat, stripUserFields(users...)}
+		chatOutput[i] = getChatsOutput{chat, stripUserFields(users...), unreadCountByChatID[chat.ID]}
 	}
 	return chatOutput, nil
 }
@@ -116,5 +133,278 @@ func CreatePrivateChat(w *response.Writer, r *http.Request, conn database.Connec
 	if resolverutils.ProcessHTTPError(w, httpError) {
 		return
 	}
+	SendChatMembersEvent(newChat.ID, NEW_CHAT_EVENT, conn)
+	w.WriteJSON(http.StatusCreated, newChat)
+}
+
+type createGroupChatInput struct {
+	Name    string  `json:"name"`
+	UserIDs []int64 `json:"userIDs"`
+}
+
+func validateCreateGroupChatInput(input *createGroupChatInput, sessionUserID int64) *resolverutils.HTTPError {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "chat name cannot be empty",
+		}
+	}
+	if len([]rune(input.Name)) > 25 {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "chat name must be shorter than 26 characters",
+		}
+	}
+	if strings.ContainsAny(input.Name, "\t\n\r") {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "chat name may not contain any tabs or newlines",
+		}
+	}
+
+	input.UserIDs = otherUserIDs(input.UserIDs, sessionUserID)
+	if len(input.UserIDs) == 0 {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "a group chat needs at least one other user",
+		}
+	}
+	return nil
+}
+
+// Removes duplicates and the session user from a list of user IDs
+func otherUserIDs(userIDs []int64, sessionUserID int64) []int64 {
+	seen := map[int64]bool{sessionUserID: true}
+	output := []int64{}
+	for _, userID := range userIDs {
+		if !seen[userID] {
+			seen[userID] = true
+			output = append(output, userID)
+		}
+	}
+	return output
+}
+
+func checkUsersExist(userIDs []int64, conn database.Connection) *resolverutils.HTTPError {
+	for _, userID := range userIDs {
+		user, err := conn.GetUser(userID)
+		if err != nil {
+			return resolverutils.HandleDatabaseError(err)
+		}
+		if user == nil {
+			return &resolverutils.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("userID %d is invalid", userID),
+			}
+		}
+	}
+	return nil
+}
+
+func createGroupChatDatabase(sessionUserID int64, name string, userIDs []int64, conn database.Connection) (*database.Chat, *resolverutils.HTTPError) {
+	if httpError := checkUsersExist(userIDs, conn); httpError != nil {
+		return nil, httpError
+	}
+
+	newChat := &database.Chat{Type: database.GROUP_CHAT, Name: name}
+	newChat, err := conn.SetChat(newChat, append([]int64{sessionUserID}, userIDs...)...)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return newChat, nil
+}
+
+func CreateGroupChat(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input createGroupChatInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) ||
+		resolverutils.ProcessHTTPError(w, validateCreateGroupChatInput(&input, user.ID)) {
+		return
+	}
+
+	newChat, httpError := createGroupChatDatabase(user.ID, input.Name, input.UserIDs, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	SendChatMembersEvent(newChat.ID, NEW_CHAT_EVENT, conn)
 	w.WriteJSON(http.StatusCreated, newChat)
 }
+
+// Fetches a chat that the session user is a member of, and checks that it is a group chat
+func getGroupChat(sessionUserID, chatID int64, conn database.Connection) (*database.Chat, *resolverutils.HTTPError) {
+	chat, err := conn.GetChat(chatID, sessionUserID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if chat == nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "chat not found",
+		}
+	}
+	if chat.Type != database.GROUP_CHAT {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "members can only be changed in a group chat",
+		}
+	}
+	return chat, nil
+}
+
+type addChatUsersInput struct {
+	UserIDs []int64 `json:"userIDs"`
+}
+
+func addChatUsersDatabase(sessionUserID, chatID int64, userIDs []int64, conn database.Connection) *resolverutils.HTTPError {
+	if _, httpError := getGroupChat(sessionUserID, chatID, conn); httpError != nil {
+		return httpError
+	}
+
+	userIDs = otherUserIDs(userIDs, sessionUserID)
+	if httpError := checkUsersExist(userIDs, conn); httpError != nil {
+		return httpError
+	}
+
+	err := conn.AddChatUsers(chatID, userIDs...)
+	return resolverutils.HandleDatabaseError(err)
+}
+
+func AddChatUsers(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input addChatUsersInput
+	user, params, httpError := resolverutils.GetRequestBodyAndContext(r, &input, resolverutils.CHAT_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = addChatUsersDatabase(user.ID, params.ChatID, input.UserIDs, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	SendChatMembersEvent(params.ChatID, NEW_CHAT_EVENT, conn)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Any member can leave a group chat, but only its owner can remove the others.
+// The chat is deleted once its last member has left.
+func removeChatUserDatabase(sessionUserID, chatID, userID int64, conn database.Connection) *resolverutils.HTTPError {
+	if _, httpError := getGroupChat(sessionUserID, chatID, conn); httpError != nil {
+		return httpError
+	}
+
+	if userID != sessionUserID {
+		ownerID, err := conn.GetChatOwnerID(chatID)
+		if err != nil {
+			return resolverutils.HandleDatabaseError(err)
+		}
+		if ownerID != sessionUserID {
+			return &resolverutils.HTTPError{
+				Status:  http.StatusForbidden,
+				Message: "only the owner of the chat can remove its members",
+			}
+		}
+
+		chat, err := conn.GetChat(chatID, userID)
+		if err != nil {
+			return resolverutils.HandleDatabaseError(err)
+		}
+		if chat == nil {
+			return &resolverutils.HTTPError{
+				Status:  http.StatusNotFound,
+				Message: "user is not a member of this chat",
+			}
+		}
+	}
+
+	deletedAttachments, err := conn.RemoveChatUser(chatID, userID)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	deleteAttachmentBlobs(deletedAttachments)
+
+	// sent while the user's clients still listen to the chat's stream
+	SendChatEvent(chatID, leaveChatEvent(userID), "")
+	data, _ := json.Marshal(chatMemberEventData{chatID, userID})
+	SendUserEvent(userID, LEAVE_CHAT_EVENT, string(data))
+	sendMembersEvent(chatID, LEAVE_CHAT_EVENT, string(data), conn)
+	return nil
+}
+
+func RemoveChatUser(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.USER_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = removeChatUserDatabase(user.ID, params.ChatID, params.UserID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func LeaveChat(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = removeChatUserDatabase(user.ID, params.ChatID, user.ID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Moves the user's read marker. If it moved, their chat lists are refreshed
+// and a read receipt is sent to the chat.
+func markChatRead(userID, chatID, messageID int64, conn database.Connection) *resolverutils.HTTPError {
+	lastReadMessageID, err := conn.MarkChatRead(chatID, userID, messageID)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if lastReadMessageID != 0 {
+		data, _ := json.Marshal(chatEventData{chatID})
+		SendUserEvent(userID, READ_CHAT_EVENT, string(data))
+		data, _ = json.Marshal(readReceiptEventData{chatID, userID, lastReadMessageID})
+		SendChatEvent(chatID, READ_RECEIPT_EVENT, string(data))
+	}
+	return nil
+}
+
+type markChatReadInput struct {
+	MessageID validate.JSONField[int64] `json:"messageID" optional:"true"`
+}
+
+func markChatReadDatabase(userID, chatID, messageID int64, conn database.Connection) *resolverutils.HTTPError {
+	if messageID == 0 {
+		if chat, _ := conn.GetChat(chatID, userID); chat == nil {
+			return &resolverutils.HTTPError{
+				Status:  http.StatusNotFound,
+				Message: "chat not found",
+			}
+		}
+	} else if _, httpError := getChatMessage(userID, chatID, messageID, conn); httpError != nil {
+		return httpError
+	}
+	return markChatRead(userID, chatID, messageID, conn)
+}
+
+// Marks the chat as read up to the given message, or up to its latest message
+func MarkChatRead(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input markChatReadInput
+	user, params, httpError := resolverutils.GetRequestBodyAndContext(r, &input, resolverutils.CHAT_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = markChatReadDatabase(user.ID, params.ChatID, input.MessageID.Value, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -46,13 +46,13 @@ func TestGenerateChatName(t *testing.T) {
 			{ID: 5, DisplayName: "GEORGE"},
 		}
 		chatName := generateChatName(5, users)
-		assert.Equals(t, chatName, "")
+		assert.Equals(t, chatName, NOTE_CHAT_NAME)
 	})
 
 	t.Run("EmptyUserSlice", func(t *testing.T) {
 		users := []database.User{}
 		chatName := generateChatName(5, users)
-		assert.Equals(t, chatName, "")
+		assert.Equals(t, chatName, NOTE_CHAT_NAME)
 	})
 
 	t.Run("UserNotInSlice", func(t *testing.T) {
@@ -104,6 +104,32 @@ func TestGetChatsDatabase(t *testing.T) {
 	}
 }
 
+func TestGetChatsDatabaseNoteChat(t *testing.T) {
+	conn := mocks.MakeMockConnection()
+	conn.SetChat(&database.Chat{Type: database.NOTE}, mocks.ADMIN_ID)
+
+	chats, httpError := getChatsDatabase(mocks.ADMIN_ID, conn)
+	assert.IsNil(t, httpError)
+	assert.HasLength(t, chats, 1)
+	assert.Equals(t, chats[0].Name, NOTE_CHAT_NAME)
+}
+
+func TestGetChatsDatabaseUnreadCount(t *testing.T) {
+	conn := mocks.MakeMockConnection()
+	user, _ := conn.SetUser(mocks.MakeUser())
+	chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+	readMessage, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+	conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+	conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+	conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chat.ID)) // own messages are not counted
+	conn.MarkChatRead(chat.ID, mocks.ADMIN_ID, readMessage.ID)
+
+	chats, httpError := getChatsDatabase(mocks.ADMIN_ID, conn)
+	assert.IsNil(t, httpError)
+	assert.HasLength(t, chats, 1)
+	assert.Equals(t, chats[0].UnreadCount, 2)
+}
+
 func TestGetChats(t *testing.T) {
 	adminID := mocks.ADMIN_ID
 
@@ -186,3 +212,290 @@ func TestCreatePrivateChat(t *testing.T) {
 		assert.IsValidJSON(t, string(w.Body), &database.Chat{})
 	})
 }
+
+func TestValidateCreateGroupChatInput(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		input := createGroupChatInput{" The Group ", []int64{12, 1234, 13, 12}}
+
+		httpError := validateCreateGroupChatInput(&input, 1234)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, input.Name, "The Group")
+		assert.DeepEquals(t, input.UserIDs, []int64{12, 13})
+	})
+
+	t.Run("EmptyName", func(t *testing.T) {
+		input := createGroupChatInput{" ", []int64{12}}
+
+		httpError := validateCreateGroupChatInput(&input, 1234)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "chat name cannot be empty")
+	})
+
+	t.Run("NameTooLong", func(t *testing.T) {
+		input := createGroupChatInput{"abcdefghijklmnopqrstuvwxyz", []int64{12}}
+
+		httpError := validateCreateGroupChatInput(&input, 1234)
+		xMessage := "chat name must be shorter than 26 characters"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("NoOtherUsers", func(t *testing.T) {
+		input := createGroupChatInput{"The Group", []int64{1234}}
+
+		httpError := validateCreateGroupChatInput(&input, 1234)
+		xMessage := "a group chat needs at least one other user"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+}
+
+func TestCreateGroupChatDatabase(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user1, _ := conn.SetUser(mocks.MakeUser())
+		user2, _ := conn.SetUser(mocks.MakeUser2())
+
+		chat, httpError := createGroupChatDatabase(mocks.ADMIN_ID, "The Group", []int64{user1.ID, user2.ID}, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, chat.Name, "The Group")
+		assert.Equals(t, chat.Type, database.GROUP_CHAT)
+		users, _ := conn.GetUsersByChatID(chat.ID)
+		assert.HasLength(t, users, 3)
+	})
+
+	t.Run("UserDoesNotExist", func(t *testing.T) {
+		var fakeUserID int64 = 451
+		conn := mocks.MakeMockConnection()
+
+		chat, httpError := createGroupChatDatabase(mocks.ADMIN_ID, "The Group", []int64{fakeUserID}, conn)
+		assert.IsNil(t, chat)
+		xMessage := fmt.Sprintf("userID %d is invalid", fakeUserID)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+}
+
+func TestCreateGroupChat(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		body := fmt.Sprintf(`{"name": "The Group", "userIDs": [%d]}`, user.ID)
+		w, r, _ := resolverutils.CommonSetup(body)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		CreateGroupChat(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusCreated)
+		chat := &database.Chat{}
+		err := json.Unmarshal(w.Body, chat)
+		assert.IsNil(t, err)
+		assert.Equals(t, chat.Type, database.GROUP_CHAT)
+	})
+}
+
+func TestAddChatUsersDatabase(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user1, _ := conn.SetUser(mocks.MakeUser())
+		user2, _ := conn.SetUser(mocks.MakeUser2())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, user1.ID)
+
+		httpError := addChatUsersDatabase(mocks.ADMIN_ID, chat.ID, []int64{user1.ID, user2.ID}, conn)
+		assert.IsNil(t, httpError)
+		users, _ := conn.GetUsersByChatID(chat.ID)
+		assert.HasLength(t, users, 3)
+	})
+
+	t.Run("NotGroupChat", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user1, _ := conn.SetUser(mocks.MakeUser())
+		user2, _ := conn.SetUser(mocks.MakeUser2())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), mocks.ADMIN_ID, user1.ID)
+
+		httpError := addChatUsersDatabase(mocks.ADMIN_ID, chat.ID, []int64{user2.ID}, conn)
+		xMessage := "members can only be changed in a group chat"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), 11, 12)
+
+		httpError := addChatUsersDatabase(mocks.ADMIN_ID, chat.ID, []int64{mocks.ADMIN_ID}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+func TestRemoveChatUserDatabase(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, user.ID)
+
+		httpError := removeChatUserDatabase(mocks.ADMIN_ID, chat.ID, user.ID, conn)
+		assert.IsNil(t, httpError)
+		users, _ := conn.GetUsersByChatID(chat.ID)
+		assert.HasLength(t, users, 1)
+	})
+
+	t.Run("UserNotInChat", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, 12)
+
+		httpError := removeChatUserDatabase(mocks.ADMIN_ID, chat.ID, user.ID, conn)
+		xMessage := "user is not a member of this chat"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, xMessage)
+	})
+
+	t.Run("NotOwner", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), user.ID, mocks.ADMIN_ID, 12)
+
+		httpError := removeChatUserDatabase(mocks.ADMIN_ID, chat.ID, 12, conn)
+		xMessage := "only the owner of the chat can remove its members"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, xMessage)
+		users, _ := conn.GetUsersByChatID(chat.ID)
+		assert.HasLength(t, users, 2)
+	})
+
+	t.Run("OwnershipPassesOn", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		otherUser, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), user.ID, mocks.ADMIN_ID, otherUser.ID)
+
+		httpError := removeChatUserDatabase(user.ID, chat.ID, user.ID, conn)
+		assert.IsNil(t, httpError)
+		httpError = removeChatUserDatabase(mocks.ADMIN_ID, chat.ID, otherUser.ID, conn)
+		assert.IsNil(t, httpError)
+		users, _ := conn.GetUsersByChatID(chat.ID)
+		assert.HasLength(t, users, 1)
+	})
+
+	t.Run("SendsEvents", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, user.ID)
+		adminClient := registerTestClient(t, hub, streamKey{USER_STREAM, mocks.ADMIN_ID}, 1)
+		userClient := registerTestClient(t, hub, streamKey{USER_STREAM, user.ID}, 1)
+
+		httpError := removeChatUserDatabase(mocks.ADMIN_ID, chat.ID, user.ID, conn)
+		assert.IsNil(t, httpError)
+		xData := fmt.Sprintf(`{"chatID":%d,"userID":%d}`, chat.ID, user.ID)
+		for _, client := range []*sseClient{adminClient, userClient} {
+			event, _ := receiveEvent(t, client)
+			assert.Equals(t, event.event, LEAVE_CHAT_EVENT)
+			assert.Equals(t, event.data, xData)
+		}
+	})
+
+	t.Run("LastMemberDeletesChat", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chat.ID))
+
+		httpError := removeChatUserDatabase(mocks.ADMIN_ID, chat.ID, mocks.ADMIN_ID, conn)
+		assert.IsNil(t, httpError)
+		deletedMessage, _ := conn.GetMessage(message.ID)
+		assert.IsNil(t, deletedMessage)
+		ownerID, _ := conn.GetChatOwnerID(chat.ID)
+		assert.Equals(t, ownerID, 0)
+	})
+}
+
+func TestLeaveChat(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, 12)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		LeaveChat(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		chat, _ = conn.GetChat(chat.ID, mocks.ADMIN_ID)
+		assert.IsNil(t, chat)
+	})
+}
+
+func TestMarkChatReadDatabase(t *testing.T) {
+	t.Run("LatestMessage", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+
+		httpError := markChatReadDatabase(mocks.ADMIN_ID, chat.ID, 0, conn)
+		assert.IsNil(t, httpError)
+		counts, _ := conn.GetUnreadCounts(mocks.ADMIN_ID)
+		assert.DeepEquals(t, counts, []database.UnreadCount{{ChatID: chat.ID, Count: 0}})
+	})
+
+	t.Run("GivenMessage", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+
+		httpError := markChatReadDatabase(mocks.ADMIN_ID, chat.ID, message.ID, conn)
+		assert.IsNil(t, httpError)
+		counts, _ := conn.GetUnreadCounts(mocks.ADMIN_ID)
+		assert.DeepEquals(t, counts, []database.UnreadCount{{ChatID: chat.ID, Count: 1}})
+	})
+
+	t.Run("MessageNotInChat", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		otherChat, _ := conn.SetChat(mocks.MakeGroupChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, otherChat.ID))
+
+		httpError := markChatReadDatabase(mocks.ADMIN_ID, chat.ID, message.ID, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "message not found")
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 11, 12)
+
+		httpError := markChatReadDatabase(mocks.ADMIN_ID, chat.ID, 0, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+func TestMarkChatRead(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("{}")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		userClient := registerTestClient(t, hub, streamKey{USER_STREAM, mocks.ADMIN_ID}, 1)
+		chatClient := registerTestClient(t, hub, streamKey{CHAT_STREAM, chat.ID}, 1)
+
+		MarkChatRead(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		event, _ := receiveEvent(t, userClient)
+		assert.Equals(t, event.event, READ_CHAT_EVENT)
+		assert.Equals(t, event.data, fmt.Sprintf(`{"chatID":%d}`, chat.ID))
+		event, _ = receiveEvent(t, chatClient)
+		assert.Equals(t, event.event, READ_RECEIPT_EVENT)
+		xData := fmt.Sprintf(`{"chatID":%d,"userID":%d,"messageID":%d}`, chat.ID, mocks.ADMIN_ID, message.ID)
+		assert.Equals(t, event.data, xData)
+	})
+
+	t.Run("AlreadyRead", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("{}")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		conn.MarkChatRead(chat.ID, mocks.ADMIN_ID, 0)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, chat.ID}, 1)
+
+		MarkChatRead(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		assert.Equals(t, len(client.events), 0)
+	})
+}
@@ -0,0 +1,172 @@
+package resolvers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raphael-p/beango/client"
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/mailer"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+const (
+	VERIFY_EMAIL_PURPOSE string = "verify-email"
+	VERIFY_EMAIL_SECONDS int    = 24 * 60 * 60
+)
+
+var emailSender mailer.Mailer
+
+func init() {
+	UseMailer(mailer.NewLogMailer())
+}
+
+func UseMailer(m mailer.Mailer) {
+	emailSender = m
+}
+
+func sendEmail(message mailer.Message) *resolverutils.HTTPError {
+	if err := emailSender.Send(message); err != nil {
+		logger.Error("failed to send email: " + err.Error())
+		return &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to send email",
+		}
+	}
+	return nil
+}
+
+// Makes an absolute link to a page of the server, for emails
+func makeEmailLink(path, token string) string {
+	baseURL := strings.TrimSuffix(config.Values.Mail.BaseURL, "/")
+	return baseURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+type emailInput struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type deleteEmailInput struct {
+	CurrentPassword string `json:"currentPassword"`
+}
+
+func validateEmailInput(input *emailInput) *resolverutils.HTTPError {
+	input.Email = strings.TrimSpace(input.Email)
+	if !mailer.ValidAddress(input.Email) {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "email address is invalid",
+		}
+	}
+	return nil
+}
+
+// Sets the email address of a user, and sends them a link to verify it. It can
+// be used to reset the password, so the current password is needed to set it.
+func setEmailDatabase(r *http.Request, user *database.User, input *emailInput, conn database.Connection) *resolverutils.HTTPError {
+	if httpError := checkCurrentPassword(r, user.ID, input.CurrentPassword, conn); httpError != nil {
+		return httpError
+	}
+
+	email := input.Email
+	if err := conn.SetUserEmail(user.ID, &email); err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+
+	expiryDate := time.Now().Add(time.Duration(VERIFY_EMAIL_SECONDS) * time.Second)
+	token := authenticate.NewSignedToken(VERIFY_EMAIL_PURPOSE, expiryDate, strconv.FormatInt(user.ID, 10), email)
+	return sendEmail(mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\n"+
+				"To use this email address for your Beango account, follow this link within a day:\n\n"+
+				"%s\n\n"+
+				"If you did not ask for this, you can ignore this email.\n",
+			user.DisplayName,
+			makeEmailLink("/email/verify", token),
+		),
+	})
+}
+
+func SetEmail(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input emailInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	if resolverutils.ProcessHTTPError(w, validateEmailInput(&input)) {
+		return
+	}
+
+	if resolverutils.ProcessHTTPError(w, setEmailDatabase(r, user, &input, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteEmailDatabase(r *http.Request, userID int64, input *deleteEmailInput, conn database.Connection) *resolverutils.HTTPError {
+	if httpError := checkCurrentPassword(r, userID, input.CurrentPassword, conn); httpError != nil {
+		return httpError
+	}
+	return resolverutils.HandleDatabaseError(conn.SetUserEmail(userID, nil))
+}
+
+func DeleteEmail(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input deleteEmailInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	if resolverutils.ProcessHTTPError(w, deleteEmailDatabase(r, user.ID, &input, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func verifyEmailDatabase(token string, conn database.Connection) *resolverutils.HTTPError {
+	invalid := &resolverutils.HTTPError{
+		Status:  http.StatusBadRequest,
+		Message: "this link is invalid or has expired",
+	}
+	fields, err := authenticate.ParseSignedToken(VERIFY_EMAIL_PURPOSE, token, time.Now())
+	if err != nil || len(fields) != 2 {
+		return invalid
+	}
+	userID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return invalid
+	}
+
+	verified, err := conn.VerifyUserEmail(userID, fields[1])
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if !verified { // the address was changed since the link was sent
+		return invalid
+	}
+	return nil
+}
+
+// Opened from the link in the email, so it serves a page rather than JSON
+func VerifyEmail(w *response.Writer, r *http.Request, conn database.Connection) {
+	token, _ := resolverutils.GetRequestQueryParam(r, "token", false)
+	message := "Your email address has been verified."
+	if httpError := verifyEmailDatabase(token, conn); httpError != nil {
+		w.WriteHeader(httpError.Status)
+		message = strings.ToUpper(httpError.Message[:1]) + httpError.Message[1:] + "."
+	}
+
+	data := map[string]any{"Message": message}
+	client.ServeTemplate(w, "emailVerifiedPage", client.Skeleton+client.EmailVerifiedPage, data)
+}
@@ -0,0 +1,197 @@
+package resolvers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+)
+
+// Replaces the mailer with one that keeps the emails, for the length of the test
+func useMockMailer(t *testing.T) *mocks.Mailer {
+	mockMailer := &mocks.Mailer{}
+	previous := emailSender
+	UseMailer(mockMailer)
+	t.Cleanup(func() { UseMailer(previous) })
+	return mockMailer
+}
+
+// Finds the token of the link in an email
+func linkToken(t *testing.T, body string) string {
+	match := regexp.MustCompile(`\?token=(\S+)`).FindStringSubmatch(body)
+	assert.Equals(t, len(match), 2)
+	token, err := url.QueryUnescape(match[1])
+	assert.IsNil(t, err)
+	return token
+}
+
+func TestSetEmailDatabase(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		xEmail := "admin@example.com"
+
+		httpError := setEmailDatabase(r, mocks.MakeAdminUser(), &emailInput{xEmail, mocks.PASSWORD}, conn)
+		assert.IsNil(t, httpError)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, *user.Email, xEmail)
+		assert.Equals(t, user.HasVerifiedEmail(), false)
+
+		assert.Equals(t, len(mockMailer.Messages), 1)
+		message := mockMailer.Messages[0]
+		assert.Equals(t, message.To, xEmail)
+		assert.Contains(t, message.Body, config.Values.Mail.BaseURL+"/email/verify?token=")
+	})
+
+	t.Run("ReplacesVerifiedEmail", func(t *testing.T) {
+		useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		verifyAdminEmail(conn)
+
+		input := &emailInput{"new@example.com", mocks.PASSWORD}
+		httpError := setEmailDatabase(r, mocks.MakeAdminUser(), input, conn)
+		assert.IsNil(t, httpError)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, *user.Email, "new@example.com")
+		assert.Equals(t, user.HasVerifiedEmail(), false)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		email := verifyAdminEmail(conn)
+
+		input := &emailInput{"new@example.com", "beans"}
+		httpError := setEmailDatabase(r, mocks.MakeAdminUser(), input, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, "current password is incorrect")
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, *user.Email, email)
+		assert.Equals(t, user.HasVerifiedEmail(), true)
+		assert.Equals(t, len(mockMailer.Messages), 0)
+	})
+}
+
+func TestDeleteEmail(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		body := fmt.Sprintf(`{"currentPassword": "%s"}`, mocks.PASSWORD)
+		w, r, conn := resolverutils.CommonSetup(body)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		verifyAdminEmail(conn)
+
+		DeleteEmail(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.IsNil(t, user.Email)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"currentPassword": "beans"}`)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		verifyAdminEmail(conn)
+
+		DeleteEmail(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusForbidden)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, user.HasVerifiedEmail(), true)
+	})
+}
+
+func TestValidateEmailInput(t *testing.T) {
+	t.Run("TrimsSpaces", func(t *testing.T) {
+		input := emailInput{Email: " admin@example.com\n"}
+		httpError := validateEmailInput(&input)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, input.Email, "admin@example.com")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		input := emailInput{Email: "admin"}
+		httpError := validateEmailInput(&input)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "email address is invalid")
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	config.CreateConfig()
+	email := "admin@example.com"
+
+	setup := func(t *testing.T) (string, database.Connection) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		setEmailDatabase(r, mocks.MakeAdminUser(), &emailInput{email, mocks.PASSWORD}, conn)
+		return linkToken(t, mockMailer.Messages[0].Body), conn
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		w, req, _ := resolverutils.CommonSetup("")
+		token, conn := setup(t)
+		req.URL.RawQuery = url.Values{"token": {token}}.Encode()
+
+		VerifyEmail(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "Your email address has been verified.")
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, user.HasVerifiedEmail(), true)
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		w, req, _ := resolverutils.CommonSetup("")
+		token, conn := setup(t)
+		req.URL.RawQuery = url.Values{"token": {token + "x"}}.Encode()
+
+		VerifyEmail(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Contains(t, string(w.Body), "This link is invalid or has expired.")
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, user.HasVerifiedEmail(), false)
+	})
+
+	t.Run("ExpiredToken", func(t *testing.T) {
+		_, conn := setup(t)
+		token := authenticate.NewSignedToken(
+			VERIFY_EMAIL_PURPOSE,
+			time.Now().Add(-time.Second),
+			strconv.FormatInt(mocks.ADMIN_ID, 10),
+			email,
+		)
+
+		httpError := verifyEmailDatabase(token, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "this link is invalid or has expired")
+	})
+
+	t.Run("EmailChanged", func(t *testing.T) {
+		token, conn := setup(t)
+		newEmail := "new@example.com"
+		conn.SetUserEmail(mocks.ADMIN_ID, &newEmail)
+
+		httpError := verifyEmailDatabase(token, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "this link is invalid or has expired")
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, user.HasVerifiedEmail(), false)
+	})
+
+	t.Run("WrongPurpose", func(t *testing.T) {
+		_, conn := setup(t)
+		token := authenticate.NewSignedToken(
+			PASSWORD_RESET_PURPOSE,
+			time.Now().Add(time.Hour),
+			strconv.FormatInt(mocks.ADMIN_ID, 10),
+			email,
+		)
+
+		httpError := verifyEmailDatabase(token, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "this link is invalid or has expired")
+	})
+}
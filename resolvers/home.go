@@ -2,12 +2,17 @@ package resolvers
 
 import (
 	"fmt"
+	"html/template"
 	"net/http"
 	"slices"
+	"strings"
 
 	"github.com/raphael-p/beango/client"
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/cookies"
+	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/qrcode"
 	"github.com/raphael-p/beango/utils/response"
 	"github.com/raphael-p/beango/utils/validate"
 )
@@ -29,6 +34,21 @@ func Home(w *response.Writer, r *http.Request, conn database.Connection) {
 	client.ServeTemplate(w, "homePage", client.Skeleton+client.Header+client.HomePage, chatList)
 }
 
+func RefreshChatList(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	chats, httpError := getChatsDatabase(user.ID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	chatList := map[string]any{"Chats": chats}
+	client.ServeTemplate(w, "chatList", client.ChatList, chatList)
+}
+
 func OpenChat(w *response.Writer, r *http.Request, conn database.Connection) {
 	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
 	if resolverutils.DisplayHTTPError(w, httpError) {
@@ -59,11 +79,17 @@ func openChatData(userID, chatID int64, chatName string, conn database.Connectio
 	if httpError != nil {
 		return nil, httpError
 	}
+	if lastMessageID != 0 {
+		if httpError := markChatRead(userID, chatID, lastMessageID, conn); httpError != nil {
+			return nil, httpError
+		}
+	}
 
 	data := map[string]any{
 		"Name":          chatName,
 		"Messages":      messages,
 		"ID":            chatID,
+		"UserID":        userID,
 		"FromMessageID": lastMessageID,
 		"ToMessageID":   firstMessageID,
 	}
@@ -96,10 +122,15 @@ func RefreshMessages(w *response.Writer, r *http.Request, conn database.Connecti
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	httpError = markChatRead(user.ID, params.ChatID, lastMessageID, conn)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
 
 	chatData := map[string]any{
 		"Messages":      messages,
 		"ID":            params.ChatID,
+		"UserID":        user.ID,
 		"FromMessageID": lastMessageID,
 		"ToMessageID":   firstMessageID,
 		"IsRefresh":     true,
@@ -107,6 +138,48 @@ func RefreshMessages(w *response.Writer, r *http.Request, conn database.Connecti
 	client.ServeTemplate(w, "messagePaneRefresh", client.MessagePaneRefresh, chatData)
 }
 
+func GetReadReceiptsHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	receipts, httpError := readReceiptsDatabase(user.ID, params.ChatID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	messages, err := conn.GetMessagesByChatID(params.ChatID, 0, 0, MESSAGE_BATCH_SIZE)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+
+	data := map[string]any{"SeenBy": seenBy(user.ID, messages, receipts)}
+	client.ServeTemplate(w, "readReceipts", client.ReadReceipts, data)
+}
+
+// Lists the members who have read the user's latest message, which is looked
+// for in messages sorted newest to oldest
+func seenBy(userID int64, messages []database.Message, receipts []database.ReadReceipt) string {
+	var latestMessageID int64
+	for _, message := range messages {
+		if message.UserID == userID {
+			latestMessageID = message.ID
+			break
+		}
+	}
+	if latestMessageID == 0 {
+		return ""
+	}
+
+	var displayNames []string
+	for _, receipt := range receipts {
+		if receipt.LastReadMessageID >= latestMessageID {
+			displayNames = append(displayNames, receipt.UserDisplayName)
+		}
+	}
+	return strings.Join(displayNames, ", ")
+}
+
 func ScrollUp(w *response.Writer, r *http.Request, conn database.Connection) {
 	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
 	if resolverutils.ProcessHTTPError(w, httpError) {
@@ -137,6 +210,7 @@ func ScrollUp(w *response.Writer, r *http.Request, conn database.Connection) {
 	olderMessages := map[string]any{
 		"Messages":    messages,
 		"ID":          params.ChatID,
+		"UserID":      user.ID,
 		"ToMessageID": firstMessageID,
 	}
 	client.ServeTemplate(w, "messagePaneScroll", client.MessagePaneScroll, olderMessages)
@@ -160,7 +234,9 @@ func getMessages(userID, chatID, fromMessageID, toMessageID int64, limit int, co
 }
 
 type sendMessageHTMLInput struct {
-	Content validate.JSONField[string] `json:"content" zeroable:"true"`
+	Content          validate.JSONField[string] `json:"content" zeroable:"true"`
+	ReplyToMessageID validate.JSONField[int64]  `json:"replyToMessageID" optional:"true" nullable:"true"`
+	ThreadID         validate.JSONField[int64]  `json:"threadID" optional:"true" nullable:"true"`
 }
 
 func SendMessageHTML(w *response.Writer, r *http.Request, conn database.Connection) {
@@ -175,14 +251,378 @@ func SendMessageHTML(w *response.Writer, r *http.Request, conn database.Connecti
 		return
 	}
 
-	_, httpError = sendMessageDatabase(user.ID, chatID, input.Content.Value, conn)
+	newMessage, httpError := sendMessageDatabase(
+		user.ID,
+		chatID,
+		input.Content.Value,
+		input.ReplyToMessageID.Value,
+		input.ThreadID.Value,
+		conn,
+	)
 	if resolverutils.DisplayHTTPError(w, httpError) {
 		return
 	}
-	SendChatEvent(chatID, "new-messages", "")
+	sendNewMessageEvents(newMessage, conn)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func SendAttachmentsHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	input, httpError := getAttachmentsForm(w, r)
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	newMessage, httpError := sendAttachmentsDatabase(user.ID, params.ChatID, input, conn)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+	sendNewMessageEvents(newMessage, conn)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func SendTypingHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = sendTypingDatabase(user.ID, params.ChatID, conn)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetTypingHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	description, httpError := typingDatabase(user.ID, params.ChatID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	data := map[string]any{"Typing": description}
+	client.ServeTemplate(w, "typingIndicator", client.TypingIndicator, data)
+}
+
+func GetMessageHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	message, httpError := getChatMessage(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	data := map[string]any{"Messages": []database.Message{*message}, "UserID": user.ID}
+	client.ServeTemplate(w, "messageCell", client.MessageCell, data)
+}
+
+func OpenThread(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	message, replies, httpError := threadDatabase(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	data := map[string]any{
+		"Messages": append([]database.Message{*message}, replies...),
+		"ID":       params.ChatID,
+		"ThreadID": message.ID,
+		"UserID":   user.ID,
+	}
+	client.ServeTemplate(w, "threadPane", client.ThreadPane, data)
+}
+
+func GetReactionsHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	message, httpError := getChatMessage(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	data := map[string]any{"Messages": []database.Message{*message}, "UserID": user.ID}
+	client.ServeTemplate(w, "messageReactions", client.MessageReactions, data)
+}
+
+// The reactions are re-rendered by the SSE event, for the user and everyone else
+func AddReactionHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input reactionInput
+	user, params, httpError := resolverutils.GetRequestBodyAndContext(
+		r,
+		&input,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	reactions, httpError := reactDatabase(user.ID, params.ChatID, params.MessageID, input.Emoji, true, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	sendReactionEvent(params.ChatID, params.MessageID, reactions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func RemoveReactionHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	emoji, httpError := resolverutils.GetRequestQueryParam(r, "emoji", true)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	reactions, httpError := reactDatabase(user.ID, params.ChatID, params.MessageID, emoji, false, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	sendReactionEvent(params.ChatID, params.MessageID, reactions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func OpenMessageEditor(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	message, httpError := getChatMessage(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	if message.UserID != user.ID {
+		resolverutils.DisplayHTTPErrorNoSwap(w, &resolverutils.HTTPError{
+			Status:  http.StatusForbidden,
+			Message: "only the author can edit a message",
+		})
+		return
+	}
+
+	data := map[string]any{"Messages": []database.Message{*message}}
+	client.ServeTemplate(w, "messageEditCell", client.MessageEditCell, data)
+}
+
+func EditMessageHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	input := new(sendMessageHTMLInput)
+	user, params, httpError := resolverutils.GetRequestBodyAndContext(
+		r,
+		input,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	_, httpError = editMessageDatabase(user.ID, params.ChatID, params.MessageID, input.Content.Value, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	SendChatEvent(params.ChatID, editMessageEvent(params.MessageID), "")
+
+	message, err := conn.GetMessage(params.MessageID)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+	data := map[string]any{"Messages": []database.Message{*message}, "UserID": user.ID}
+	client.ServeTemplate(w, "messageCell", client.MessageCell, data)
+}
+
+func DeleteMessageHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	httpError = deleteMessageDatabase(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	sendDeleteMessageEvents(params.ChatID, params.MessageID, conn)
+
+	message, err := conn.GetMessage(params.MessageID)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+	data := map[string]any{"Messages": []database.Message{*message}, "UserID": user.ID}
+	client.ServeTemplate(w, "messageCell", client.MessageCell, data)
+}
+
+func serveSessionsPane(w *response.Writer, r *http.Request, userID int64, conn database.Connection) {
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	sessions, httpError := getSessionsDatabase(userID, currentSessionID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	data := map[string]any{"Sessions": sessions}
+	client.ServeTemplate(w, "sessionsPane", client.SessionsPane, data)
+}
+
+func OpenSessions(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	serveSessionsPane(w, r, user.ID, conn)
+}
+
+func DeleteSessionHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.SESSION_ID_KEY)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	isCurrent, httpError := deleteSessionDatabase(user.ID, params.SessionID, currentSessionID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	if isCurrent {
+		cookies.Invalidate(w, cookies.SESSION)
+		w.Header().Set("HX-Redirect", "/login")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	serveSessionsPane(w, r, user.ID, conn)
+}
+
+func DeleteOtherSessionsHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	err := conn.DeleteOtherSessions(user.ID, currentSessionID)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+
+	serveSessionsPane(w, r, user.ID, conn)
+}
+
+func serveTOTPPane(w *response.Writer, userID int64, conn database.Connection) {
+	status, httpError := getTOTPStatusDatabase(userID, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	data := map[string]any{"Enabled": status.Enabled, "RecoveryCodesLeft": status.RecoveryCodesLeft}
+	client.ServeTemplate(w, "totpPane", client.TOTPPane, data)
+}
+
+func OpenTOTP(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	serveTOTPPane(w, user.ID, conn)
+}
+
+func StartTOTPSetupHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	setup, httpError := startTOTPSetupDatabase(user, conn)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	code, err := qrcode.Encode(setup.ProvisioningURI)
+	if err != nil {
+		logger.Error("failed to make QR code: " + err.Error())
+		w.WriteString(http.StatusInternalServerError, "failed to make QR code")
+		return
+	}
+
+	data := map[string]any{
+		"Secret": setup.Secret,
+		"QRCode": template.HTML(code.SVG()), // only made of numbers
+	}
+	client.ServeTemplate(w, "totpSetupPane", client.TOTPSetupPane, data)
+}
+
+func EnableTOTPHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input totpCodeInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	codes, httpError := enableTOTPDatabase(user.ID, input.Code, conn)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+	data := map[string]any{"RecoveryCodes": codes}
+	client.ServeTemplate(w, "recoveryCodesPane", client.RecoveryCodesPane, data)
+}
+
+func DisableTOTPHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input totpCodeInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	if resolverutils.DisplayHTTPError(w, disableTOTPDatabase(user.ID, input.Code, conn)) {
+		return
+	}
+	serveTOTPPane(w, user.ID, conn)
+}
+
 func OpenChatCreator(w *response.Writer, r *http.Request, conn database.Connection) {
 	w.WriteString(http.StatusOK, client.NewChatPane)
 }
@@ -191,6 +631,80 @@ func OpenRenamer(w *response.Writer, r *http.Request, conn database.Connection)
 	w.WriteString(http.StatusOK, client.ChangeNamePane)
 }
 
+func OpenPasswordChanger(w *response.Writer, r *http.Request, conn database.Connection) {
+	w.WriteString(http.StatusOK, client.ChangePasswordPane)
+}
+
+func ChangePasswordHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input changePasswordInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	if resolverutils.DisplayHTTPError(w, changePasswordDatabase(r, user.ID, &input, conn)) {
+		return
+	}
+	w.WriteHTML(
+		http.StatusOK,
+		`<span class="info">
+			Your password has been changed.
+			You have been logged out on every other device.
+		</span>`,
+	)
+}
+
+func serveEmailPane(w *response.Writer, userID int64, conn database.Connection) {
+	user, err := conn.GetUser(userID)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+
+	data := map[string]any{"Email": "", "Verified": user.HasVerifiedEmail()}
+	if user.Email != nil {
+		data["Email"] = *user.Email
+	}
+	client.ServeTemplate(w, "emailPane", client.EmailPane, data)
+}
+
+func OpenEmail(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	serveEmailPane(w, user.ID, conn)
+}
+
+func SetEmailHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input emailInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+	if resolverutils.DisplayHTTPErrorNoSwap(w, validateEmailInput(&input)) {
+		return
+	}
+
+	if resolverutils.DisplayHTTPErrorNoSwap(w, setEmailDatabase(r, user, &input, conn)) {
+		return
+	}
+	serveEmailPane(w, user.ID, conn)
+}
+
+func DeleteEmailHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input deleteEmailInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.DisplayHTTPErrorNoSwap(w, httpError) {
+		return
+	}
+
+	if resolverutils.DisplayHTTPErrorNoSwap(w, deleteEmailDatabase(r, user.ID, &input, conn)) {
+		return
+	}
+	serveEmailPane(w, user.ID, conn)
+}
+
 type userSearchInput struct {
 	Query validate.JSONField[string] `json:"query" zeroable:"true"`
 }
@@ -216,6 +730,40 @@ func UserSearch(w *response.Writer, r *http.Request, conn database.Connection) {
 	client.ServeTemplate(w, "userSearchResults", client.UserSearchResults, data)
 }
 
+func OpenMessageSearch(w *response.Writer, r *http.Request, conn database.Connection) {
+	w.WriteString(http.StatusOK, client.MessageSearchPane)
+}
+
+func SearchMessagesHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		w.WriteString(http.StatusOK, "")
+		return
+	}
+	cursor, httpError := resolverutils.GetRequestQueryParamInt(r, "cursor", false)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	output, httpError := searchMessagesDatabase(user.ID, query, cursor, conn)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+
+	data := map[string]any{
+		"Results":    output.Results,
+		"NextCursor": output.NextCursor,
+		"Query":      query,
+		"Cursor":     cursor,
+	}
+	client.ServeTemplate(w, "messageSearchResults", client.MessageSearchResults, data)
+}
+
 func CreatePrivateChatHTML(w *response.Writer, r *http.Request, conn database.Connection) {
 	var input createPrivateChatInput
 	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
@@ -228,6 +776,9 @@ func CreatePrivateChatHTML(w *response.Writer, r *http.Request, conn database.Co
 	if newChat == nil && resolverutils.DisplayHTTPError(w, httpError) {
 		return
 	}
+	if httpError == nil {
+		SendChatMembersEvent(newChat.ID, NEW_CHAT_EVENT, conn)
+	}
 
 	// Resolve chat display name
 	chatName := newChat.Name
@@ -270,6 +821,7 @@ func RenameUser(w *response.Writer, r *http.Request, conn database.Connection) {
 	if resolverutils.DisplayHTTPError(w, resolverutils.HandleDatabaseError(err)) {
 		return
 	}
+	sendRenameEvents(user.ID, conn)
 
 	message := fmt.Sprintf(
 		`<span class="info">
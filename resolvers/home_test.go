@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/test/assert"
 	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/response"
+	"github.com/raphael-p/beango/utils/totp"
 )
 
 func TestHome(t *testing.T) {
@@ -19,6 +24,40 @@ func TestHome(t *testing.T) {
 		assert.Equals(t, w.Status, http.StatusOK)
 		assert.Contains(t, string(w.Body), "<html>", "</html")
 	})
+
+	t.Run("ListensForEachChatEvent", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		Home(w, r, conn)
+		for _, event := range []string{NEW_MESSAGE_EVENT, READ_CHAT_EVENT, NEW_CHAT_EVENT, RENAME_CHAT_EVENT, LEAVE_CHAT_EVENT} {
+			assert.Contains(t, string(w.Body), fmt.Sprintf(`hx-trigger="sse:%s"`, event))
+		}
+	})
+}
+
+func TestRefreshChatList(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, 12)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		RefreshChatList(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), fmt.Sprintf("/home/chat/%d?", chat.ID), chat.Name)
+		assert.NotContains(t, string(w.Body), "<html>")
+	})
+
+	t.Run("UnreadBadge", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, 12)
+		conn.SetMessage(mocks.MakeMessage(12, chat.ID))
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		RefreshChatList(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), `<span class="unread-badge">1</span>`)
+	})
 }
 
 func TestOpenChat(t *testing.T) {
@@ -36,6 +75,43 @@ func TestOpenChat(t *testing.T) {
 		assert.Equals(t, w.Status, http.StatusOK)
 		assert.Contains(t, string(w.Body), "<table", "</table>")
 	})
+
+	t.Run("ListensForEachReceiptEvent", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		query := r.URL.Query()
+		query.Add("name", "My Chat Name")
+		r.URL.RawQuery = query.Encode()
+
+		OpenChat(w, r, conn)
+		assert.Contains(
+			t,
+			string(w.Body),
+			fmt.Sprintf(`hx-trigger="sse:%s"`, READ_RECEIPT_EVENT),
+			fmt.Sprintf(`hx-trigger="sse:%s"`, NEW_MESSAGES_EVENT),
+			`id="new-messages-listener"`,
+		)
+	})
+
+	t.Run("MarksChatRead", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		query := r.URL.Query()
+		query.Add("name", "My Chat Name")
+		r.URL.RawQuery = query.Encode()
+
+		OpenChat(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		counts, _ := conn.GetUnreadCounts(mocks.ADMIN_ID)
+		assert.Equals(t, counts[0].Count, 0)
+	})
 }
 
 func TestRefreshMessages(t *testing.T) {
@@ -53,6 +129,9 @@ func TestRefreshMessages(t *testing.T) {
 		RefreshMessages(w, r, conn)
 		assert.Equals(t, w.Status, http.StatusOK)
 		assert.Contains(t, string(w.Body), message.Content, "<table", "</table>")
+		assert.Contains(t, string(w.Body), `hx-trigger="sse:new-messages throttle:10s from:#new-messages-listener"`)
+		counts, _ := conn.GetUnreadCounts(mocks.ADMIN_ID)
+		assert.Equals(t, counts[0].Count, 0)
 	})
 
 	t.Run("NoNewMessages", func(t *testing.T) {
@@ -71,16 +150,55 @@ func TestRefreshMessages(t *testing.T) {
 	})
 }
 
+func TestGetReadReceiptsHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chat.ID))
+		conn.MarkChatRead(chat.ID, user.ID, 0)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetReadReceiptsHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "seen by "+user.DisplayName)
+	})
+}
+
+func TestSeenBy(t *testing.T) {
+	receipts := []database.ReadReceipt{
+		{UserID: 2, UserDisplayName: "AMY", LastReadMessageID: 4},
+		{UserID: 3, UserDisplayName: "GEORGE", LastReadMessageID: 2},
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		messages := []database.Message{{ID: 5, UserID: 2}, {ID: 3, UserID: 1}, {ID: 2, UserID: 1}}
+		assert.Equals(t, seenBy(1, messages, receipts), "AMY")
+	})
+
+	t.Run("SeenByAll", func(t *testing.T) {
+		messages := []database.Message{{ID: 2, UserID: 1}}
+		assert.Equals(t, seenBy(1, messages, receipts), "AMY, GEORGE")
+	})
+
+	t.Run("NoMessageFromUser", func(t *testing.T) {
+		messages := []database.Message{{ID: 2, UserID: 2}}
+		assert.Equals(t, seenBy(1, messages, receipts), "")
+	})
+}
+
 func TestScrollUp(t *testing.T) {
 	t.Run("Normal", func(t *testing.T) {
 		w, r, conn := resolverutils.CommonSetup("")
 		user, _ := conn.SetUser(mocks.MakeUser())
 		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
 		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		newerMessage, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
 		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
 		r = resolverutils.SetContext(t, r, mocks.Admin, params)
 		query := r.URL.Query()
-		query.Add("to", "1")
+		query.Add("to", fmt.Sprint(newerMessage.ID))
 		r.URL.RawQuery = query.Encode()
 
 		ScrollUp(w, r, conn)
@@ -139,6 +257,33 @@ func TestSendMessageHTML(t *testing.T) {
 		assert.Equals(t, string(w.Body), "")
 	})
 
+	t.Run("Reply", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"content": "Indeed!", "replyToMessageID": 1}`)
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		SendMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		reply, _ := conn.GetMessage(2)
+		assert.Equals(t, *reply.ReplyToMessageID, int64(1))
+	})
+
+	t.Run("NotReplying", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"content": "Hello!", "replyToMessageID": null}`)
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		SendMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		message, _ := conn.GetMessage(1)
+		assert.IsNil(t, message.ReplyToMessageID)
+	})
+
 	t.Run("EmptyMessage", func(t *testing.T) {
 		w, r, conn := resolverutils.CommonSetup(`{"content": ""}`)
 		user, _ := conn.SetUser(mocks.MakeUser())
@@ -152,6 +297,28 @@ func TestSendMessageHTML(t *testing.T) {
 	})
 }
 
+func TestSendAttachmentsHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, r := makeAttachmentsRequest(t, chatID, nil, map[string]string{"beans.png": testPNG})
+
+		SendAttachmentsHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		message, _ := conn.GetMessage(1)
+		assert.HasLength(t, message.Attachments, 1)
+	})
+
+	t.Run("NoFile", func(t *testing.T) {
+		setupAttachmentTests(t)
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, r := makeAttachmentsRequest(t, chatID, map[string]string{"replyToMessageID": ""}, nil)
+
+		SendAttachmentsHTML(w, r, conn)
+		assert.Contains(t, string(w.Body), "id='errors'", "no file attached")
+	})
+}
+
 func TestUserSearch(t *testing.T) {
 	t.Run("Normal", func(t *testing.T) {
 		body := fmt.Sprintf(`{"query": "%s"}`, "partial_username")
@@ -164,6 +331,57 @@ func TestUserSearch(t *testing.T) {
 	})
 }
 
+func TestSearchMessagesHTML(t *testing.T) {
+	setup := func(t *testing.T, q string) (*response.Writer, *http.Request, database.Connection) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		reply := mocks.MakeMessage(mocks.ADMIN_ID, chat.ID)
+		reply.Content = "<i>Dolor</i>"
+		reply.ThreadID = &message.ID
+		conn.SetMessage(reply)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		query := r.URL.Query()
+		query.Add("q", q)
+		r.URL.RawQuery = query.Encode()
+		return w, r, conn
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := setup(t, "dolor")
+
+		SearchMessagesHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(
+			t,
+			string(w.Body),
+			`hx-get="/home/chat/1?name=The Group"`,
+			"[group] <b>The Group</b>",
+			"Lorem Ipsum <mark>Dolor</mark>",
+			"<mark>&lt;i&gt;Dolor&lt;/i&gt;</mark>",
+			"scrollToMessage(event, 1)", // replies in a thread are shown at the start of the thread
+		)
+		assert.NotContains(t, string(w.Body), "scrollToMessage(event, 2)", "No results.")
+	})
+
+	t.Run("NoResults", func(t *testing.T) {
+		w, r, conn := setup(t, "beans")
+
+		SearchMessagesHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "No results.")
+	})
+
+	t.Run("EmptyQuery", func(t *testing.T) {
+		w, r, conn := setup(t, " ")
+
+		SearchMessagesHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Equals(t, string(w.Body), "")
+	})
+}
+
 func TestCreatePrivateChatHTML(t *testing.T) {
 	t.Run("Normal", func(t *testing.T) {
 		body := fmt.Sprintf(`{"userID": %d}`, mocks.ADMIN_ID)
@@ -205,3 +423,415 @@ func TestRenameUser(t *testing.T) {
 		assert.Equals(t, string(w.Body), message)
 	})
 }
+
+func TestGetMessageHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		conn.UpdateMessage(message.ID, "Edited Content")
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "<td", "Edited Content", "(edited)")
+		assert.Contains(
+			t,
+			string(w.Body),
+			fmt.Sprintf(`hx-trigger="sse:edit-message-%d"`, message.ID),
+			fmt.Sprintf(`hx-trigger="sse:delete-message-%d"`, message.ID),
+		)
+		assert.NotContains(t, string(w.Body), "/edit")
+	})
+
+	t.Run("Reply", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		original, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		reply := mocks.MakeMessage(mocks.ADMIN_ID, chat.ID)
+		reply.ReplyToMessageID = &original.ID
+		reply, _ = conn.SetMessage(reply)
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(reply.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(
+			t,
+			string(w.Body),
+			fmt.Sprintf(`href="#message-%d"`, original.ID),
+			user.DisplayName+": "+original.Content,
+		)
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message := mocks.MakeMessage(user.ID, chat.ID)
+		message.Content = "*beans* on `toast` <script>alert(1)</script> https://example.com"
+		message, _ = conn.SetMessage(message)
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(
+			t,
+			string(w.Body),
+			"<em>beans</em> on <code>toast</code> &lt;script&gt;",
+			`<a href="https://example.com" target="_blank"`,
+		)
+		assert.NotContains(t, string(w.Body), "<script>")
+	})
+
+	t.Run("Attachments", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		conn.SetAttachment(&database.Attachment{
+			MessageID:   message.ID,
+			Filename:    "beans.png",
+			ContentType: "image/png",
+			Size:        2048,
+		})
+		conn.SetAttachment(&database.Attachment{
+			MessageID:   message.ID,
+			Filename:    "beans.pdf",
+			ContentType: "application/pdf",
+			Size:        3 << 20,
+		})
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(
+			t,
+			string(w.Body),
+			fmt.Sprintf(`src="/chat/%d/attachment/1"`, chat.ID),
+			`alt="beans.png"`,
+			fmt.Sprintf(`href="/chat/%d/attachment/2"`, chat.ID),
+			`download="beans.pdf"`,
+			"(3.0 MB)",
+		)
+	})
+
+	t.Run("MessageNotFound", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, mocks.ADMIN_ID)
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: "1",
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetMessageHTML(w, r, conn)
+		assert.Equals(t, w.Header().Get("HX-Reswap"), "none")
+		assert.Contains(t, string(w.Body), "message not found")
+	})
+}
+
+func TestOpenThread(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, 12)
+		root, _ := conn.SetMessage(mocks.MakeMessage(12, chat.ID))
+		reply := mocks.MakeMessage(mocks.ADMIN_ID, chat.ID)
+		reply.ThreadID = &root.ID
+		reply.Content = "Thread reply"
+		conn.SetMessage(reply)
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(root.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		OpenThread(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(
+			t,
+			string(w.Body),
+			fmt.Sprintf("sse:thread-%d", root.ID),
+			root.Content,
+			"Thread reply",
+			"1 reply",
+			`hx-vals='{"threadID": 1}'`,
+		)
+	})
+}
+
+func TestGetReactionsHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(user.ID, chat.ID))
+		conn.AddReaction(message.ID, mocks.ADMIN_ID, "👍")
+		conn.AddReaction(message.ID, user.ID, "❤️")
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetReactionsHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(
+			t,
+			string(w.Body),
+			fmt.Sprintf("sse:reaction-%d", message.ID),
+			`class="reaction reacted"`,
+			"hx-delete=",
+			"👍 1",
+			`hx-vals='{"emoji": "❤️"}'`,
+			"❤️ 1",
+		)
+	})
+}
+
+func TestOpenMessageEditor(t *testing.T) {
+	setup := func(t *testing.T, authorID int64) (*response.Writer, *http.Request, database.Connection) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(authorID, chat.ID))
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		return w, r, conn
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := setup(t, mocks.ADMIN_ID)
+
+		OpenMessageEditor(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "<textarea", "hx-patch", "Lorem Ipsum Dolor")
+	})
+
+	t.Run("NotAuthor", func(t *testing.T) {
+		w, r, conn := setup(t, 12)
+
+		OpenMessageEditor(w, r, conn)
+		assert.Equals(t, w.Header().Get("HX-Reswap"), "none")
+		assert.Contains(t, string(w.Body), "only the author can edit a message")
+	})
+}
+
+func TestEditMessageHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"content": "Edited Content"}`)
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chat.ID))
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		EditMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "<td", "Edited Content", "(edited)", "/edit")
+	})
+}
+
+func TestDeleteMessageHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chat.ID))
+		params := map[string]string{
+			resolverutils.CHAT_ID_KEY:    fmt.Sprint(chat.ID),
+			resolverutils.MESSAGE_ID_KEY: fmt.Sprint(message.ID),
+		}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		DeleteMessageHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "<td", database.DELETED_MESSAGE_CONTENT)
+		assert.NotContains(t, string(w.Body), message.Content, "/edit")
+	})
+}
+
+func TestOpenSessions(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		otherSession := mocks.MakeSession(mocks.ADMIN_ID)
+		conn.SetSession(otherSession)
+		w, r := makeSessionRequest(t, mocks.AdminSesh.ID, nil)
+
+		OpenSessions(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "(this device)", "/home/session/"+otherSession.Handle)
+		assert.NotContains(t, string(w.Body), "/home/session/"+mocks.AdminSesh.Handle)
+	})
+}
+
+func TestDeleteSessionHTML(t *testing.T) {
+	t.Run("CurrentSession", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		params := map[string]string{resolverutils.SESSION_ID_KEY: mocks.AdminSesh.Handle}
+		w, r := makeSessionRequest(t, mocks.AdminSesh.ID, params)
+
+		DeleteSessionHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		assert.Equals(t, w.Header().Get("HX-Redirect"), "/login")
+	})
+}
+
+func TestChangePasswordHTML(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		body := fmt.Sprintf(`{"currentPassword": "%s", "newPassword": "beans4ever"}`, mocks.PASSWORD)
+		w, r, _ := resolverutils.CommonSetup(body)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		ChangePasswordHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "Your password has been changed.")
+	})
+
+	t.Run("WrongCurrentPassword", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		w, r, _ := resolverutils.CommonSetup(`{"currentPassword": "beans", "newPassword": "beans4ever"}`)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		ChangePasswordHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "<div id='errors'", "current password is incorrect")
+	})
+}
+
+func TestOpenEmail(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		OpenEmail(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "Add an email address", `hx-post="/home/email"`)
+		assert.NotContains(t, string(w.Body), `hx-delete="/home/email"`)
+	})
+
+	t.Run("Verified", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		email := verifyAdminEmail(conn)
+
+		OpenEmail(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), email, "is verified", `hx-delete="/home/email"`)
+	})
+}
+
+func TestSetEmailHTML(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		body := fmt.Sprintf(`{"email": "admin@example.com", "currentPassword": "%s"}`, mocks.PASSWORD)
+		w, r, conn := resolverutils.CommonSetup(body)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		SetEmailHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "admin@example.com", "is not verified yet")
+		assert.Equals(t, len(mockMailer.Messages), 1)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		body := fmt.Sprintf(`{"email": "admin", "currentPassword": "%s"}`, mocks.PASSWORD)
+		w, r, conn := resolverutils.CommonSetup(body)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		SetEmailHTML(w, r, conn)
+		assert.Contains(t, string(w.Body), "email address is invalid")
+		assert.Equals(t, len(mockMailer.Messages), 0)
+	})
+}
+
+func TestOpenTOTP(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		OpenTOTP(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "Off.", `hx-post="/home/totp/setup"`)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		enableAdminTOTP(t, conn)
+
+		OpenTOTP(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "10 recovery code(s) left", `hx-delete="/home/totp"`)
+	})
+}
+
+func TestStartTOTPSetupHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		StartTOTPSetupHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		userTOTP, _ := conn.GetTOTP(mocks.ADMIN_ID)
+		assert.Contains(t, string(w.Body), "<svg", userTOTP.Secret, `hx-post="/home/totp/enable"`)
+	})
+}
+
+func TestEnableTOTPHTML(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		secret, _ := totp.GenerateSecret()
+		conn.SetTOTP(mocks.ADMIN_ID, secret)
+		w, r, _ := resolverutils.CommonSetup(fmt.Sprintf(`{"code": "%s"}`, currentCode(t, secret)))
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		EnableTOTPHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), `<ul class="recovery-codes">`, "<li><code>")
+	})
+}
+
+func TestGetTypingHTML(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		typing.start(chat.ID, user.ID, time.Minute)
+		t.Cleanup(func() { typing.stop(chat.ID, user.ID) })
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		GetTypingHTML(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), user.DisplayName+" is typing…")
+	})
+}
@@ -13,7 +13,7 @@ import (
 
 func Login(w *response.Writer, r *http.Request, conn database.Connection) {
 	if sessionID, err := cookies.Get(r, cookies.SESSION); err == nil {
-		if _, ok := conn.CheckSession(sessionID); ok {
+		if session, _ := conn.CheckSession(sessionID); session != nil {
 			w.Redirect("/home", r)
 			return
 		}
@@ -22,6 +22,13 @@ func Login(w *response.Writer, r *http.Request, conn database.Connection) {
 	client.ServeTemplate(w, "loginPage", client.Skeleton+client.LoginPage, nil)
 }
 
+// Opened from the link in a password reset email
+func ResetPasswordPage(w *response.Writer, r *http.Request, conn database.Connection) {
+	token, _ := resolverutils.GetRequestQueryParam(r, "token", false)
+	data := map[string]any{"Token": token}
+	client.ServeTemplate(w, "resetPasswordPage", client.Skeleton+client.ResetPasswordPage, data)
+}
+
 func SubmitLogin(w *response.Writer, r *http.Request, conn database.Connection) {
 	// getting route param directly instead of using GetRequestContext()
 	// because it would error since no user is in the context
@@ -37,6 +44,19 @@ func SubmitLogin(w *response.Writer, r *http.Request, conn database.Connection)
 		return
 	}
 
+	if action == "code" {
+		var input loginCodeInput
+		if resolverutils.DisplayHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
+			return
+		}
+		if resolverutils.DisplayHTTPError(w, verifyLoginCode(w, r, &input, conn)) {
+			return
+		}
+		w.Header().Set("HX-Redirect", "/home")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	var input createUserInput
 	if resolverutils.DisplayHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
 		return
@@ -45,7 +65,11 @@ func SubmitLogin(w *response.Writer, r *http.Request, conn database.Connection)
 		return
 	}
 
+	// only new passwords have to follow the rules, older ones still work at login
 	if action == "signup" {
+		if resolverutils.DisplayHTTPError(w, validatePassword(input.Password)) {
+			return
+		}
 		_, httpError := createUserDatabase(input.Username, input.DisplayName.Value, input.Password, conn)
 		if resolverutils.DisplayHTTPError(w, httpError) {
 			return
@@ -53,11 +77,18 @@ func SubmitLogin(w *response.Writer, r *http.Request, conn database.Connection)
 	}
 
 	userID, httpError := checkCredentials(input.Username, input.Password, conn)
+	recordLoginAttempt(r, httpError)
 	if resolverutils.DisplayHTTPError(w, httpError) {
 		return
 	}
 
-	if resolverutils.DisplayHTTPError(w, setSession(w, makeSession(userID), conn)) {
+	preAuthToken, httpError := startLogin(w, r, userID, conn)
+	if resolverutils.DisplayHTTPError(w, httpError) {
+		return
+	}
+	if preAuthToken != nil {
+		data := map[string]any{"PreAuthToken": preAuthToken.ID}
+		client.ServeTemplate(w, "loginCodeForm", client.LoginCodeForm, data)
 		return
 	}
 
@@ -3,6 +3,7 @@ package resolvers
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/raphael-p/beango/config"
@@ -12,6 +13,7 @@ import (
 	"github.com/raphael-p/beango/test/mocks"
 	"github.com/raphael-p/beango/utils/cookies"
 	"github.com/raphael-p/beango/utils/response"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestLogin(t *testing.T) {
@@ -86,4 +88,58 @@ func TestSubmitLogin(t *testing.T) {
 
 		checkSuccessfulLogin(w, req, conn)
 	})
+
+	t.Run("SignupWithBlankPassword", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup(body("someNewUser", "  "))
+		params := map[string]string{resolverutils.ACTION_KEY: "signup"}
+		req = resolverutils.SetContext(t, req, nil, params)
+
+		SubmitLogin(w, req, conn)
+		assert.Contains(t, string(w.Body), "password may not be blank")
+		user, _ := conn.GetUserByUsername("someNewUser")
+		assert.IsNil(t, user)
+	})
+
+	t.Run("LoginWithPasswordFromBeforeRules", func(t *testing.T) {
+		user := mocks.MakeUser()
+		user.Key, _ = bcrypt.GenerateFromPassword([]byte("  "), bcrypt.MinCost)
+		w, req, conn := resolverutils.CommonSetup(body(user.Username, "  "))
+		conn.SetUser(user)
+		params := map[string]string{resolverutils.ACTION_KEY: "login"}
+		req = resolverutils.SetContext(t, req, nil, params)
+
+		checkSuccessfulLogin(w, req, conn)
+	})
+
+	t.Run("NormalWithTwoFactor", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup(body(mocks.ADMIN_USERNAME, mocks.PASSWORD))
+		secret, _ := enableAdminTOTP(t, conn)
+		params := map[string]string{resolverutils.ACTION_KEY: "login"}
+		req = resolverutils.SetContext(t, req, nil, params)
+
+		SubmitLogin(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.HasLength(t, w.Header()["Set-Cookie"], 0)
+		assert.Contains(t, string(w.Body), `name="preAuthToken"`, `hx-post="/login/code"`)
+		tokenStart := strings.Index(string(w.Body), `name="preAuthToken" value="`) + 27
+		tokenID := string(w.Body)[tokenStart : tokenStart+36]
+
+		codeBody := fmt.Sprintf(`{"preAuthToken": "%s", "code": "%s"}`, tokenID, currentCode(t, secret))
+		w, req, _ = resolverutils.CommonSetup(codeBody)
+		params = map[string]string{resolverutils.ACTION_KEY: "code"}
+		req = resolverutils.SetContext(t, req, nil, params)
+		checkSuccessfulLogin(w, req, conn)
+		assert.HasLength(t, w.Header()["Set-Cookie"], 1)
+	})
+}
+
+func TestResetPasswordPage(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup("")
+		req.URL.RawQuery = "token=abc.def"
+
+		ResetPasswordPage(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), `name="token" value="abc.def"`, `hx-post="/login/reset"`)
+	})
 }
@@ -5,13 +5,16 @@ import (
 
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/utils/cookies"
+	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/response"
 )
 
 func Logout(w *response.Writer, r *http.Request, conn database.Connection) {
 	sessionID, _ := cookies.Get(r, cookies.SESSION)
 	if sessionID != "" {
-		conn.DeleteSession(sessionID)
+		if err := conn.DeleteSession(sessionID); err != nil {
+			logger.Error("failed to delete session: " + err.Error())
+		}
 	}
 
 	cookies.Invalidate(w, cookies.SESSION)
@@ -40,12 +40,12 @@ func TestLogout(t *testing.T) {
 		cookie := &http.Cookie{Name: string(cookies.SESSION), Value: xSesh.ID}
 		r.AddCookie(cookie)
 
-		sesh, _ := conn.GetSessionByUserID(xSesh.UserID)
-		assert.IsNotNil(t, sesh)
+		sessions, _ := conn.GetSessionsByUserID(xSesh.UserID)
+		assert.HasLength(t, sessions, 1)
 
 		checkValidResponse(w, r, conn)
-		sesh, _ = conn.GetSessionByUserID(xSesh.UserID)
-		assert.IsNil(t, sesh)
+		sessions, _ = conn.GetSessionsByUserID(xSesh.UserID)
+		assert.HasLength(t, sessions, 0)
 	})
 
 	t.Run("FromHTMX", func(t *testing.T) {
@@ -1,12 +1,15 @@
 package resolvers
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/utils/response"
+	"github.com/raphael-p/beango/utils/validate"
 )
 
 func chatMessagesDatabase(userID, chatID, fromMessageID, toMessageID int64, limit int, conn database.Connection) ([]database.Message, *resolverutils.HTTPError) {
@@ -25,6 +28,25 @@ func chatMessagesDatabase(userID, chatID, fromMessageID, toMessageID int64, limi
 	return messages, resolverutils.HandleDatabaseError(err)
 }
 
+// Fetches how far the other members of the chat have read
+func readReceiptsDatabase(userID, chatID int64, conn database.Connection) ([]database.ReadReceipt, *resolverutils.HTTPError) {
+	if chat, _ := conn.GetChat(chatID, userID); chat == nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "chat not found",
+		}
+	}
+
+	receipts, err := conn.GetReadReceipts(chatID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return slices.DeleteFunc(receipts, func(receipt database.ReadReceipt) bool {
+		return receipt.UserID == userID
+	}), nil
+}
+
+// Each message lists the members who have read up to it, as seenBy
 func GetChatMessages(w *response.Writer, r *http.Request, conn database.Connection) {
 	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
 	if resolverutils.ProcessHTTPError(w, httpError) {
@@ -37,11 +59,30 @@ func GetChatMessages(w *response.Writer, r *http.Request, conn database.Connecti
 	w.WriteJSON(http.StatusOK, messages)
 }
 
+// Matches the maxlength of the message inputs, and bounds the time it takes to
+// render a message's markdown
+const MAX_MESSAGE_LENGTH = 5000
+
+func validateMessageLength(content string) *resolverutils.HTTPError {
+	if len([]rune(content)) > MAX_MESSAGE_LENGTH {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("message must be shorter than %d characters", MAX_MESSAGE_LENGTH+1),
+		}
+	}
+	return nil
+}
+
 type sendMessageInput struct {
-	Content string `json:"content"`
+	Content          string                    `json:"content"`
+	ReplyToMessageID validate.JSONField[int64] `json:"replyToMessageID" optional:"true" nullable:"true"`
+	ThreadID         validate.JSONField[int64] `json:"threadID" optional:"true" nullable:"true"`
 }
 
-func sendMessageDatabase(userID, chatID int64, content string, conn database.Connection) (*database.MessageDatabase, *resolverutils.HTTPError) {
+// Checks that a message can be sent, and makes it without saving it. A
+// replyToMessageID of 0 makes a message that does not reply to another, and a
+// threadID of 0 sends it to the main timeline of the chat.
+func makeMessage(userID, chatID int64, content string, replyToMessageID, threadID int64, conn database.Connection) (*database.MessageDatabase, *resolverutils.HTTPError) {
 	if chat, _ := conn.GetChat(chatID, userID); chat == nil {
 		return nil, &resolverutils.HTTPError{
 			Status:  http.StatusNotFound,
@@ -54,6 +95,54 @@ func sendMessageDatabase(userID, chatID int64, content string, conn database.Con
 		ChatID:  chatID,
 		Content: strings.TrimSpace(content),
 	}
+	if httpError := validateMessageLength(newMessage.Content); httpError != nil {
+		return nil, httpError
+	}
+	if threadID != 0 {
+		if _, httpError := getThreadRoot(userID, chatID, threadID, conn); httpError != nil {
+			return nil, httpError
+		}
+		newMessage.ThreadID = &threadID
+	}
+	if replyToMessageID != 0 {
+		replyTo, err := conn.GetMessage(replyToMessageID)
+		if err != nil {
+			return nil, resolverutils.HandleDatabaseError(err)
+		}
+		if replyTo == nil || replyTo.ChatID != chatID {
+			return nil, &resolverutils.HTTPError{
+				Status:  http.StatusNotFound,
+				Message: "message to reply to not found",
+			}
+		}
+		if replyTo.DeletedAt != nil {
+			return nil, &resolverutils.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: "cannot reply to a deleted message",
+			}
+		}
+		var replyToThreadID int64
+		if replyTo.ThreadID != nil {
+			replyToThreadID = *replyTo.ThreadID
+		} else if replyTo.ID == threadID {
+			replyToThreadID = threadID // the message that started the thread
+		}
+		if replyToThreadID != threadID {
+			return nil, &resolverutils.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: "cannot reply to a message from another thread",
+			}
+		}
+		newMessage.ReplyToMessageID = &replyToMessageID
+	}
+	return newMessage, nil
+}
+
+func sendMessageDatabase(userID, chatID int64, content string, replyToMessageID, threadID int64, conn database.Connection) (*database.MessageDatabase, *resolverutils.HTTPError) {
+	newMessage, httpError := makeMessage(userID, chatID, content, replyToMessageID, threadID, conn)
+	if httpError != nil {
+		return nil, httpError
+	}
 	newMessage, err := conn.SetMessage(newMessage)
 	return newMessage, resolverutils.HandleDatabaseError(err)
 }
@@ -65,9 +154,229 @@ func SendMessage(w *response.Writer, r *http.Request, conn database.Connection)
 		return
 	}
 
-	newMessage, httpError := sendMessageDatabase(user.ID, params.ChatID, input.Content, conn)
+	newMessage, httpError := sendMessageDatabase(
+		user.ID,
+		params.ChatID,
+		input.Content,
+		input.ReplyToMessageID.Value,
+		input.ThreadID.Value,
+		conn,
+	)
 	if resolverutils.ProcessHTTPError(w, httpError) {
 		return
 	}
+	sendNewMessageEvents(newMessage, conn)
 	w.WriteJSON(http.StatusCreated, newMessage)
 }
+
+// Name of the SSE event sent when a message needs to be re-rendered
+func editMessageEvent(messageID int64) string {
+	return fmt.Sprint("edit-message-", messageID)
+}
+
+// Name of the SSE event sent when a message has been deleted
+func deleteMessageEvent(messageID int64) string {
+	return fmt.Sprint("delete-message-", messageID)
+}
+
+// Name of the SSE event sent when a thread has a new message
+func threadEvent(threadID int64) string {
+	return fmt.Sprint("thread-", threadID)
+}
+
+// Fetches a message from a chat that the user is a member of
+func getChatMessage(userID, chatID, messageID int64, conn database.Connection) (*database.Message, *resolverutils.HTTPError) {
+	chat, err := conn.GetChat(chatID, userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if chat == nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "chat not found",
+		}
+	}
+
+	message, err := conn.GetMessage(messageID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if message == nil || message.ChatID != chatID {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "message not found",
+		}
+	}
+	return message, nil
+}
+
+// Fetches the message that starts a thread, from a chat that the user is a member of
+func getThreadRoot(userID, chatID, messageID int64, conn database.Connection) (*database.Message, *resolverutils.HTTPError) {
+	message, httpError := getChatMessage(userID, chatID, messageID, conn)
+	if httpError != nil {
+		return nil, httpError
+	}
+	if !message.CanStartThread() {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "threads can only be started from a group chat message outside of a thread",
+		}
+	}
+	return message, nil
+}
+
+func threadDatabase(userID, chatID, messageID int64, conn database.Connection) (*database.Message, []database.Message, *resolverutils.HTTPError) {
+	message, httpError := getThreadRoot(userID, chatID, messageID, conn)
+	if httpError != nil {
+		return nil, nil, httpError
+	}
+
+	replies, err := conn.GetThreadMessages(messageID)
+	if err != nil {
+		return nil, nil, resolverutils.HandleDatabaseError(err)
+	}
+	return message, replies, nil
+}
+
+type getThreadOutput struct {
+	Message database.Message   `json:"message"`
+	Replies []database.Message `json:"replies"`
+}
+
+func GetThread(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	message, replies, httpError := threadDatabase(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteJSON(http.StatusOK, getThreadOutput{*message, replies})
+}
+
+type editMessageInput struct {
+	Content string `json:"content"`
+}
+
+func editMessageDatabase(userID, chatID, messageID int64, content string, conn database.Connection) (*database.MessageDatabase, *resolverutils.HTTPError) {
+	message, httpError := getChatMessage(userID, chatID, messageID, conn)
+	if httpError != nil {
+		return nil, httpError
+	}
+	if message.UserID != userID {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusForbidden,
+			Message: "only the author can edit a message",
+		}
+	}
+	if message.DeletedAt != nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "cannot edit a deleted message",
+		}
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "cannot send an empty message",
+		}
+	}
+	if httpError := validateMessageLength(content); httpError != nil {
+		return nil, httpError
+	}
+
+	updatedMessage, err := conn.UpdateMessage(messageID, content)
+	return updatedMessage, resolverutils.HandleDatabaseError(err)
+}
+
+func EditMessage(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input editMessageInput
+	user, params, httpError := resolverutils.GetRequestBodyAndContext(
+		r,
+		&input,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	message, httpError := editMessageDatabase(user.ID, params.ChatID, params.MessageID, input.Content, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	SendChatEvent(params.ChatID, editMessageEvent(message.ID), "")
+	w.WriteJSON(http.StatusOK, message)
+}
+
+func deleteMessageDatabase(userID, chatID, messageID int64, conn database.Connection) *resolverutils.HTTPError {
+	message, httpError := getChatMessage(userID, chatID, messageID, conn)
+	if httpError != nil {
+		return httpError
+	}
+	if message.UserID != userID {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusForbidden,
+			Message: "only the author can delete a message",
+		}
+	}
+
+	err := conn.DeleteMessage(messageID)
+	return resolverutils.HandleDatabaseError(err)
+}
+
+func DeleteMessage(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = deleteMessageDatabase(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	sendDeleteMessageEvents(params.ChatID, params.MessageID, conn)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetMessageRevisions(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	message, httpError := getChatMessage(user.ID, params.ChatID, params.MessageID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	// the earlier versions of a deleted message are hidden along with its content
+	if message.DeletedAt != nil {
+		resolverutils.ProcessHTTPError(w, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "message not found",
+		})
+		return
+	}
+
+	revisions, err := conn.GetMessageRevisions(params.MessageID)
+	if resolverutils.ProcessHTTPError(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+	w.WriteJSON(http.StatusOK, revisions)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/raphael-p/beango/database"
@@ -86,6 +87,116 @@ func TestGetChatMessages(t *testing.T) {
 		assert.IsNil(t, err)
 		assert.HasLength(t, *messages, 1)
 	})
+
+	t.Run("SeenBy", func(t *testing.T) {
+		userID1 := mocks.ADMIN_ID
+		var userID2 int64 = 12
+
+		conn, chatID := setupMessageTests(userID1, userID2)
+		w, req := makeMessageRequest(t, "", chatID)
+		first, _ := conn.SetMessage(mocks.MakeMessage(userID1, chatID))
+		conn.MarkChatRead(chatID, userID2, first.ID)
+		conn.SetMessage(mocks.MakeMessage(userID1, chatID))
+
+		GetChatMessages(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		messages := &[]database.Message{}
+		err := json.Unmarshal(w.Body, messages)
+		assert.IsNil(t, err)
+		assert.HasLength(t, *messages, 2)
+		assert.HasLength(t, (*messages)[0].SeenBy, 0)
+		assert.HasLength(t, (*messages)[1].SeenBy, 1)
+		assert.Equals(t, (*messages)[1].SeenBy[0].UserID, userID2)
+		assert.Equals(t, (*messages)[1].SeenBy[0].LastReadMessageID, first.ID)
+	})
+}
+
+func TestReadReceiptsDatabase(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		message, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chat.ID))
+		conn.MarkChatRead(chat.ID, user.ID, message.ID)
+
+		receipts, httpError := readReceiptsDatabase(mocks.ADMIN_ID, chat.ID, conn)
+		assert.IsNil(t, httpError)
+		assert.DeepEquals(t, receipts, []database.ReadReceipt{{
+			UserID:            user.ID,
+			UserDisplayName:   user.DisplayName,
+			LastReadMessageID: message.ID,
+		}})
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn, chatID := setupMessageTests(11, 12)
+		receipts, httpError := readReceiptsDatabase(mocks.ADMIN_ID, chatID, conn)
+		assert.IsNil(t, receipts)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+// Sets up a group chat with a message that starts a thread with one reply
+func setupThreadTests() (database.Connection, *database.Chat, *database.MessageDatabase) {
+	conn := mocks.MakeMockConnection()
+	chat, _ := conn.SetChat(mocks.MakeGroupChat(), mocks.ADMIN_ID, 12)
+	root, _ := conn.SetMessage(mocks.MakeMessage(12, chat.ID))
+	reply := mocks.MakeMessage(mocks.ADMIN_ID, chat.ID)
+	reply.ThreadID = &root.ID
+	conn.SetMessage(reply)
+	return conn, chat, root
+}
+
+func TestThreadDatabase(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+
+		message, replies, httpError := threadDatabase(mocks.ADMIN_ID, chat.ID, root.ID, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, message.ID, root.ID)
+		assert.Equals(t, message.ThreadReplyCount, int64(1))
+		assert.Equals(t, len(replies), 1)
+		assert.Equals(t, *replies[0].ThreadID, root.ID)
+	})
+
+	t.Run("ThreadReply", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+
+		_, _, httpError := threadDatabase(mocks.ADMIN_ID, chat.ID, root.ID+1, conn)
+		xMessage := "threads can only be started from a group chat message outside of a thread"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("PrivateChat", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+
+		_, _, httpError := threadDatabase(mocks.ADMIN_ID, chatID, message.ID, conn)
+		xMessage := "threads can only be started from a group chat message outside of a thread"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+
+		_, _, httpError := threadDatabase(13, chat.ID, root.ID, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+func TestGetThread(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+		w, req := makeMessageIDRequest(t, "", chat.ID, root.ID)
+
+		GetThread(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		output := getThreadOutput{}
+		err := json.Unmarshal(w.Body, &output)
+		assert.IsNil(t, err)
+		assert.Equals(t, output.Message.ID, root.ID)
+		assert.Equals(t, len(output.Replies), 1)
+	})
 }
 
 func TestSendMessage(t *testing.T) {
@@ -104,6 +215,20 @@ func TestSendMessage(t *testing.T) {
 		assert.Equals(t, message.ChatID, chatID)
 		assert.Equals(t, message.Content, content)
 	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		body := `{"content": "**Hello**, <World>!"}`
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, req := makeMessageRequest(t, body, chatID)
+
+		SendMessage(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusCreated)
+		var output map[string]any
+		err := json.Unmarshal(w.Body, &output)
+		assert.IsNil(t, err)
+		assert.Equals[any](t, output["content"], "**Hello**, <World>!")
+		assert.Equals[any](t, output["contentHTML"], "<strong>Hello</strong>, &lt;World&gt;!")
+	})
 }
 
 func TestSendMessageDatabase(t *testing.T) {
@@ -111,7 +236,7 @@ func TestSendMessageDatabase(t *testing.T) {
 
 	t.Run("Normal", func(t *testing.T) {
 		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
-		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, conn)
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, 0, 0, conn)
 		assert.IsNil(t, httpError)
 		assert.Equals(t, message.UserID, mocks.Admin.ID)
 		assert.Equals(t, message.ChatID, chatID)
@@ -121,7 +246,7 @@ func TestSendMessageDatabase(t *testing.T) {
 	t.Run("NoChat", func(t *testing.T) {
 		conn, chatID := setupMessageTests(0, 0)
 
-		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, conn)
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, 0, 0, conn)
 		assert.IsNil(t, message)
 		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
 	})
@@ -129,18 +254,266 @@ func TestSendMessageDatabase(t *testing.T) {
 	t.Run("NotChatUser", func(t *testing.T) {
 		conn, chatID := setupMessageTests(11, 12)
 
-		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, conn)
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, 0, 0, conn)
 		assert.IsNil(t, message)
 		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
 	})
 
+	t.Run("TooLong", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		_, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, strings.Repeat("é", MAX_MESSAGE_LENGTH), 0, 0, conn)
+		assert.IsNil(t, httpError)
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, strings.Repeat("a", MAX_MESSAGE_LENGTH+1), 0, 0, conn)
+		assert.IsNil(t, message)
+		xMessage := "message must be shorter than 5001 characters"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
 	t.Run("TrimsSpace", func(t *testing.T) {
 		paddedContent := " \n \r " + content + " \n \r "
 		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
-		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, paddedContent, conn)
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, paddedContent, 0, 0, conn)
 		assert.IsNil(t, httpError)
 		assert.Equals(t, message.UserID, mocks.Admin.ID)
 		assert.Equals(t, message.ChatID, chatID)
 		assert.Equals(t, message.Content, content)
 	})
+
+	t.Run("Reply", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, original.ID, 0, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, *message.ReplyToMessageID, original.ID)
+		messages, _ := conn.GetMessagesByChatID(chatID, 0, 0, 0)
+		assert.Equals(t, *messages[0].ReplyToMessageID, original.ID)
+		assert.Equals(t, messages[0].ReplyToSnippet, original.Content)
+	})
+
+	t.Run("Thread", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chat.ID, content, 0, root.ID, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, *message.ThreadID, root.ID)
+		messages, _ := conn.GetMessagesByChatID(chat.ID, 0, 0, 0)
+		assert.Equals(t, len(messages), 1) // thread replies are left out
+		assert.Equals(t, messages[0].ThreadReplyCount, int64(2))
+	})
+
+	t.Run("ThreadInPrivateChat", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, 0, original.ID, conn)
+		assert.IsNil(t, message)
+		xMessage := "threads can only be started from a group chat message outside of a thread"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("ReplyInThread", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chat.ID, content, root.ID, root.ID, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, *message.ReplyToMessageID, root.ID)
+	})
+
+	t.Run("ReplyToOtherThread", func(t *testing.T) {
+		conn, chat, root := setupThreadTests()
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chat.ID, content, root.ID+1, 0, conn)
+		assert.IsNil(t, message)
+		xMessage := "cannot reply to a message from another thread"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("ReplyToOtherChat", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		otherChat, _ := conn.SetChat(mocks.MakePrivateChat(), mocks.ADMIN_ID, 13)
+		original, _ := conn.SetMessage(mocks.MakeMessage(13, otherChat.ID))
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, original.ID, 0, conn)
+		assert.IsNil(t, message)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "message to reply to not found")
+	})
+
+	t.Run("ReplyToDeletedMessage", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+		conn.DeleteMessage(original.ID)
+
+		message, httpError := sendMessageDatabase(mocks.ADMIN_ID, chatID, content, original.ID, 0, conn)
+		assert.IsNil(t, message)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "cannot reply to a deleted message")
+	})
+}
+
+func makeMessageIDRequest(t *testing.T, body string, chatID, messageID int64) (*response.Writer, *http.Request) {
+	w, req, _ := resolverutils.CommonSetup(body)
+	params := map[string]string{
+		resolverutils.CHAT_ID_KEY:    fmt.Sprint(chatID),
+		resolverutils.MESSAGE_ID_KEY: fmt.Sprint(messageID),
+	}
+	req = resolverutils.SetContext(t, req, mocks.Admin, params)
+	return w, req
+}
+
+func TestEditMessageDatabase(t *testing.T) {
+	content := "Hello again, World!"
+
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+
+		message, httpError := editMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, " "+content+" ", conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, message.Content, content)
+		revisions, _ := conn.GetMessageRevisions(original.ID)
+		assert.HasLength(t, revisions, 1)
+		assert.Equals(t, revisions[0].Content, original.Content)
+	})
+
+	t.Run("NotAuthor", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+
+		message, httpError := editMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, content, conn)
+		assert.IsNil(t, message)
+		xMessage := "only the author can edit a message"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, xMessage)
+	})
+
+	t.Run("MessageInOtherChat", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		otherChat, _ := conn.SetChat(mocks.MakePrivateChat(), mocks.ADMIN_ID, 13)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, otherChat.ID))
+
+		message, httpError := editMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, content, conn)
+		assert.IsNil(t, message)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "message not found")
+	})
+
+	t.Run("EmptyContent", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+
+		message, httpError := editMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, " \n ", conn)
+		assert.IsNil(t, message)
+		xMessage := "cannot send an empty message"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+
+		message, httpError := editMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, strings.Repeat("a", MAX_MESSAGE_LENGTH+1), conn)
+		assert.IsNil(t, message)
+		xMessage := "message must be shorter than 5001 characters"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+}
+
+func TestEditDeletedMessage(t *testing.T) {
+	conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+	original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+	conn.DeleteMessage(original.ID)
+
+	message, httpError := editMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, "new content", conn)
+	assert.IsNil(t, message)
+	xMessage := "cannot edit a deleted message"
+	resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+}
+
+func TestEditMessage(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		content := "Hello again, World!"
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+		w, req := makeMessageIDRequest(t, fmt.Sprintf(`{"content": "%s"}`, content), chatID, original.ID)
+
+		EditMessage(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		message := &database.MessageDatabase{}
+		err := json.Unmarshal(w.Body, message)
+		assert.IsNil(t, err)
+		assert.Equals(t, message.Content, content)
+		assert.Equals(t, message.LastUpdatedAt.After(message.CreatedAt), true)
+	})
+}
+
+func TestGetMessageRevisions(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+		conn.UpdateMessage(original.ID, "second version")
+		conn.UpdateMessage(original.ID, "third version")
+		w, req := makeMessageIDRequest(t, "", chatID, original.ID)
+
+		GetMessageRevisions(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		revisions := &[]database.MessageRevision{}
+		err := json.Unmarshal(w.Body, revisions)
+		assert.IsNil(t, err)
+		assert.HasLength(t, *revisions, 2)
+	})
+
+	t.Run("DeletedMessage", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+		conn.UpdateMessage(original.ID, "second version")
+		conn.DeleteMessage(original.ID)
+		w, req := makeMessageIDRequest(t, "", chatID, original.ID)
+
+		GetMessageRevisions(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "message not found")
+	})
+}
+
+func TestDeleteMessageDatabase(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+
+		httpError := deleteMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, conn)
+		assert.IsNil(t, httpError)
+		messages, _ := conn.GetMessagesByChatID(chatID, 0, 0, 0)
+		assert.HasLength(t, messages, 1)
+		assert.IsNotNil(t, messages[0].DeletedAt)
+		assert.Equals(t, messages[0].Content, database.DELETED_MESSAGE_CONTENT)
+	})
+
+	t.Run("NotAuthor", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+
+		httpError := deleteMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, conn)
+		xMessage := "only the author can delete a message"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, xMessage)
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn, chatID := setupMessageTests(11, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(11, chatID))
+
+		httpError := deleteMessageDatabase(mocks.ADMIN_ID, chatID, original.ID, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+func TestDeleteMessage(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		original, _ := conn.SetMessage(mocks.MakeMessage(mocks.ADMIN_ID, chatID))
+		w, req := makeMessageIDRequest(t, "", chatID, original.ID)
+
+		DeleteMessage(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		message, _ := conn.GetMessage(original.ID)
+		assert.IsNotNil(t, message.DeletedAt)
+	})
 }
@@ -0,0 +1,129 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+// Emojis can be made of several code points, e.g. with skin tones or joiners
+const MAX_EMOJI_LENGTH int = 8
+
+// Name of the SSE event sent when the reactions to a message change, its
+// data is a reactionEventData
+func reactionEvent(messageID int64) string {
+	return fmt.Sprint("reaction-", messageID)
+}
+
+type reactionEventData struct {
+	ChatID    int64                   `json:"chatID"`
+	MessageID int64                   `json:"messageID"`
+	Reactions database.ReactionCounts `json:"reactions"`
+}
+
+func sendReactionEvent(chatID, messageID int64, reactions database.ReactionCounts) {
+	data, _ := json.Marshal(reactionEventData{chatID, messageID, reactions})
+	SendChatEvent(chatID, reactionEvent(messageID), string(data))
+}
+
+// Only checks that the reaction is short and has no plain text in it, which
+// also keeps it safe to embed in the templates
+func validateEmoji(emoji string) *resolverutils.HTTPError {
+	length := utf8.RuneCountInString(emoji)
+	isInvalid := length == 0 || length > MAX_EMOJI_LENGTH || strings.ContainsFunc(emoji, func(r rune) bool {
+		return r < utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r)
+	})
+	if isInvalid {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "reaction must be an emoji",
+		}
+	}
+	return nil
+}
+
+// Adds or removes the user's reaction, then fetches all the reactions to the message
+func reactDatabase(userID, chatID, messageID int64, emoji string, isAdding bool, conn database.Connection) (database.ReactionCounts, *resolverutils.HTTPError) {
+	message, httpError := getChatMessage(userID, chatID, messageID, conn)
+	if httpError != nil {
+		return nil, httpError
+	}
+	if httpError := validateEmoji(emoji); httpError != nil {
+		return nil, httpError
+	}
+
+	var err error
+	if isAdding {
+		if message.DeletedAt != nil {
+			return nil, &resolverutils.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: "cannot react to a deleted message",
+			}
+		}
+		err = conn.AddReaction(messageID, userID, emoji)
+	} else {
+		err = conn.RemoveReaction(messageID, userID, emoji)
+	}
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+
+	message, err = conn.GetMessage(messageID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return message.Reactions, nil
+}
+
+type reactionInput struct {
+	Emoji string `json:"emoji"`
+}
+
+func AddReaction(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input reactionInput
+	user, params, httpError := resolverutils.GetRequestBodyAndContext(
+		r,
+		&input,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	reactions, httpError := reactDatabase(user.ID, params.ChatID, params.MessageID, input.Emoji, true, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	sendReactionEvent(params.ChatID, params.MessageID, reactions)
+	w.WriteJSON(http.StatusOK, reactions)
+}
+
+func RemoveReaction(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(
+		r,
+		resolverutils.CHAT_ID_KEY,
+		resolverutils.MESSAGE_ID_KEY,
+	)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	emoji, httpError := resolverutils.GetRequestQueryParam(r, "emoji", true)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	reactions, httpError := reactDatabase(user.ID, params.ChatID, params.MessageID, emoji, false, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	sendReactionEvent(params.ChatID, params.MessageID, reactions)
+	w.WriteJSON(http.StatusOK, reactions)
+}
@@ -0,0 +1,119 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+)
+
+func TestValidateEmoji(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		for _, emoji := range []string{"👍", "❤️", "👍🏽", "👩‍👩‍👧"} {
+			assert.IsNil(t, validateEmoji(emoji))
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, emoji := range []string{"", "a", "👍 ", `"`, "é", "👍👍👍👍👍👍👍👍👍"} {
+			httpError := validateEmoji(emoji)
+			resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "reaction must be an emoji")
+		}
+	})
+}
+
+func TestReactDatabase(t *testing.T) {
+	t.Run("AddAndRemove", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+		conn.AddReaction(message.ID, 12, "👍")
+
+		reactions, httpError := reactDatabase(mocks.ADMIN_ID, chatID, message.ID, "👍", true, conn)
+		assert.IsNil(t, httpError)
+		assert.DeepEquals(t, reactions, database.ReactionCounts{
+			{Emoji: "👍", Count: 2, UserIDs: []int64{12, mocks.ADMIN_ID}},
+		})
+
+		reactions, _ = reactDatabase(mocks.ADMIN_ID, chatID, message.ID, "👍", true, conn)
+		assert.Equals(t, reactions[0].Count, int64(2)) // reacting twice has no effect
+
+		reactions, httpError = reactDatabase(mocks.ADMIN_ID, chatID, message.ID, "👍", false, conn)
+		assert.IsNil(t, httpError)
+		assert.DeepEquals(t, reactions, database.ReactionCounts{
+			{Emoji: "👍", Count: 1, UserIDs: []int64{12}},
+		})
+	})
+
+	t.Run("DeletedMessage", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+		conn.DeleteMessage(message.ID)
+
+		_, httpError := reactDatabase(mocks.ADMIN_ID, chatID, message.ID, "👍", true, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "cannot react to a deleted message")
+	})
+
+	t.Run("NotChatUser", func(t *testing.T) {
+		conn, chatID := setupMessageTests(11, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+
+		_, httpError := reactDatabase(mocks.ADMIN_ID, chatID, message.ID, "👍", true, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+func TestAddReaction(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+		w, req := makeMessageIDRequest(t, `{"emoji": "😂"}`, chatID, message.ID)
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, chatID}, 1)
+
+		AddReaction(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		var reactions database.ReactionCounts
+		assert.IsNil(t, json.Unmarshal(w.Body, &reactions))
+		assert.Equals(t, reactions[0].Emoji, "😂")
+
+		event, _ := receiveEvent(t, client)
+		assert.Equals(t, event.event, reactionEvent(message.ID))
+		xData := fmt.Sprintf(
+			`{"chatID":%d,"messageID":%d,"reactions":[{"emoji":"😂","count":1,"userIDs":[%d]}]}`,
+			chatID, message.ID, mocks.ADMIN_ID,
+		)
+		assert.Equals(t, event.data, xData)
+	})
+}
+
+func TestRemoveReaction(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+		conn.AddReaction(message.ID, mocks.ADMIN_ID, "😂")
+		w, req := makeMessageIDRequest(t, "", chatID, message.ID)
+		req.URL.RawQuery = "emoji=%F0%9F%98%82"
+
+		RemoveReaction(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Equals(t, string(w.Body), "[]")
+	})
+
+	t.Run("MissingEmoji", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		message, _ := conn.SetMessage(mocks.MakeMessage(12, chatID))
+		w, req := makeMessageIDRequest(t, "", chatID, message.ID)
+
+		RemoveReaction(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,153 @@
+package resolvers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raphael-p/beango/client"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/mailer"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+const (
+	PASSWORD_RESET_PURPOSE string = "password-reset"
+	PASSWORD_RESET_SECONDS int    = 30 * 60
+)
+
+type forgotPasswordInput struct {
+	Username string `json:"username"`
+}
+
+// Emails a link to reset the password of a user, if they have a verified
+// email address. Nothing tells the caller whether an email was sent, so that
+// this does not reveal which accounts have an email address.
+func forgotPasswordDatabase(r *http.Request, username string, conn database.Connection) *resolverutils.HTTPError {
+	countAttempt(r)
+	user, err := conn.GetUserByUsername(username)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if user == nil || !user.HasVerifiedEmail() {
+		return nil
+	}
+
+	reset := database.PasswordReset{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		ExpiryDate: time.Now().UTC().Add(time.Duration(PASSWORD_RESET_SECONDS) * time.Second),
+	}
+	if err := conn.SetPasswordReset(reset); err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+
+	token := authenticate.NewSignedToken(PASSWORD_RESET_PURPOSE, reset.ExpiryDate, reset.ID)
+	return sendEmail(mailer.Message{
+		To:      *user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\n"+
+				"Someone asked to reset the password of your Beango account, %s. "+
+				"To choose a new password, follow this link within %d minutes:\n\n"+
+				"%s\n\n"+
+				"If it was not you, you can ignore this email, your password is unchanged.\n",
+			user.DisplayName,
+			user.Username,
+			PASSWORD_RESET_SECONDS/60,
+			makeEmailLink("/login/reset", token),
+		),
+	})
+}
+
+func ForgotPassword(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input forgotPasswordInput
+	if resolverutils.ProcessHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
+		return
+	}
+
+	if resolverutils.ProcessHTTPError(w, forgotPasswordDatabase(r, input.Username, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ForgotPasswordHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input forgotPasswordInput
+	if resolverutils.DisplayHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
+		return
+	}
+
+	if resolverutils.DisplayHTTPError(w, forgotPasswordDatabase(r, input.Username, conn)) {
+		return
+	}
+	w.WriteString(http.StatusOK, client.ForgotPasswordSent)
+}
+
+type resetPasswordInput struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// Sets a new password with a reset token, and logs the user out everywhere
+func resetPasswordDatabase(r *http.Request, input *resetPasswordInput, conn database.Connection) *resolverutils.HTTPError {
+	invalid := &resolverutils.HTTPError{
+		Status:  http.StatusBadRequest,
+		Message: "this link is invalid or has expired",
+	}
+	fields, err := authenticate.ParseSignedToken(PASSWORD_RESET_PURPOSE, input.Token, time.Now())
+	if err != nil || len(fields) != 1 {
+		recordLoginAttempt(r, invalid)
+		return invalid
+	}
+
+	// checking the password first, so that the reset is not used up by one that is rejected
+	if httpError := validatePassword(input.NewPassword); httpError != nil {
+		return httpError
+	}
+	hash, httpError := hashPassword(input.NewPassword)
+	if httpError != nil {
+		return httpError
+	}
+	reset, err := conn.UsePasswordReset(fields[0])
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if reset == nil {
+		recordLoginAttempt(r, invalid)
+		return invalid
+	}
+	recordLoginAttempt(r, nil)
+
+	if err := conn.UpdateUserKey(reset.UserID, hash); err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	return resolverutils.HandleDatabaseError(conn.DeleteOtherSessions(reset.UserID, ""))
+}
+
+func ResetPassword(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input resetPasswordInput
+	if resolverutils.ProcessHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
+		return
+	}
+
+	if resolverutils.ProcessHTTPError(w, resetPasswordDatabase(r, &input, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ResetPasswordHTML(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input resetPasswordInput
+	if resolverutils.DisplayHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
+		return
+	}
+
+	if resolverutils.DisplayHTTPError(w, resetPasswordDatabase(r, &input, conn)) {
+		return
+	}
+	w.WriteString(http.StatusOK, client.PasswordResetDone)
+}
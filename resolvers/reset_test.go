@@ -0,0 +1,220 @@
+package resolvers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/ratelimit"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/context"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Gives the admin a verified email address
+func verifyAdminEmail(conn database.Connection) string {
+	email := "admin@example.com"
+	conn.SetUserEmail(mocks.ADMIN_ID, &email)
+	conn.VerifyUserEmail(mocks.ADMIN_ID, email)
+	return email
+}
+
+func TestForgotPasswordDatabase(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		email := verifyAdminEmail(conn)
+
+		httpError := forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, len(mockMailer.Messages), 1)
+		message := mockMailer.Messages[0]
+		assert.Equals(t, message.To, email)
+		assert.Contains(t, message.Body, config.Values.Mail.BaseURL+"/login/reset?token=")
+	})
+
+	t.Run("UnverifiedEmail", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		email := "admin@example.com"
+		conn.SetUserEmail(mocks.ADMIN_ID, &email)
+
+		httpError := forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, len(mockMailer.Messages), 0)
+	})
+
+	t.Run("NoEmail", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+
+		httpError := forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, len(mockMailer.Messages), 0)
+	})
+
+	t.Run("CountsEveryRequest", func(t *testing.T) {
+		useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		verifyAdminEmail(conn)
+		policy := ratelimit.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Hour}
+		limiter := ratelimit.NewLimiter(ratelimit.NewLocalStore(), policy)
+		username := ratelimit.Key{Value: "reset:username:" + mocks.ADMIN_USERNAME, ClearOnSuccess: true}
+		r = context.SetAttempt(r, limiter.NewAttempt(username))
+
+		forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		wait, _ := limiter.Check(username)
+		assert.Equals(t, wait, time.Duration(0))
+		forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		wait, _ = limiter.Check(username)
+		assert.Equals(t, wait > 0, true)
+	})
+
+	t.Run("UserNotFound", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+
+		httpError := forgotPasswordDatabase(r, "nobody", conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, len(mockMailer.Messages), 0)
+	})
+}
+
+func TestResetPasswordDatabase(t *testing.T) {
+	config.CreateConfig()
+	invalidMessage := "this link is invalid or has expired"
+
+	setup := func(t *testing.T) (string, *http.Request, database.Connection) {
+		mockMailer := useMockMailer(t)
+		_, r, conn := resolverutils.CommonSetup("")
+		verifyAdminEmail(conn)
+		forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		return linkToken(t, mockMailer.Messages[0].Body), r, conn
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		token, r, conn := setup(t)
+		xPassword := "a new password"
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{token, xPassword}, conn)
+		assert.IsNil(t, httpError)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.IsNil(t, bcrypt.CompareHashAndPassword(user.Key, []byte(xPassword)))
+		sessions, _ := conn.GetSessionsByUserID(mocks.ADMIN_ID)
+		assert.HasLength(t, sessions, 0)
+	})
+
+	t.Run("UsedTwice", func(t *testing.T) {
+		token, r, conn := setup(t)
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{token, "a new password"}, conn)
+		assert.IsNil(t, httpError)
+		httpError = resetPasswordDatabase(r, &resetPasswordInput{token, "another password"}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, invalidMessage)
+	})
+
+	t.Run("OtherLinksInvalidated", func(t *testing.T) {
+		token, r, conn := setup(t)
+		useMockMailer(t)
+		forgotPasswordDatabase(r, mocks.ADMIN_USERNAME, conn)
+		otherToken := linkToken(t, emailSender.(*mocks.Mailer).Messages[0].Body)
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{otherToken, "a new password"}, conn)
+		assert.IsNil(t, httpError)
+		httpError = resetPasswordDatabase(r, &resetPasswordInput{token, "another password"}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, invalidMessage)
+	})
+
+	t.Run("BlankPassword", func(t *testing.T) {
+		token, r, conn := setup(t)
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{token, "  "}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "password may not be blank")
+		httpError = resetPasswordDatabase(r, &resetPasswordInput{token, "a new password"}, conn)
+		assert.IsNil(t, httpError)
+	})
+
+	t.Run("RecordsAttempts", func(t *testing.T) {
+		token, r, conn := setup(t)
+		policy := ratelimit.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Hour}
+		limiter := ratelimit.NewLimiter(ratelimit.NewLocalStore(), policy)
+		ip := ratelimit.Key{Value: "reset:ip:192.0.2.1"}
+		r = context.SetAttempt(r, limiter.NewAttempt(ip))
+
+		resetPasswordDatabase(r, &resetPasswordInput{token[1:], "a new password"}, conn)
+		wait, _ := limiter.Check(ip)
+		assert.Equals(t, wait, time.Duration(0))
+		resetPasswordDatabase(r, &resetPasswordInput{token[2:], "a new password"}, conn)
+		wait, _ = limiter.Check(ip)
+		assert.Equals(t, wait > 0, true)
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		token, r, conn := setup(t)
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{token[1:], "a new password"}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, invalidMessage)
+	})
+
+	t.Run("ExpiredToken", func(t *testing.T) {
+		_, r, conn := resolverutils.CommonSetup("")
+		reset := database.PasswordReset{
+			ID:         "expired-reset",
+			UserID:     mocks.ADMIN_ID,
+			ExpiryDate: time.Now().UTC().Add(-time.Second),
+		}
+		conn.SetPasswordReset(reset)
+		token := authenticate.NewSignedToken(PASSWORD_RESET_PURPOSE, reset.ExpiryDate, reset.ID)
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{token, "a new password"}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, invalidMessage)
+	})
+
+	t.Run("ExpiredReset", func(t *testing.T) {
+		_, r, conn := resolverutils.CommonSetup("")
+		reset := database.PasswordReset{
+			ID:         "expired-reset",
+			UserID:     mocks.ADMIN_ID,
+			ExpiryDate: time.Now().UTC().Add(-time.Second),
+		}
+		conn.SetPasswordReset(reset)
+		// the signature alone does not make the reset valid
+		token := authenticate.NewSignedToken(PASSWORD_RESET_PURPOSE, time.Now().Add(time.Hour), reset.ID)
+
+		httpError := resetPasswordDatabase(r, &resetPasswordInput{token, "a new password"}, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, invalidMessage)
+	})
+}
+
+func TestPasswordResetHTML(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		mockMailer := useMockMailer(t)
+		w, req, conn := resolverutils.CommonSetup(fmt.Sprintf(`{"username": "%s"}`, mocks.ADMIN_USERNAME))
+		verifyAdminEmail(conn)
+
+		ForgotPasswordHTML(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), `hx-swap-oob="true"`, "a link to reset its password")
+		assert.Equals(t, len(mockMailer.Messages), 1)
+
+		token := linkToken(t, mockMailer.Messages[0].Body)
+		resetBody := fmt.Sprintf(`{"token": "%s", "newPassword": "a new password"}`, token)
+		w, req, _ = resolverutils.CommonSetup(resetBody)
+
+		ResetPasswordHTML(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "Your password has been reset", `href="/login"`)
+		_, httpError := checkCredentials(mocks.ADMIN_USERNAME, "a new password", conn)
+		assert.IsNil(t, httpError)
+	})
+}
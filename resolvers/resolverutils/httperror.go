@@ -42,3 +42,23 @@ func DisplayHTTPError(w *response.Writer, httpError *HTTPError) bool {
 	w.WriteString(http.StatusOK, htmlStr)
 	return true
 }
+
+// Like DisplayHTTPError, but also tells HTMX to leave the request target as it is
+func DisplayHTTPErrorNoSwap(w *response.Writer, httpError *HTTPError) bool {
+	if httpError == nil {
+		return false
+	}
+	w.Header().Set("HX-Reswap", "none")
+	return DisplayHTTPError(w, httpError)
+}
+
+// Like DisplayHTTPError, but keeps the status of the error. HTMX only swaps
+// error responses with the statuses allowed in script.js.
+func DisplayHTTPErrorWithStatus(w *response.Writer, httpError *HTTPError) bool {
+	if httpError == nil {
+		return false
+	}
+	htmlStr := fmt.Sprintf("<div id='errors' hx-swap-oob='innerHTML'>%s</div>", httpError.Message)
+	w.WriteString(httpError.Status, htmlStr)
+	return true
+}
@@ -72,3 +72,25 @@ func TestDisplayHTTPError(t *testing.T) {
 		assert.Equals(t, string(w.Body), "")
 	})
 }
+
+func TestDisplayHTTPErrorNoSwap(t *testing.T) {
+	t.Run("WithError", func(t *testing.T) {
+		xError := &HTTPError{100, "this is a message"}
+		w := response.NewWriter(httptest.NewRecorder())
+
+		hasError := DisplayHTTPErrorNoSwap(w, xError)
+		assert.Equals(t, hasError, true)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Equals(t, w.Header().Get("HX-Reswap"), "none")
+		assert.Contains(t, string(w.Body), fmt.Sprintf(">%s<", xError.Message))
+	})
+
+	t.Run("WithoutError", func(t *testing.T) {
+		w := response.NewWriter(httptest.NewRecorder())
+
+		hasError := DisplayHTTPErrorNoSwap(w, nil)
+		assert.Equals(t, hasError, false)
+		assert.Equals(t, w.Header().Get("HX-Reswap"), "")
+		assert.Equals(t, string(w.Body), "")
+	})
+}
@@ -3,6 +3,7 @@ package resolverutils
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -94,7 +95,7 @@ func GetRequestQueryParam(r *http.Request, key string, isRequired bool) (string,
 // Calls GetRequestQueryParam, then casts the result to an integer
 func GetRequestQueryParamInt(r *http.Request, key string, isRequired bool) (int64, *HTTPError) {
 	value, httpError := GetRequestQueryParam(r, key, isRequired)
-	if httpError != nil {
+	if httpError != nil || value == "" { // an optional parameter may be missing
 		return 0, httpError
 	}
 	var intValue int64
@@ -106,3 +107,12 @@ func GetRequestQueryParamInt(r *http.Request, key string, isRequired bool) (int6
 	}
 	return intValue, nil
 }
+
+// Gets the IP address of the client that sent the request
+func GetRequestIPAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -82,7 +82,7 @@ func TestGetRequestContext(t *testing.T) {
 		user, routeParams, httpError := GetRequestContext(req, key1, key2)
 		assert.IsNil(t, httpError)
 		assert.DeepEquals(t, user, xUser)
-		assert.DeepEquals(t, routeParams, &RouteParams{"value1", 0, "value2"})
+		assert.DeepEquals(t, routeParams, &RouteParams{Username: "value1", ChatName: "value2"})
 	})
 
 	t.Run("ParamExtractionFails", func(t *testing.T) {
@@ -182,4 +182,32 @@ func TestGetRequestQueryParamInt(t *testing.T) {
 		xMessage := fmt.Sprintf("query parameter '%s' must be an integer", key)
 		assert.Equals(t, httpError.Message, xMessage)
 	})
+
+	t.Run("MissingOptional", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/path", nil)
+		intValue, httpError := GetRequestQueryParamInt(req, "someKey", false)
+
+		assert.IsNil(t, httpError)
+		assert.Equals(t, intValue, 0)
+	})
+}
+
+func TestGetRequestIPAddress(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		_, req, _ := CommonSetup("")
+		req.RemoteAddr = "192.168.0.7:52110"
+		assert.Equals(t, GetRequestIPAddress(req), "192.168.0.7")
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		_, req, _ := CommonSetup("")
+		req.RemoteAddr = "[::1]:52110"
+		assert.Equals(t, GetRequestIPAddress(req), "::1")
+	})
+
+	t.Run("NoPort", func(t *testing.T) {
+		_, req, _ := CommonSetup("")
+		req.RemoteAddr = "192.168.0.7"
+		assert.Equals(t, GetRequestIPAddress(req), "192.168.0.7")
+	})
 }
@@ -10,16 +10,26 @@ import (
 )
 
 const (
-	USERNAME_KEY  = "username"
-	CHAT_ID_KEY   = "chatID"
-	CHAT_NAME_KEY = "chatName"
-	ACTION_KEY    = "action"
+	USERNAME_KEY      = "username"
+	CHAT_ID_KEY       = "chatID"
+	CHAT_NAME_KEY     = "chatName"
+	ACTION_KEY        = "action"
+	USER_ID_KEY       = "userID"
+	MESSAGE_ID_KEY    = "messageID"
+	SESSION_ID_KEY    = "sessionID"
+	ATTACHMENT_ID_KEY = "attachmentID"
+	TOKEN_ID_KEY      = "tokenID"
 )
 
 type RouteParams struct {
-	Username string
-	ChatID   int64
-	ChatName string
+	Username     string
+	ChatID       int64
+	ChatName     string
+	UserID       int64
+	MessageID    int64
+	SessionID    string
+	AttachmentID int64
+	TokenID      int64
 }
 
 func extractRouteParams(r *http.Request, paramKeys ...string) (*RouteParams, *HTTPError) {
@@ -48,6 +58,44 @@ func extractRouteParams(r *http.Request, paramKeys ...string) (*RouteParams, *HT
 			routeParams.ChatID = chatID
 		case CHAT_NAME_KEY:
 			routeParams.ChatName = value
+		case USER_ID_KEY:
+			userID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, &HTTPError{
+					http.StatusBadRequest,
+					"user ID must be an integer",
+				}
+			}
+			routeParams.UserID = userID
+		case MESSAGE_ID_KEY:
+			messageID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, &HTTPError{
+					http.StatusBadRequest,
+					"message ID must be an integer",
+				}
+			}
+			routeParams.MessageID = messageID
+		case SESSION_ID_KEY:
+			routeParams.SessionID = value
+		case ATTACHMENT_ID_KEY:
+			attachmentID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, &HTTPError{
+					http.StatusBadRequest,
+					"attachment ID must be an integer",
+				}
+			}
+			routeParams.AttachmentID = attachmentID
+		case TOKEN_ID_KEY:
+			tokenID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, &HTTPError{
+					http.StatusBadRequest,
+					"token ID must be an integer",
+				}
+			}
+			routeParams.TokenID = tokenID
 		default:
 			message := "invalid route param key: " + paramKey
 			logger.Error(message)
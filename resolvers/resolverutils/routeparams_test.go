@@ -26,7 +26,7 @@ func TestExtractRouteParams(t *testing.T) {
 
 		routeParams, httpError := extractRouteParams(req, key1, key2)
 		assert.IsNil(t, httpError)
-		assert.DeepEquals(t, routeParams, &RouteParams{"value1", 0, "value2"})
+		assert.DeepEquals(t, routeParams, &RouteParams{Username: "value1", ChatName: "value2"})
 	})
 
 	t.Run("ExtraRequestParam", func(t *testing.T) {
@@ -37,7 +37,7 @@ func TestExtractRouteParams(t *testing.T) {
 
 		params, httpError := extractRouteParams(req, key)
 		assert.IsNil(t, httpError)
-		assert.DeepEquals(t, params, &RouteParams{"value1", 0, ""})
+		assert.DeepEquals(t, params, &RouteParams{Username: "value1"})
 	})
 
 	t.Run("NoParamKeysPassed", func(t *testing.T) {
@@ -68,4 +68,31 @@ func TestExtractRouteParams(t *testing.T) {
 		xMessage := "chat ID must be an integer"
 		AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
 	})
+
+	t.Run("TokenIDNotAnInt", func(t *testing.T) {
+		key := TOKEN_ID_KEY
+		req := setup(map[string]string{key: "some-value"})
+
+		_, httpError := extractRouteParams(req, key)
+		xMessage := "token ID must be an integer"
+		AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("UserIDNotAnInt", func(t *testing.T) {
+		key := USER_ID_KEY
+		req := setup(map[string]string{key: "some-value"})
+
+		_, httpError := extractRouteParams(req, key)
+		xMessage := "user ID must be an integer"
+		AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("MessageIDNotAnInt", func(t *testing.T) {
+		key := MESSAGE_ID_KEY
+		req := setup(map[string]string{key: "some-value"})
+
+		_, httpError := extractRouteParams(req, key)
+		xMessage := "message ID must be an integer"
+		AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
 }
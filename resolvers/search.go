@@ -0,0 +1,96 @@
+package resolvers
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+const SEARCH_PAGE_SIZE int = 20
+
+type searchResultOutput struct {
+	database.MessageSearchResult
+	// Escaped content, where the matching words are wrapped in <mark> tags
+	Snippet template.HTML `json:"snippet"`
+}
+
+type searchMessagesOutput struct {
+	Results []searchResultOutput `json:"results"`
+	// The cursor to fetch the next page with, 0 if there are no more results
+	NextCursor int64 `json:"nextCursor"`
+}
+
+// Escapes the snippet of a search result, then highlights its matching words
+func highlightSnippet(snippet string) template.HTML {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, database.SEARCH_MATCH_START, "<mark>")
+	snippet = strings.ReplaceAll(snippet, database.SEARCH_MATCH_END, "</mark>")
+	return template.HTML(snippet)
+}
+
+// Searches the messages of the user's chats, a page at a time. The cursor is
+// the NextCursor of the previous page, or 0 for the first page.
+func searchMessagesDatabase(userID int64, query string, cursor int64, conn database.Connection) (*searchMessagesOutput, *resolverutils.HTTPError) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "search query cannot be empty",
+		}
+	}
+
+	// one extra result tells whether there is another page
+	results, err := conn.SearchMessages(userID, query, cursor, SEARCH_PAGE_SIZE+1)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	output := &searchMessagesOutput{Results: make([]searchResultOutput, 0, len(results))}
+	if len(results) > SEARCH_PAGE_SIZE {
+		results = results[:SEARCH_PAGE_SIZE]
+		output.NextCursor = results[SEARCH_PAGE_SIZE-1].ID
+	}
+
+	// private chats are named after their members, resolved once per chat
+	chatNames := make(map[int64]string)
+	for _, result := range results {
+		if result.ChatName == "" {
+			if _, ok := chatNames[result.ChatID]; !ok {
+				users, err := conn.GetUsersByChatID(result.ChatID)
+				if err != nil {
+					return nil, resolverutils.HandleDatabaseError(err)
+				}
+				chatNames[result.ChatID] = generateChatName(userID, users)
+			}
+			result.ChatName = chatNames[result.ChatID]
+		}
+		output.Results = append(output.Results, searchResultOutput{result, highlightSnippet(result.Snippet)})
+	}
+	return output, nil
+}
+
+func SearchMessages(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	query, httpError := resolverutils.GetRequestQueryParam(r, "q", true)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	cursor, httpError := resolverutils.GetRequestQueryParamInt(r, "cursor", false)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	output, httpError := searchMessagesDatabase(user.ID, query, cursor, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteJSON(http.StatusOK, output)
+}
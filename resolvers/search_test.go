@@ -0,0 +1,120 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"testing"
+
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := "<b>" + database.SEARCH_MATCH_START + "beans" + database.SEARCH_MATCH_END + "</b> & toast"
+	assert.Equals(t, highlightSnippet(snippet), template.HTML("&lt;b&gt;<mark>beans</mark>&lt;/b&gt; &amp; toast"))
+}
+
+func TestSearchMessagesDatabase(t *testing.T) {
+	setup := func(contents ...string) (database.Connection, int64) {
+		conn, _ := setupMessageTests(0, 0)
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), mocks.ADMIN_ID, user.ID)
+		for _, content := range contents {
+			message := mocks.MakeMessage(user.ID, chat.ID)
+			message.Content = content
+			conn.SetMessage(message)
+		}
+		return conn, chat.ID
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setup("I like beans", "I like toast", "Beans on toast")
+
+		output, httpError := searchMessagesDatabase(mocks.ADMIN_ID, " beans ", 0, conn)
+		assert.IsNil(t, httpError)
+		assert.HasLength(t, output.Results, 2)
+		assert.Equals(t, output.NextCursor, int64(0))
+		result := output.Results[0]
+		assert.Equals(t, result.ID, int64(3))
+		assert.Equals(t, result.ChatID, chatID)
+		assert.Equals(t, result.ChatName, "Johnny D")
+		assert.Equals(t, result.UserDisplayName, "Johnny D")
+		assert.Equals(t, result.Snippet, template.HTML("<mark>Beans</mark> on toast"))
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		contents := make([]string, SEARCH_PAGE_SIZE+5)
+		for i := range contents {
+			contents[i] = "beans"
+		}
+		conn, _ := setup(contents...)
+
+		output, _ := searchMessagesDatabase(mocks.ADMIN_ID, "beans", 0, conn)
+		assert.HasLength(t, output.Results, SEARCH_PAGE_SIZE)
+		assert.Equals(t, output.NextCursor, int64(6))
+
+		output, _ = searchMessagesDatabase(mocks.ADMIN_ID, "beans", output.NextCursor, conn)
+		assert.HasLength(t, output.Results, 5)
+		assert.Equals(t, output.Results[0].ID, int64(5))
+		assert.Equals(t, output.NextCursor, int64(0))
+	})
+
+	t.Run("OtherChat", func(t *testing.T) {
+		conn, _ := setup()
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 11, 12)
+		message := mocks.MakeMessage(12, chat.ID)
+		message.Content = "beans"
+		conn.SetMessage(message)
+
+		output, httpError := searchMessagesDatabase(mocks.ADMIN_ID, "beans", 0, conn)
+		assert.IsNil(t, httpError)
+		assert.HasLength(t, output.Results, 0)
+	})
+
+	t.Run("DeletedMessage", func(t *testing.T) {
+		conn, _ := setup("beans")
+		conn.DeleteMessage(1)
+
+		output, _ := searchMessagesDatabase(mocks.ADMIN_ID, "beans", 0, conn)
+		assert.HasLength(t, output.Results, 0)
+	})
+
+	t.Run("EmptyQuery", func(t *testing.T) {
+		conn, _ := setup()
+
+		_, httpError := searchMessagesDatabase(mocks.ADMIN_ID, "  ", 0, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "search query cannot be empty")
+	})
+}
+
+func TestSearchMessages(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		conn.SetMessage(mocks.MakeMessage(12, chatID))
+		w, r := makeMessageRequest(t, "", chatID)
+		query := r.URL.Query()
+		query.Set("q", "ipsum")
+		r.URL.RawQuery = query.Encode()
+		SearchMessages(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Equals(t, w.Status, http.StatusOK)
+		var output map[string]any
+		json.Unmarshal(w.Body, &output)
+		assert.Equals[any](t, output["nextCursor"], float64(0))
+		results := output["results"].([]any)
+		assert.HasLength(t, results, 1)
+		assert.Equals[any](t, results[0].(map[string]any)["snippet"], "Lorem <mark>Ipsum</mark> Dolor")
+	})
+
+	t.Run("MissingQuery", func(t *testing.T) {
+		conn, chatID := setupMessageTests(mocks.ADMIN_ID, 12)
+		w, r := makeMessageRequest(t, "", chatID)
+
+		SearchMessages(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "missing required query parameter: q")
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/raphael-p/beango/config"
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/context"
 	"github.com/raphael-p/beango/utils/cookies"
 	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/response"
@@ -36,17 +37,71 @@ func checkCredentials(username, password string, conn database.Connection) (int6
 		return 0, unauthorised()
 	}
 
+	rehashPassword(user, password, conn)
 	return user.ID, nil
 }
 
-func makeSession(userID int64) *database.Session {
+// Replaces the password hash of a user if its cost is below the configured
+// one. The password is already known to be correct, and failing to rehash it
+// does not stop the user from logging in.
+func rehashPassword(user *database.User, password string, conn database.Connection) {
+	cost, err := bcrypt.Cost(user.Key)
+	if err != nil || cost >= int(config.Values.Password.HashCost) {
+		return
+	}
+	hash, httpError := hashPassword(password)
+	if httpError != nil {
+		logger.Error("failed to rehash password: " + httpError.Message)
+		return
+	}
+	if err := conn.UpdateUserKey(user.ID, hash); err != nil {
+		logger.Error("failed to rehash password: " + err.Error())
+	}
+}
+
+// Tells the rate limiter of the route, if it has one, whether a password or
+// code was correct. Unexpected errors are not counted as failed attempts.
+func recordLoginAttempt(r *http.Request, httpError *resolverutils.HTTPError) {
+	attempt := context.GetAttempt(r)
+	if attempt == nil {
+		return
+	}
+	var err error
+	if httpError == nil {
+		err = attempt.Succeed()
+	} else if httpError.Status < http.StatusInternalServerError {
+		err = attempt.Fail()
+	}
+	if err != nil {
+		logger.Error("failed to record login attempt: " + err.Error())
+	}
+}
+
+// Counts a request as a failed attempt whatever its outcome, for requests that
+// must be limited even when they succeed, such as those that send an email
+func countAttempt(r *http.Request) {
+	attempt := context.GetAttempt(r)
+	if attempt == nil {
+		return
+	}
+	if err := attempt.Fail(); err != nil {
+		logger.Error("failed to record attempt: " + err.Error())
+	}
+}
+
+func makeSession(userID int64, r *http.Request) *database.Session {
 	sessionID := uuid.NewString()
+	now := time.Now().UTC()
 	expiryDuration := time.Duration(config.Values.Session.SecondsUntilExpiry) * time.Second
-	expiryDate := time.Now().UTC().Add(expiryDuration)
 	return &database.Session{
 		ID:         sessionID,
 		UserID:     userID,
-		ExpiryDate: expiryDate,
+		ExpiryDate: now.Add(expiryDuration),
+		Handle:     uuid.NewString(),
+		UserAgent:  r.UserAgent(),
+		IPAddress:  resolverutils.GetRequestIPAddress(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
 	}
 }
 
@@ -58,13 +113,21 @@ func setSession(w *response.Writer, session *database.Session, conn database.Con
 			Message: "failed to create session cookie",
 		}
 	}
-	conn.SetSession(*session)
+	if err := conn.SetSession(*session); err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
 	return nil
 }
 
+// Sent instead of a session cookie when a code is needed, see VerifySessionCode
+type preAuthOutput struct {
+	PreAuthToken string    `json:"preAuthToken"`
+	ExpiryDate   time.Time `json:"expiryDate"`
+}
+
 func CreateSession(w *response.Writer, r *http.Request, conn database.Connection) {
 	if sessionID, err := cookies.Get(r, cookies.SESSION); err == nil {
-		if _, ok := conn.CheckSession(sessionID); ok {
+		if session, _ := conn.CheckSession(sessionID); session != nil {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -76,11 +139,115 @@ func CreateSession(w *response.Writer, r *http.Request, conn database.Connection
 	}
 
 	userID, httpError := checkCredentials(input.Username, input.Password, conn)
+	recordLoginAttempt(r, httpError)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	preAuthToken, httpError := startLogin(w, r, userID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	if preAuthToken != nil {
+		w.WriteJSON(http.StatusOK, preAuthOutput{preAuthToken.ID, preAuthToken.ExpiryDate})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Sessions are referred to by their handle, the session ID is never exposed
+type sessionOutput struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	IsCurrent  bool      `json:"isCurrent"`
+}
+
+func getSessionsDatabase(userID int64, currentSessionID string, conn database.Connection) ([]sessionOutput, *resolverutils.HTTPError) {
+	sessions, err := conn.GetSessionsByUserID(userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+
+	output := make([]sessionOutput, len(sessions))
+	for i, session := range sessions {
+		output[i] = sessionOutput{
+			ID:         session.Handle,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			IsCurrent:  session.ID == currentSessionID,
+		}
+	}
+	return output, nil
+}
+
+func GetSessions(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	sessions, httpError := getSessionsDatabase(user.ID, currentSessionID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	w.WriteJSON(http.StatusOK, sessions)
+}
+
+// Deletes a session of the user by its handle, returns whether it was the current session
+func deleteSessionDatabase(userID int64, handle, currentSessionID string, conn database.Connection) (bool, *resolverutils.HTTPError) {
+	session, err := conn.GetSessionByHandle(handle)
+	if err != nil {
+		return false, resolverutils.HandleDatabaseError(err)
+	}
+	if session == nil || session.UserID != userID {
+		return false, &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "session not found",
+		}
+	}
+
+	if err := conn.DeleteSession(session.ID); err != nil {
+		return false, resolverutils.HandleDatabaseError(err)
+	}
+	return session.ID == currentSessionID, nil
+}
+
+func DeleteSession(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.SESSION_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	isCurrent, httpError := deleteSessionDatabase(user.ID, params.SessionID, currentSessionID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	if isCurrent {
+		cookies.Invalidate(w, cookies.SESSION)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Logs the user out of every session except the one making the request
+func DeleteOtherSessions(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
 	if resolverutils.ProcessHTTPError(w, httpError) {
 		return
 	}
 
-	if resolverutils.ProcessHTTPError(w, setSession(w, makeSession(userID), conn)) {
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	err := conn.DeleteOtherSessions(user.ID, currentSessionID)
+	if resolverutils.ProcessHTTPError(w, resolverutils.HandleDatabaseError(err)) {
 		return
 	}
 
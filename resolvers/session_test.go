@@ -1,21 +1,30 @@
 package resolvers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/raphael-p/beango/config"
 	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/ratelimit"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/test/assert"
 	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/context"
 	"github.com/raphael-p/beango/utils/cookies"
 	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/response"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCheckCredentials(t *testing.T) {
+	config.CreateConfig()
+
 	t.Run("Normal", func(t *testing.T) {
 		conn := mocks.MakeMockConnection()
 		userID, httpError := checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD, conn)
@@ -23,6 +32,28 @@ func TestCheckCredentials(t *testing.T) {
 		assert.Equals(t, userID, mocks.ADMIN_ID)
 	})
 
+	t.Run("RehashesPassword", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD, conn)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		cost, _ := bcrypt.Cost(user.Key)
+		assert.Equals(t, cost, int(config.Values.Password.HashCost))
+
+		// the new hash is kept on the next login
+		key := user.Key
+		_, httpError := checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD, conn)
+		assert.IsNil(t, httpError)
+		user, _ = conn.GetUser(mocks.ADMIN_ID)
+		assert.DeepEquals(t, user.Key, key)
+	})
+
+	t.Run("NoRehashOnWrongPassword", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD+" ", conn)
+		user, _ := conn.GetUser(mocks.ADMIN_ID)
+		assert.Equals(t, string(user.Key), mocks.HASH)
+	})
+
 	t.Run("WrongUsername", func(t *testing.T) {
 		conn := mocks.MakeMockConnection()
 		userID, httpError := checkCredentials(mocks.ADMIN_USERNAME+" ", mocks.PASSWORD, conn)
@@ -97,6 +128,58 @@ func TestCreateSession(t *testing.T) {
 		assert.HasLength(t, w.Header()["Set-Cookie"], 1)
 	})
 
+	t.Run("KeepsOtherSessions", func(t *testing.T) {
+		w, req, conn := setup(mocks.ADMIN_USERNAME, mocks.PASSWORD)
+		req.Header.Set("User-Agent", "beango-test")
+
+		CreateSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		sessions, _ := conn.GetSessionsByUserID(mocks.ADMIN_ID)
+		assert.HasLength(t, sessions, 2)
+		var newSession database.Session
+		for _, session := range sessions {
+			if session.ID != mocks.AdminSesh.ID {
+				newSession = session
+			}
+		}
+		assert.Equals(t, newSession.UserAgent, "beango-test")
+		assert.Equals(t, newSession.IPAddress, "192.0.2.1")
+	})
+
+	t.Run("RecordsAttempts", func(t *testing.T) {
+		policy := ratelimit.Policy{FreeAttempts: 0, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Hour}
+		limiter := ratelimit.NewLimiter(ratelimit.NewLocalStore(), policy)
+		username := ratelimit.Key{Value: "username:" + mocks.ADMIN_USERNAME, ClearOnSuccess: true}
+
+		w, req, conn := setup(mocks.ADMIN_USERNAME, mocks.PASSWORD+" ")
+		req = context.SetAttempt(req, limiter.NewAttempt(username))
+		CreateSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusUnauthorized)
+		wait, _ := limiter.Check(username)
+		assert.Equals(t, wait > 0, true)
+
+		w, req, conn = setup(mocks.ADMIN_USERNAME, mocks.PASSWORD)
+		req = context.SetAttempt(req, limiter.NewAttempt(username))
+		CreateSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		wait, _ = limiter.Check(username)
+		assert.Equals(t, wait, time.Duration(0))
+	})
+
+	t.Run("TwoFactorEnabled", func(t *testing.T) {
+		w, req, conn := setup(mocks.ADMIN_USERNAME, mocks.PASSWORD)
+		enableAdminTOTP(t, conn)
+
+		CreateSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.HasLength(t, w.Header()["Set-Cookie"], 0)
+		var output preAuthOutput
+		err := json.Unmarshal(w.Body, &output)
+		assert.IsNil(t, err)
+		token, _ := conn.CheckPreAuthToken(output.PreAuthToken, PRE_AUTH_MAX_ATTEMPTS)
+		assert.Equals(t, token.UserID, mocks.ADMIN_ID)
+	})
+
 	t.Run("RequestHasInvalidSession", func(t *testing.T) {
 		w, req, conn := setup(mocks.ADMIN_USERNAME, mocks.PASSWORD)
 		cookie := &http.Cookie{Name: string(cookies.SESSION), Value: mocks.AdminSesh.ID}
@@ -119,3 +202,98 @@ func TestCreateSession(t *testing.T) {
 		assert.HasLength(t, w.Header()["Set-Cookie"], 0)
 	})
 }
+
+// Does not use CommonSetup, as it would replace mocks.AdminSesh
+func makeSessionRequest(t *testing.T, sessionID string, params map[string]string) (*response.Writer, *http.Request) {
+	w := response.NewWriter(httptest.NewRecorder())
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: string(cookies.SESSION), Value: sessionID})
+	req = resolverutils.SetContext(t, req, mocks.Admin, params)
+	return w, req
+}
+
+func TestGetSessions(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		otherSession := mocks.MakeSession(mocks.ADMIN_ID)
+		otherSession.LastSeenAt = otherSession.LastSeenAt.Add(-time.Minute)
+		conn.SetSession(otherSession)
+		conn.SetSession(mocks.MakeSession(mocks.MakeUser().ID))
+		w, req := makeSessionRequest(t, mocks.AdminSesh.ID, nil)
+
+		GetSessions(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		var sessions []sessionOutput
+		err := json.Unmarshal(w.Body, &sessions)
+		assert.IsNil(t, err)
+		assert.HasLength(t, sessions, 2)
+		assert.Equals(t, sessions[0].ID, mocks.AdminSesh.Handle)
+		assert.Equals(t, sessions[0].IsCurrent, true)
+		assert.Equals(t, sessions[1].ID, otherSession.Handle)
+		assert.Equals(t, sessions[1].IsCurrent, false)
+		assert.Equals(t, strings.Contains(string(w.Body), mocks.AdminSesh.ID), false)
+	})
+}
+
+func TestDeleteSession(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		otherSession := mocks.MakeSession(mocks.ADMIN_ID)
+		conn.SetSession(otherSession)
+		params := map[string]string{resolverutils.SESSION_ID_KEY: otherSession.Handle}
+		w, req := makeSessionRequest(t, mocks.AdminSesh.ID, params)
+
+		DeleteSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		assert.HasLength(t, w.Header()["Set-Cookie"], 0)
+		session, _ := conn.GetSession(otherSession.ID)
+		assert.IsNil(t, session)
+		session, _ = conn.GetSession(mocks.AdminSesh.ID)
+		assert.IsNotNil(t, session)
+	})
+
+	t.Run("CurrentSession", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		params := map[string]string{resolverutils.SESSION_ID_KEY: mocks.AdminSesh.Handle}
+		w, req := makeSessionRequest(t, mocks.AdminSesh.ID, params)
+
+		DeleteSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		assert.HasLength(t, w.Header()["Set-Cookie"], 1)
+		session, _ := conn.GetSession(mocks.AdminSesh.ID)
+		assert.IsNil(t, session)
+	})
+
+	t.Run("OtherUsersSession", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		otherSession := mocks.MakeSession(mocks.MakeUser().ID)
+		conn.SetSession(otherSession)
+		params := map[string]string{resolverutils.SESSION_ID_KEY: otherSession.Handle}
+		w, req := makeSessionRequest(t, mocks.AdminSesh.ID, params)
+
+		DeleteSession(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNotFound)
+		assert.Equals(t, string(w.Body), "session not found")
+		session, _ := conn.GetSession(otherSession.ID)
+		assert.IsNotNil(t, session)
+	})
+}
+
+func TestDeleteOtherSessions(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		conn.SetSession(mocks.MakeSession(mocks.ADMIN_ID))
+		conn.SetSession(mocks.MakeSession(mocks.ADMIN_ID))
+		strangerSession := mocks.MakeSession(mocks.MakeUser().ID)
+		conn.SetSession(strangerSession)
+		w, req := makeSessionRequest(t, mocks.AdminSesh.ID, nil)
+
+		DeleteOtherSessions(w, req, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		sessions, _ := conn.GetSessionsByUserID(mocks.ADMIN_ID)
+		assert.HasLength(t, sessions, 1)
+		assert.Equals(t, sessions[0].ID, mocks.AdminSesh.ID)
+		session, _ := conn.GetSession(strangerSession.ID)
+		assert.IsNotNil(t, session)
+	})
+}
@@ -2,39 +2,217 @@ package resolvers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/raphael-p/beango/config"
 	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/events"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/response"
 )
 
-type connectionMap = map[string]*response.Writer
-type connectionIndex = map[int64]connectionMap
+// Events sent on a user's stream, their data is a chatEventData
+const (
+	NEW_MESSAGE_EVENT = "new-message"
+	NEW_CHAT_EVENT    = "new-chat"
+	RENAME_CHAT_EVENT = "rename-chat"
+	READ_CHAT_EVENT   = "read-chat"
+)
+
+type chatEventData struct {
+	ChatID int64 `json:"chatID"`
+}
+
+// Sent on the streams of a chat's members, and of the user who left, when a
+// member leaves or is removed from a chat
+const LEAVE_CHAT_EVENT = "leave-chat"
+
+// Name of the SSE event sent on a chat's stream when a member leaves it, which
+// closes the streams of the chat that the member still has open
+func leaveChatEvent(userID int64) string {
+	return fmt.Sprint(LEAVE_CHAT_EVENT, "-", userID)
+}
+
+type chatMemberEventData struct {
+	ChatID int64 `json:"chatID"`
+	UserID int64 `json:"userID"`
+}
+
+// Sent on a chat's stream for each new message, with the message ID as the event ID
+const NEW_MESSAGES_EVENT = "new-messages"
 
-var chatConnectionIndex = connectionIndex{}
+type messageEventData struct {
+	ChatID    int64 `json:"chatID"`
+	MessageID int64 `json:"messageID"`
+}
+
+// Sent on a chat's stream when a member's read marker moves
+const READ_RECEIPT_EVENT = "read-receipt"
+
+type readReceiptEventData struct {
+	ChatID    int64 `json:"chatID"`
+	UserID    int64 `json:"userID"`
+	MessageID int64 `json:"messageID"`
+}
 
 func RegisterChatSSE(w *response.Writer, r *http.Request, conn database.Connection) {
 	newWriter := upgradeConnection(w)
 
-	_, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if httpError != nil {
+		w.WriteSSE("redirect", "")
+		return
+	}
+	if chat, _ := conn.GetChat(params.ChatID, user.ID); chat == nil {
+		w.WriteSSE("redirect", "")
+		return
+	}
+
+	replay := missedMessageEvents(r, params.ChatID, conn)
+	key := streamKey{CHAT_STREAM, params.ChatID}
+	serveSSEClient(newWriter, r, hub, key, leaveChatEvent(user.ID), replay...)
+}
+
+// Finds the messages sent after the one in the Last-Event-ID header, which
+// the browser sets when it reconnects. Returns them oldest first.
+func missedMessageEvents(r *http.Request, chatID int64, conn database.Connection) []sseEvent {
+	lastEventID, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil || lastEventID <= 0 {
+		return nil
+	}
+
+	messages, err := conn.GetMessagesByChatID(chatID, lastEventID, 0, 0)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to fetch messages to replay for chat %d: %s", chatID, err))
+		return nil
+	}
+
+	events := make([]sseEvent, len(messages))
+	for i, message := range messages {
+		events[len(messages)-1-i] = newMessageEvent(chatID, message.ID)
+	}
+	return events
+}
+
+func newMessageEvent(chatID, messageID int64) sseEvent {
+	data, _ := json.Marshal(messageEventData{chatID, messageID})
+	return sseEvent{fmt.Sprint(messageID), NEW_MESSAGES_EVENT, string(data)}
+}
+
+// Opens a stream of events for every chat the user belongs to
+func RegisterUserSSE(w *response.Writer, r *http.Request, conn database.Connection) {
+	newWriter := upgradeConnection(w)
+
+	user, _, httpError := resolverutils.GetRequestContext(r)
 	if httpError != nil {
 		w.WriteSSE("redirect", "")
 		return
 	}
-	chatID := params.ChatID
 
-	chatConnectionIndex, connectionID := registerConnection(newWriter, chatConnectionIndex, chatID)
-	trapConnection(r, chatConnectionIndex, chatID, connectionID)
+	serveSSEClient(newWriter, r, hub, streamKey{USER_STREAM, user.ID}, "")
+}
+
+// Counts every connection to this instance, so it is only routed to operators
+func GetSSEMetrics(w *response.Writer, r *http.Request, conn database.Connection) {
+	w.WriteJSON(http.StatusOK, hub.getMetrics())
+}
+
+func SendUserEvent(userID int64, event, data string) {
+	publishEvent(streamKey{USER_STREAM, userID}, sseEvent{event: event, data: data})
+}
+
+// Sends an event about a chat to the stream of each of its members
+func SendChatMembersEvent(chatID int64, event string, conn database.Connection) {
+	data, _ := json.Marshal(chatEventData{chatID})
+	sendMembersEvent(chatID, event, string(data), conn)
+}
+
+func sendMembersEvent(chatID int64, event, data string, conn database.Connection) {
+	users, err := conn.GetUsersByChatID(chatID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to fetch members of chat %d: %s", chatID, err))
+		return
+	}
+
+	for _, user := range users {
+		SendUserEvent(user.ID, event, data)
+	}
+}
+
+// Tells open message panes to refresh, and chat lists to reorder
+func sendNewMessageEvents(message *database.MessageDatabase, conn database.Connection) {
+	stopTyping(message.ChatID, message.UserID)
+	publishEvent(streamKey{CHAT_STREAM, message.ChatID}, newMessageEvent(message.ChatID, message.ID))
+	SendChatMembersEvent(message.ChatID, NEW_MESSAGE_EVENT, conn)
+	if message.ThreadID != nil {
+		SendChatEvent(message.ChatID, threadEvent(*message.ThreadID), "")
+		// re-renders the reply count of the message that started the thread
+		SendChatEvent(message.ChatID, editMessageEvent(*message.ThreadID), "")
+	}
+}
+
+// Re-renders a deleted message, and the reply count of its thread if it is in one
+func sendDeleteMessageEvents(chatID, messageID int64, conn database.Connection) {
+	SendChatEvent(chatID, deleteMessageEvent(messageID), "")
+	if message, _ := conn.GetMessage(messageID); message != nil && message.ThreadID != nil {
+		SendChatEvent(chatID, editMessageEvent(*message.ThreadID), "")
+	}
+}
+
+// Private chats are named after the other user, so they change when a user is renamed
+func sendRenameEvents(userID int64, conn database.Connection) {
+	chats, err := conn.GetChatsByUserID(userID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to fetch chats of user %d: %s", userID, err))
+		return
+	}
+
+	for _, chat := range chats {
+		if chat.Type == database.PRIVATE_CHAT && chat.Name == "" {
+			SendChatMembersEvent(chat.ID, RENAME_CHAT_EVENT, conn)
+		}
+	}
 }
 
 func SendChatEvent(chatID int64, event, data string) {
-	chatConnections, ok := chatConnectionIndex[chatID]
-	if ok {
-		sendEvent(chatConnections, event, data)
+	publishEvent(streamKey{CHAT_STREAM, chatID}, sseEvent{event: event, data: data})
+}
+
+// Events go through the bus so that they reach the clients connected to
+// every server instance, each instance forwards them to its own hub
+var eventBus events.Bus
+
+func init() {
+	UseEventBus(events.NewLocalBus())
+}
+
+func UseEventBus(bus events.Bus) {
+	bus.Subscribe(trackTyping) // before the event reaches clients, which may ask who is typing
+	bus.Subscribe(forwardToHub)
+	eventBus = bus
+}
+
+func forwardToHub(event events.Event) {
+	key := streamKey{streamScope(event.Scope), event.Key}
+	hub.publish(key, sseEvent{event.ID, event.Name, event.Data})
+}
+
+func publishEvent(key streamKey, event sseEvent) {
+	err := eventBus.Publish(events.Event{
+		Scope: string(key.scope),
+		Key:   key.id,
+		ID:    event.id,
+		Name:  event.event,
+		Data:  event.data,
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to publish '%s' event: %s", event.event, err))
 	}
 }
 
@@ -50,58 +228,53 @@ func upgradeConnection(w *response.Writer) *response.Writer {
 	return w
 }
 
-// Add connection to the index.
-func registerConnection(
-	w *response.Writer,
-	index connectionIndex,
-	key int64,
-) (connectionIndex, string) {
-	sseConnectionID := uuid.NewString()
-	connectionForKey := index[key]
-	if connectionForKey == nil {
-		connectionForKey = connectionMap{sseConnectionID: w}
-	} else {
-		connectionForKey[sseConnectionID] = w
+// Registers a client with the hub, then writes the events it receives until
+// the client disconnects or is evicted. Heartbeats are sent in between events
+// so that proxies do not drop idle connections. Replayed events are written
+// first, once the client is registered so that nothing is missed in between.
+// A closeOn event, if given, redirects the client and ends the connection.
+func serveSSEClient(w *response.Writer, r *http.Request, h *sseHub, key streamKey, closeOn string, replay ...sseEvent) {
+	sseConfig := config.Values.SSE
+	client := &sseClient{
+		id:     uuid.NewString(),
+		key:    key,
+		events: make(chan sseEvent, sseConfig.BufferSize),
 	}
-	index[key] = connectionForKey
-	return index, sseConnectionID
-}
+	heartbeat := time.NewTicker(time.Duration(sseConfig.SecondsBetweenHeartbeats) * time.Second)
 
-// Makes sure connection is kept alive until terminated by client
-func trapConnection(r *http.Request, index connectionIndex, key int64, connectionID string) {
 	ctx, cancel := context.WithCancel(r.Context())
+	h.register <- client
+	logger.Info(fmt.Sprintf("[SSE connection %s] opened", client.id))
 	defer func() {
 		cancel()
-		closeSSEConnection(index, key, connectionID)
-		message := fmt.Sprintf("[SSE connection %s] closed", connectionID)
-		logger.Info(message)
+		heartbeat.Stop()
+		h.unregister <- client
+		logger.Info(fmt.Sprintf("[SSE connection %s] closed", client.id))
 	}()
 
-	message := fmt.Sprintf("[SSE connection %s] opened", connectionID)
-	logger.Info(message)
-	<-ctx.Done() // wait for client termination
-}
-
-// Removes an SSE connection from the index. Will remove an index entry if there
-// are no more connections against it.
-func closeSSEConnection(index connectionIndex, key int64, connectionID string) {
-	delete(index[key], connectionID)
-	if len(index[key]) == 0 {
-		delete(index, key)
+	for _, event := range replay {
+		w.WriteSSEWithID(event.id, event.event, event.data)
+	}
+	if len(replay) != 0 {
+		logger.Info(fmt.Sprintf("[SSE connection %s] replayed %d event(s)", client.id, len(replay)))
 	}
-}
 
-// Writes to all SSE connections for a given user. A user will
-// have multiple connections open if they open multiple tabs,
-// for instance.
-func sendEvent(connections connectionMap, event, data string) {
-	for connectionID, w := range connections {
-		w.WriteSSE(event, data)
-		message := fmt.Sprintf(
-			"[SSE connection %s] sent '%s' event",
-			connectionID,
-			event,
-		)
-		logger.Info(message)
+	for {
+		select {
+		case <-ctx.Done(): // client terminated the connection
+			return
+		case event, ok := <-client.events:
+			if !ok { // evicted by the hub
+				return
+			}
+			if closeOn != "" && event.event == closeOn {
+				w.WriteSSE("redirect", "")
+				return
+			}
+			w.WriteSSEWithID(event.id, event.event, event.data)
+			logger.Info(fmt.Sprintf("[SSE connection %s] sent '%s' event", client.id, event.event))
+		case <-heartbeat.C:
+			w.WriteSSEComment("heartbeat")
+		}
 	}
 }
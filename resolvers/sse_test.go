@@ -1,24 +1,51 @@
 package resolvers
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/events"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/test/assert"
 	"github.com/raphael-p/beango/test/mocks"
-	"github.com/raphael-p/beango/utils/collections"
 	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/response"
 )
 
+// Registers a client directly with the hub, bypassing the HTTP connection
+func registerTestClient(t *testing.T, h *sseHub, key streamKey, bufferSize int) *sseClient {
+	client := &sseClient{
+		id:     uuid.NewString(),
+		key:    key,
+		events: make(chan sseEvent, bufferSize),
+	}
+	h.register <- client
+	t.Cleanup(func() { h.unregister <- client })
+	return client
+}
+
+func receiveEvent(t *testing.T, client *sseClient) (sseEvent, bool) {
+	select {
+	case event, ok := <-client.events:
+		return event, ok
+	case <-time.After(1 * time.Second):
+		t.Error("timed out waiting for event")
+		return sseEvent{}, false
+	}
+}
+
 func TestRegisterChatSSE(t *testing.T) {
+	config.CreateConfig()
+
 	t.Run("Normal", func(t *testing.T) {
 		buf := logger.MockFileLogger(t)
 		w, r, conn := resolverutils.CommonSetup("")
@@ -41,6 +68,66 @@ func TestRegisterChatSSE(t *testing.T) {
 		}
 	})
 
+	t.Run("ReplaysMissedMessages", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, mocks.ADMIN_ID)
+		seenMessage, _ := conn.SetMessage(mocks.MakeMessage(12, chat.ID))
+		missedMessage, _ := conn.SetMessage(mocks.MakeMessage(12, chat.ID))
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		r.Header.Set("Last-Event-ID", fmt.Sprint(seenMessage.ID))
+		ctx, cancel := context.WithCancel(r.Context())
+		r = r.WithContext(ctx)
+
+		done := make(chan bool)
+		go func() {
+			RegisterChatSSE(w, r, conn)
+			done <- true
+		}()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		<-done
+
+		xBody := fmt.Sprintf(
+			"id: %d\nevent: %s\ndata: {\"chatID\":%d,\"messageID\":%d}\n\n",
+			missedMessage.ID, NEW_MESSAGES_EVENT, chat.ID, missedMessage.ID,
+		)
+		assert.Equals(t, string(w.Body), xBody)
+	})
+
+	t.Run("ClosesWhenUserLeaves", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), 12, mocks.ADMIN_ID)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		done := make(chan bool)
+		go func() {
+			RegisterChatSSE(w, r, conn)
+			done <- true
+		}()
+		time.Sleep(100 * time.Millisecond)
+		removeChatUserDatabase(12, chat.ID, mocks.ADMIN_ID, conn)
+
+		select {
+		case <-done:
+			assert.Equals(t, string(w.Body), "event: redirect\ndata: \n\n")
+		case <-time.After(1 * time.Second):
+			t.Error("connection was not closed")
+		}
+	})
+
+	t.Run("RedirectsOnNonMember", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, 13)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+
+		RegisterChatSSE(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "redirect")
+	})
+
 	t.Run("RedirectsOnMissingUser", func(t *testing.T) {
 		w, r, conn := resolverutils.CommonSetup("")
 		params := map[string]string{resolverutils.CHAT_ID_KEY: "1"}
@@ -61,154 +148,324 @@ func TestRegisterChatSSE(t *testing.T) {
 	})
 }
 
-func TestSendChatEvent(t *testing.T) {
-	setup := func() (*bytes.Buffer, int64, string) {
+func TestRegisterUserSSE(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
 		buf := logger.MockFileLogger(t)
-		var key int64 = 1
-		connectionID := "a"
-		w := response.NewWriter(httptest.NewRecorder())
-		chatConnectionIndex[key] = connectionMap{connectionID: w}
-		return buf, key, connectionID
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		done := make(chan bool)
+		go func() {
+			RegisterUserSSE(w, r, conn)
+			done <- true
+		}()
+
+		select {
+		case <-done:
+			t.Error("connection closed unexpectedly")
+		case <-time.After(1 * time.Second):
+			assert.Contains(t, buf.String(), "opened")
+		}
+	})
+
+	t.Run("RedirectsOnMissingUser", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, nil, nil)
+
+		RegisterUserSSE(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Contains(t, string(w.Body), "redirect")
+	})
+}
+
+func TestSendChatEvent(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, 1}, 1)
+		otherClient := registerTestClient(t, hub, streamKey{CHAT_STREAM, 2}, 1)
+
+		SendChatEvent(1, "test-event", "Hello World!")
+		event, ok := receiveEvent(t, client)
+		assert.Equals(t, ok, true)
+		assert.Equals(t, event, sseEvent{event: "test-event", data: "Hello World!"})
+		assert.Equals(t, len(otherClient.events), 0)
+	})
+}
+
+func TestMissedMessageEvents(t *testing.T) {
+	setup := func(lastEventID string) ([]sseEvent, []*database.MessageDatabase) {
+		_, r, conn := resolverutils.CommonSetup("")
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), 12, mocks.ADMIN_ID)
+		messages := make([]*database.MessageDatabase, 3)
+		for i := range messages {
+			messages[i], _ = conn.SetMessage(mocks.MakeMessage(12, chat.ID))
+		}
+		r.Header.Set("Last-Event-ID", lastEventID)
+		return missedMessageEvents(r, chat.ID, conn), messages
 	}
 
 	t.Run("Normal", func(t *testing.T) {
-		buf, key, connectionID := setup()
-		xEvent := "test-event"
-		xMessage := fmt.Sprintf("[SSE connection %s] sent '%s' event", connectionID, xEvent)
+		events, messages := setup("1")
+		assert.HasLength(t, events, 2)
+		assert.Equals(t, events[0].id, fmt.Sprint(messages[1].ID))
+		assert.Equals(t, events[1].id, fmt.Sprint(messages[2].ID))
+		assert.Equals(t, events[0].event, NEW_MESSAGES_EVENT)
+	})
 
-		SendChatEvent(key, xEvent, "Hello World!")
-		assert.Contains(t, buf.String(), xMessage)
+	t.Run("NoHeader", func(t *testing.T) {
+		events, _ := setup("")
+		assert.HasLength(t, events, 0)
 	})
 
-	t.Run("ChatNotFound", func(t *testing.T) {
-		buf, _, _ := setup()
+	t.Run("InvalidHeader", func(t *testing.T) {
+		events, _ := setup("raisin")
+		assert.HasLength(t, events, 0)
+	})
+}
 
-		SendChatEvent(2, "test-event", "Hello World!")
-		assert.Equals(t, buf.String(), "")
+func TestSendChatMembersEvent(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		member, _ := conn.SetUser(mocks.MakeUser())
+		stranger, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), member.ID, mocks.ADMIN_ID)
+		memberClient := registerTestClient(t, hub, streamKey{USER_STREAM, member.ID}, 1)
+		strangerClient := registerTestClient(t, hub, streamKey{USER_STREAM, stranger.ID}, 1)
+
+		SendChatMembersEvent(chat.ID, NEW_MESSAGE_EVENT, conn)
+		event, _ := receiveEvent(t, memberClient)
+		assert.Equals(t, event.event, NEW_MESSAGE_EVENT)
+		assert.Equals(t, event.data, fmt.Sprintf(`{"chatID":%d}`, chat.ID))
+		assert.Equals(t, len(strangerClient.events), 0)
 	})
 }
 
-func TestRegisterConnection(t *testing.T) {
-	setup := func() (*response.Writer, connectionIndex, int64) {
-		var key int64 = 1
-		w := response.NewWriter(httptest.NewRecorder())
-		return w, connectionIndex{}, key
-	}
+func TestUseEventBus(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		previousBus := eventBus
+		defer func() { eventBus = previousBus }()
+		bus := events.NewLocalBus()
+		var published []events.Event
+		bus.Subscribe(func(event events.Event) { published = append(published, event) })
+		UseEventBus(bus)
+		client := registerTestClient(t, hub, streamKey{USER_STREAM, 99}, 1)
+
+		SendUserEvent(99, "test-event", "Hello World!")
+		xEvent := events.Event{Scope: "user", Key: 99, Name: "test-event", Data: "Hello World!"}
+		assert.DeepEquals(t, published, []events.Event{xEvent})
+		event, _ := receiveEvent(t, client)
+		assert.Equals(t, event, sseEvent{event: "test-event", data: "Hello World!"})
+	})
+}
 
+func TestForwardToHub(t *testing.T) {
 	t.Run("Normal", func(t *testing.T) {
-		w, xConnectionIndex, key := setup()
-		xStatus := 1
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, 98}, 1)
 
-		registerConnection(w, xConnectionIndex, key)
-		_, values := collections.MapEntries(xConnectionIndex[key])
-		assert.HasLength(t, values, 1)
-		values[0].Status = xStatus
+		forwardToHub(events.Event{Scope: "chat", Key: 98, ID: "3", Name: "new-messages", Data: "{}"})
+		event, _ := receiveEvent(t, client)
+		assert.Equals(t, event, sseEvent{"3", "new-messages", "{}"})
 	})
+}
 
-	t.Run("MultipleConnectionsOnKey", func(t *testing.T) {
-		w, xConnectionIndex, key := setup()
+func TestGetSSEMetrics(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		registerTestClient(t, hub, streamKey{USER_STREAM, mocks.ADMIN_ID}, 1)
+		w, r, conn := resolverutils.CommonSetup("")
 
-		registerConnection(w, xConnectionIndex, key)
-		registerConnection(w, xConnectionIndex, key)
-		_, values := collections.MapEntries(xConnectionIndex[key])
-		assert.HasLength(t, values, 2)
+		GetSSEMetrics(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusOK)
+		var metrics SSEMetrics
+		err := json.Unmarshal(w.Body, &metrics)
+		assert.IsNil(t, err)
+		if metrics.ConnectedClients < 1 || metrics.UserStreams < 1 {
+			t.Errorf("expected at least one connected user client, got %+v", metrics)
+		}
 	})
 }
 
-func TestTrapConnection(t *testing.T) {
+func TestSSEHub(t *testing.T) {
+	setup := func() *sseHub {
+		h := newSSEHub()
+		go h.run()
+		return h
+	}
+
 	t.Run("Normal", func(t *testing.T) {
-		var key int64 = 1
-		connectionID := "a"
-		w := response.NewWriter(httptest.NewRecorder())
-		connectionIndex := connectionIndex{key: {connectionID: w}}
+		h := setup()
+		key := streamKey{CHAT_STREAM, 1}
+		client1 := registerTestClient(t, h, key, 1)
+		client2 := registerTestClient(t, h, key, 1)
+
+		h.publish(key, sseEvent{event: "test-event", data: "data"})
+		event, _ := receiveEvent(t, client1)
+		assert.Equals(t, event, sseEvent{event: "test-event", data: "data"})
+		event, _ = receiveEvent(t, client2)
+		assert.Equals(t, event, sseEvent{event: "test-event", data: "data"})
+		assert.DeepEquals(t, h.getMetrics(), SSEMetrics{
+			ConnectedClients: 2,
+			ChatStreams:      1,
+			EventsSent:       2,
+		})
+	})
+
+	t.Run("Unregister", func(t *testing.T) {
+		h := setup()
+		key := streamKey{USER_STREAM, 1}
+		client := &sseClient{id: "a", key: key, events: make(chan sseEvent, 1)}
+		h.register <- client
+
+		h.unregister <- client
+		_, ok := receiveEvent(t, client)
+		assert.Equals(t, ok, false)
+		assert.DeepEquals(t, h.getMetrics(), SSEMetrics{})
+
+		h.unregister <- client // does not close the channel twice
+	})
+
+	t.Run("AddStream", func(t *testing.T) {
+		h := setup()
+		userKey := streamKey{USER_STREAM, 1}
+		chatKey := streamKey{CHAT_STREAM, 2}
+		client := &sseClient{id: "a", key: userKey, events: make(chan sseEvent, 2)}
+		h.register <- client
+		h.addStream(client, chatKey)
+
+		h.publish(userKey, sseEvent{event: "user-event"})
+		h.publish(chatKey, sseEvent{event: "chat-event"})
+		event, _ := receiveEvent(t, client)
+		assert.Equals(t, event.event, "user-event")
+		event, _ = receiveEvent(t, client)
+		assert.Equals(t, event.event, "chat-event")
+		assert.DeepEquals(t, h.getMetrics(), SSEMetrics{
+			ConnectedClients: 1,
+			ChatStreams:      1,
+			UserStreams:      1,
+			EventsSent:       2,
+		})
+
+		h.unregister <- client
+		h.addStream(client, chatKey) // ignored once unregistered
+		assert.DeepEquals(t, h.getMetrics(), SSEMetrics{EventsSent: 2})
+	})
+
+	t.Run("RemoveStream", func(t *testing.T) {
+		h := setup()
+		userKey := streamKey{USER_STREAM, 1}
+		chatKey := streamKey{CHAT_STREAM, 2}
+		client := registerTestClient(t, h, userKey, 2)
+		h.addStream(client, chatKey)
+
+		h.removeStream(client, chatKey)
+		h.publish(chatKey, sseEvent{event: "chat-event"})
+		h.publish(userKey, sseEvent{event: "user-event"})
+		event, _ := receiveEvent(t, client)
+		assert.Equals(t, event.event, "user-event")
+		assert.DeepEquals(t, h.getMetrics(), SSEMetrics{
+			ConnectedClients: 1,
+			UserStreams:      1,
+			EventsSent:       1,
+		})
+	})
+
+	t.Run("EvictsSlowClient", func(t *testing.T) {
 		buf := logger.MockFileLogger(t)
+		h := setup()
+		key := streamKey{CHAT_STREAM, 1}
+		slowClient := registerTestClient(t, h, key, 1)
+		client := registerTestClient(t, h, key, 2)
+
+		h.publish(key, sseEvent{event: "event-one", data: ""})
+		h.publish(key, sseEvent{event: "event-two", data: ""})
+		metrics := h.getMetrics()
+		assert.Equals(t, metrics.ConnectedClients, 1)
+		assert.Equals(t, metrics.Evictions, 1)
+		assert.Contains(t, buf.String(), "[WARNING]", "evicted, buffer is full")
+
+		event, ok := receiveEvent(t, slowClient)
+		assert.Equals(t, ok, true)
+		assert.Equals(t, event.event, "event-one")
+		_, ok = receiveEvent(t, slowClient)
+		assert.Equals(t, ok, false)
+		assert.Equals(t, len(client.events), 2)
+	})
+}
 
+func TestServeSSEClient(t *testing.T) {
+	config.CreateConfig()
+	setup := func() (*response.Writer, *http.Request, context.CancelFunc, *sseHub) {
+		h := newSSEHub()
+		go h.run()
+		w := upgradeConnection(response.NewWriter(httptest.NewRecorder()))
 		ctx, cancel := context.WithCancel(context.Background())
 		r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/test", nil)
+		return w, r, cancel, h
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		buf := logger.MockFileLogger(t)
+		w, r, cancel, h := setup()
+		key := streamKey{CHAT_STREAM, 1}
+
 		done := make(chan bool)
 		go func() {
-			trapConnection(r, connectionIndex, key, connectionID)
+			serveSSEClient(w, r, h, key, "")
 			done <- true
 		}()
 
 		time.Sleep(100 * time.Millisecond)
-		assert.Contains(t, buf.String(), "opened")
-		assert.NotContains(t, buf.String(), "closed")
-
+		h.publish(key, sseEvent{event: "test-event", data: "Hello World!"})
+		time.Sleep(100 * time.Millisecond)
 		cancel()
 		select {
 		case <-done:
-			assert.Contains(t, buf.String(), "closed")
+			assert.Contains(t, string(w.Body), "event: test-event\ndata: Hello World!")
+			assert.Contains(t, buf.String(), "opened", "sent 'test-event' event", "closed")
+			assert.Equals(t, h.getMetrics().ConnectedClients, 0)
 		case <-time.After(1 * time.Second):
 			t.Error("test timed out")
 		}
 	})
-}
 
-func TestCloseSSEConnection(t *testing.T) {
-	setup := func() connectionIndex {
-		w := response.NewWriter(httptest.NewRecorder())
-		return connectionIndex{
-			0: {"a": w},
-			1: {"a": w, "b": w, "c": w},
-		}
-	}
+	t.Run("ClosesOnEvent", func(t *testing.T) {
+		w, r, _, h := setup()
+		key := streamKey{CHAT_STREAM, 1}
 
-	t.Run("Normal", func(t *testing.T) {
-		xConnectionIndex := setup()
-		var controlKey int64 = 0
-		var testKey int64 = 1
-
-		closeSSEConnection(xConnectionIndex, testKey, "b")
-		keys, _ := collections.MapEntries(xConnectionIndex[controlKey])
-		assert.HasLength(t, keys, 1)
-		keys, _ = collections.MapEntries(xConnectionIndex[testKey])
-		sort.Strings(keys)
-		assert.HasLength(t, keys, 2)
-		assert.Equals(t, keys[0], "a")
-		assert.Equals(t, keys[1], "c")
-	})
-
-	t.Run("CleansEmptyKeys", func(t *testing.T) {
-		xConnectionIndex := setup()
-		var emptyKey int64 = 0
-		var nonEmptyKey int64 = 1
-
-		closeSSEConnection(xConnectionIndex, emptyKey, "a")
-		keys, _ := collections.MapEntries(xConnectionIndex[nonEmptyKey])
-		assert.HasLength(t, keys, 3)
-		_, ok := xConnectionIndex[emptyKey]
-		assert.Equals(t, ok, false)
-	})
-}
-
-func TestSendEvent(t *testing.T) {
-	t.Run("Normal", func(t *testing.T) {
-		w := response.NewWriter(httptest.NewRecorder())
-		connectionID := "a"
-		connections := connectionMap{connectionID: w}
-		buf := logger.MockFileLogger(t)
-		xEvent := "test-event"
-		xData := "Hello World!"
-		xMessage := fmt.Sprintf("[SSE connection %s] sent '%s' event", connectionID, xEvent)
+		done := make(chan bool)
+		go func() {
+			serveSSEClient(w, r, h, key, "close-event")
+			done <- true
+		}()
 
-		sendEvent(connections, xEvent, xData)
-		assert.Equals(t, w.Status, http.StatusOK)
-		assert.Contains(t, string(w.Body), xEvent, xData)
-		assert.Contains(t, buf.String(), xMessage)
+		time.Sleep(100 * time.Millisecond)
+		h.publish(key, sseEvent{event: "test-event"})
+		h.publish(key, sseEvent{event: "close-event"})
+		select {
+		case <-done:
+			assert.Contains(t, string(w.Body), "event: test-event", "event: redirect")
+			assert.Equals(t, strings.Contains(string(w.Body), "close-event"), false)
+			assert.Equals(t, h.getMetrics().ConnectedClients, 0)
+		case <-time.After(1 * time.Second):
+			t.Error("test timed out")
+		}
 	})
 
-	t.Run("SendsMultiple", func(t *testing.T) {
-		w1 := response.NewWriter(httptest.NewRecorder())
-		w2 := response.NewWriter(httptest.NewRecorder())
-		connections := connectionMap{"a": w1, "b": w2}
-		xEvent := "test-event"
-		xData := "Hello World!"
+	t.Run("SendsHeartbeats", func(t *testing.T) {
+		w, r, cancel, h := setup()
+		config.Values.SSE.SecondsBetweenHeartbeats = 1
+		defer config.CreateConfig()
 
-		sendEvent(connections, xEvent, xData)
-		assert.Equals(t, w1.Status, http.StatusOK)
-		assert.Contains(t, string(w1.Body), xEvent, xData)
-		assert.Equals(t, w2.Status, http.StatusOK)
-		assert.Contains(t, string(w2.Body), xEvent, xData)
+		done := make(chan bool)
+		go func() {
+			serveSSEClient(w, r, h, streamKey{CHAT_STREAM, 1}, "")
+			done <- true
+		}()
+
+		time.Sleep(1200 * time.Millisecond)
+		cancel()
+		<-done
+		assert.Contains(t, string(w.Body), ": heartbeat\n\n")
 	})
+
 }
@@ -0,0 +1,194 @@
+package resolvers
+
+import (
+	"fmt"
+
+	"github.com/raphael-p/beango/utils/logger"
+)
+
+type streamScope string
+
+const (
+	CHAT_STREAM streamScope = "chat"
+	USER_STREAM streamScope = "user"
+)
+
+// Identifies the set of clients an event is sent to, e.g. all the clients
+// listening to a given chat
+type streamKey struct {
+	scope streamScope
+	id    int64
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// A connection as seen by the hub, SSE or WebSocket. It listens to `key` from
+// the moment it registers, and to any stream it subscribes to afterwards. The
+// hub closes `events` once it has stopped sending to the client, whether it
+// unregistered or was evicted.
+type sseClient struct {
+	id     string
+	key    streamKey
+	keys   map[streamKey]bool // only touched by the hub's run loop
+	events chan sseEvent
+}
+
+type sseSubscription struct {
+	client *sseClient
+	key    streamKey
+}
+
+type sseBroadcast struct {
+	key streamKey
+	sseEvent
+}
+
+type SSEMetrics struct {
+	ConnectedClients int    `json:"connectedClients"`
+	ChatStreams      int    `json:"chatStreams"`
+	UserStreams      int    `json:"userStreams"`
+	EventsSent       uint64 `json:"eventsSent"`
+	Evictions        uint64 `json:"evictions"`
+}
+
+// Owns every realtime connection. All access to the index goes through the
+// run loop, so request goroutines never touch it directly.
+type sseHub struct {
+	register    chan *sseClient
+	subscribe   chan sseSubscription
+	unsubscribe chan sseSubscription
+	unregister  chan *sseClient
+	broadcast   chan sseBroadcast
+	metrics     chan chan SSEMetrics
+	clients     map[string]*sseClient
+	index       map[streamKey]map[string]*sseClient
+	eventsSent  uint64
+	evictions   uint64
+}
+
+var hub = newSSEHub()
+
+func init() {
+	go hub.run()
+}
+
+func newSSEHub() *sseHub {
+	return &sseHub{
+		register:    make(chan *sseClient),
+		subscribe:   make(chan sseSubscription),
+		unsubscribe: make(chan sseSubscription),
+		unregister:  make(chan *sseClient),
+		broadcast:   make(chan sseBroadcast),
+		metrics:     make(chan chan SSEMetrics),
+		clients:     map[string]*sseClient{},
+		index:       map[streamKey]map[string]*sseClient{},
+	}
+}
+
+func (h *sseHub) run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client.id] = client
+			client.keys = map[streamKey]bool{}
+			h.addToStream(client, client.key)
+		case subscription := <-h.subscribe:
+			if h.clients[subscription.client.id] == subscription.client {
+				h.addToStream(subscription.client, subscription.key)
+			}
+		case subscription := <-h.unsubscribe:
+			if h.clients[subscription.client.id] == subscription.client {
+				h.removeFromStream(subscription.client, subscription.key)
+			}
+		case client := <-h.unregister:
+			h.removeClient(client)
+		case message := <-h.broadcast:
+			for _, client := range h.index[message.key] {
+				select {
+				case client.events <- message.sseEvent:
+					h.eventsSent++
+				default:
+					h.evictions++
+					h.removeClient(client)
+					logger.Warning(fmt.Sprintf("[SSE connection %s] evicted, buffer is full", client.id))
+				}
+			}
+		case reply := <-h.metrics:
+			reply <- h.snapshot()
+		}
+	}
+}
+
+func (h *sseHub) addToStream(client *sseClient, key streamKey) {
+	clients, ok := h.index[key]
+	if !ok {
+		clients = map[string]*sseClient{}
+		h.index[key] = clients
+	}
+	clients[client.id] = client
+	client.keys[key] = true
+}
+
+func (h *sseHub) removeFromStream(client *sseClient, key streamKey) {
+	clients := h.index[key]
+	delete(clients, client.id)
+	if len(clients) == 0 {
+		delete(h.index, key)
+	}
+	delete(client.keys, key)
+}
+
+// Removes a client from every stream it listens to and closes its channel,
+// does nothing if the client was already removed
+func (h *sseHub) removeClient(client *sseClient) {
+	if h.clients[client.id] != client {
+		return
+	}
+
+	delete(h.clients, client.id)
+	for key := range client.keys {
+		h.removeFromStream(client, key)
+	}
+	close(client.events)
+}
+
+func (h *sseHub) snapshot() SSEMetrics {
+	metrics := SSEMetrics{
+		ConnectedClients: len(h.clients),
+		EventsSent:       h.eventsSent,
+		Evictions:        h.evictions,
+	}
+	for key := range h.index {
+		switch key.scope {
+		case CHAT_STREAM:
+			metrics.ChatStreams++
+		case USER_STREAM:
+			metrics.UserStreams++
+		}
+	}
+	return metrics
+}
+
+// Adds a stream to a registered client, e.g. when a user joins a chat
+func (h *sseHub) addStream(client *sseClient, key streamKey) {
+	h.subscribe <- sseSubscription{client, key}
+}
+
+// Removes a stream from a registered client, e.g. when a user leaves a chat
+func (h *sseHub) removeStream(client *sseClient, key streamKey) {
+	h.unsubscribe <- sseSubscription{client, key}
+}
+
+func (h *sseHub) publish(key streamKey, event sseEvent) {
+	h.broadcast <- sseBroadcast{key, event}
+}
+
+func (h *sseHub) getMetrics() SSEMetrics {
+	reply := make(chan SSEMetrics)
+	h.metrics <- reply
+	return <-reply
+}
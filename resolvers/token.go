@@ -0,0 +1,142 @@
+package resolvers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/response"
+	"github.com/raphael-p/beango/utils/validate"
+)
+
+const MAX_TOKEN_NAME_LENGTH int = 50
+
+type createAPITokenInput struct {
+	Name          string                    `json:"name"`
+	Scopes        []database.TokenScope     `json:"scopes"`
+	ExpiresInDays validate.JSONField[int64] `json:"expiresInDays" optional:"true"`
+}
+
+// Tokens do not expire unless expiresInDays is set
+func validateCreateAPITokenInput(input *createAPITokenInput) *resolverutils.HTTPError {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len([]rune(input.Name)) > MAX_TOKEN_NAME_LENGTH {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("token name must be between 1 and %d characters", MAX_TOKEN_NAME_LENGTH),
+		}
+	}
+	if len(input.Scopes) == 0 {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "token must have at least one scope",
+		}
+	}
+	for _, scope := range input.Scopes {
+		if !slices.Contains(database.TOKEN_SCOPES, scope) {
+			return &resolverutils.HTTPError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("invalid token scope '%s', must be one of %v", scope, database.TOKEN_SCOPES),
+			}
+		}
+	}
+	slices.Sort(input.Scopes)
+	input.Scopes = slices.Compact(input.Scopes)
+	if input.ExpiresInDays.IsSet && input.ExpiresInDays.Value <= 0 {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "expiresInDays must be positive",
+		}
+	}
+	return nil
+}
+
+// The token itself is only ever returned here
+type createAPITokenOutput struct {
+	database.APIToken
+	Token string `json:"token"`
+}
+
+func createAPITokenDatabase(userID int64, input *createAPITokenInput, conn database.Connection) (*createAPITokenOutput, *resolverutils.HTTPError) {
+	token, prefix, hash, err := authenticate.NewAPIToken()
+	if err != nil {
+		logger.Error("failed to generate API token: " + err.Error())
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to generate API token",
+		}
+	}
+
+	now := time.Now().UTC()
+	apiToken := &database.APIToken{
+		UserID:    userID,
+		Name:      input.Name,
+		Hash:      hash,
+		Prefix:    prefix,
+		Scopes:    input.Scopes,
+		CreatedAt: now,
+	}
+	if input.ExpiresInDays.IsSet {
+		expiryDate := now.AddDate(0, 0, int(input.ExpiresInDays.Value))
+		apiToken.ExpiryDate = &expiryDate
+	}
+	apiToken, err = conn.SetAPIToken(apiToken)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return &createAPITokenOutput{*apiToken, token}, nil
+}
+
+func CreateAPIToken(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input createAPITokenInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	if resolverutils.ProcessHTTPError(w, validateCreateAPITokenInput(&input)) {
+		return
+	}
+
+	output, httpError := createAPITokenDatabase(user.ID, &input, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteJSON(http.StatusCreated, output)
+}
+
+func GetAPITokens(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	tokens, err := conn.GetAPITokensByUserID(user.ID)
+	if resolverutils.ProcessHTTPError(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+	w.WriteJSON(http.StatusOK, tokens)
+}
+
+// Revokes a token of the user, it cannot be used from then on
+func DeleteAPIToken(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.TOKEN_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	deleted, err := conn.DeleteAPIToken(params.TokenID, user.ID)
+	if resolverutils.ProcessHTTPError(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+	if !deleted {
+		w.WriteString(http.StatusNotFound, "API token not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,138 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+)
+
+func TestValidateCreateAPITokenInput(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		input := &createAPITokenInput{
+			Name:   " beans bot ",
+			Scopes: []database.TokenScope{database.WRITE_SCOPE, database.READ_SCOPE, database.WRITE_SCOPE},
+		}
+		httpError := validateCreateAPITokenInput(input)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, input.Name, "beans bot")
+		assert.DeepEquals(t, input.Scopes, []database.TokenScope{database.READ_SCOPE, database.WRITE_SCOPE})
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		testCases := map[string]*createAPITokenInput{
+			"token name must be between 1 and 50 characters": {
+				Name:   strings.Repeat("a", 51),
+				Scopes: database.TOKEN_SCOPES,
+			},
+			"token must have at least one scope": {Name: "beans bot", Scopes: []database.TokenScope{}},
+			"invalid token scope 'admin', must be one of [read write]": {
+				Name:   "beans bot",
+				Scopes: []database.TokenScope{"admin"},
+			},
+		}
+		for xMessage, input := range testCases {
+			httpError := validateCreateAPITokenInput(input)
+			resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+		}
+	})
+}
+
+func TestCreateAPIToken(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"name": "beans bot", "scopes": ["read"], "expiresInDays": 30}`)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		CreateAPIToken(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusCreated)
+		var output map[string]any
+		json.Unmarshal(w.Body, &output)
+		assert.NotContains(t, string(w.Body), `"hash"`)
+		token := output["token"].(string)
+		assert.Contains(t, token, authenticate.API_TOKEN_PREFIX, output["prefix"].(string))
+
+		tokens, _ := conn.GetAPITokensByUserID(mocks.ADMIN_ID)
+		assert.HasLength(t, tokens, 1)
+		assert.Equals(t, tokens[0].Hash, authenticate.HashAPIToken(token))
+		assert.DeepEquals(t, tokens[0].Scopes, database.TokenScopes{database.READ_SCOPE})
+		expiry := tokens[0].ExpiryDate.Sub(tokens[0].CreatedAt)
+		assert.Equals(t, expiry, 30*24*time.Hour)
+	})
+
+	t.Run("NoExpiry", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"name": "beans bot", "scopes": ["read", "write"]}`)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		CreateAPIToken(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusCreated)
+		tokens, _ := conn.GetAPITokensByUserID(mocks.ADMIN_ID)
+		assert.IsNil(t, tokens[0].ExpiryDate)
+	})
+
+	t.Run("InvalidExpiry", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"name": "beans bot", "scopes": ["read"], "expiresInDays": 0}`)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		CreateAPIToken(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "expiresInDays must be positive")
+	})
+}
+
+func TestGetAPITokens(t *testing.T) {
+	w, r, conn := resolverutils.CommonSetup("")
+	r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+	user, _ := conn.SetUser(mocks.MakeUser())
+	for _, userID := range []int64{mocks.ADMIN_ID, user.ID, mocks.ADMIN_ID} {
+		conn.SetAPIToken(&database.APIToken{UserID: userID, Hash: "hash", Scopes: database.TOKEN_SCOPES})
+	}
+
+	GetAPITokens(w, r, conn)
+	assert.Equals(t, w.Status, http.StatusOK)
+	var output []database.APIToken
+	json.Unmarshal(w.Body, &output)
+	assert.HasLength(t, output, 2)
+	assert.Equals(t, output[0].ID, 1)
+	assert.Equals(t, output[1].ID, 3)
+	assert.NotContains(t, string(w.Body), "hash")
+}
+
+func TestDeleteAPIToken(t *testing.T) {
+	setup := func(t *testing.T, userID int64) (*database.APIToken, func(tokenID int64) (int, string)) {
+		_, _, conn := resolverutils.CommonSetup("")
+		token, _ := conn.SetAPIToken(&database.APIToken{UserID: userID, Scopes: database.TOKEN_SCOPES})
+		return token, func(tokenID int64) (int, string) {
+			w, r, _ := resolverutils.CommonSetup("")
+			params := map[string]string{resolverutils.TOKEN_ID_KEY: fmt.Sprint(tokenID)}
+			r = resolverutils.SetContext(t, r, mocks.Admin, params)
+			DeleteAPIToken(w, r, conn)
+			return w.Status, string(w.Body)
+		}
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		token, deleteToken := setup(t, mocks.ADMIN_ID)
+
+		status, _ := deleteToken(token.ID)
+		assert.Equals(t, status, http.StatusNoContent)
+		status, body := deleteToken(token.ID)
+		assert.Equals(t, status, http.StatusNotFound)
+		assert.Equals(t, body, "API token not found")
+	})
+
+	t.Run("OtherUser", func(t *testing.T) {
+		token, deleteToken := setup(t, 12)
+
+		status, body := deleteToken(token.ID)
+		assert.Equals(t, status, http.StatusNotFound)
+		assert.Equals(t, body, "API token not found")
+	})
+}
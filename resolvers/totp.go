@@ -0,0 +1,322 @@
+package resolvers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/response"
+	"github.com/raphael-p/beango/utils/totp"
+)
+
+const (
+	TOTP_ISSUER         string = "Beango"
+	RECOVERY_CODE_COUNT int    = 10
+	// How long a user has to enter their code after their password
+	PRE_AUTH_SECONDS int = 300
+	// A pre-auth token is dropped after this many wrong codes, so that codes
+	// cannot be guessed
+	PRE_AUTH_MAX_ATTEMPTS int64 = 5
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Spaces and dashes are ignored in codes, and recovery codes are not case-sensitive
+func normaliseCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func hashRecoveryCode(code string) string {
+	hash := sha256.Sum256([]byte(normaliseCode(code)))
+	return hex.EncodeToString(hash[:])
+}
+
+// Generates recovery codes such as "abcde-fghij", along with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RECOVERY_CODE_COUNT)
+	hashes := make([]string, RECOVERY_CODE_COUNT)
+	for i := range codes {
+		randomBytes := make([]byte, 7)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(randomBytes)[:10])
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// Accepts either a TOTP code that has not been used yet, or an unused recovery code
+func checkSecondFactor(userID int64, secret, code string, conn database.Connection) *resolverutils.HTTPError {
+	code = normaliseCode(code)
+	var used bool
+	var err error
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		used, err = conn.UseTOTPStep(userID, step)
+	} else {
+		used, err = conn.UseRecoveryCode(userID, hashRecoveryCode(code))
+	}
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if !used {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusUnauthorized,
+			Message: "verification code is incorrect",
+		}
+	}
+	return nil
+}
+
+// Creates a session for the user, unless they have two-factor authentication
+// enabled. A pre-auth token is returned instead then, to be exchanged for a
+// session along with a code (see verifyLoginCode).
+func startLogin(w *response.Writer, r *http.Request, userID int64, conn database.Connection) (*database.PreAuthToken, *resolverutils.HTTPError) {
+	userTOTP, err := conn.GetTOTP(userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if !userTOTP.IsEnabled() {
+		return nil, setSession(w, makeSession(userID, r), conn)
+	}
+
+	token := database.PreAuthToken{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		ExpiryDate: time.Now().UTC().Add(time.Duration(PRE_AUTH_SECONDS) * time.Second),
+	}
+	if err := conn.SetPreAuthToken(token); err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return &token, nil
+}
+
+type loginCodeInput struct {
+	PreAuthToken string `json:"preAuthToken"`
+	Code         string `json:"code"`
+}
+
+func verifyLoginCode(w *response.Writer, r *http.Request, input *loginCodeInput, conn database.Connection) *resolverutils.HTTPError {
+	expired := &resolverutils.HTTPError{
+		Status:  http.StatusUnauthorized,
+		Message: "login has expired, please log in again",
+	}
+	token, err := conn.CheckPreAuthToken(input.PreAuthToken, PRE_AUTH_MAX_ATTEMPTS)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if token == nil {
+		return expired
+	}
+	userTOTP, err := conn.GetTOTP(token.UserID)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if !userTOTP.IsEnabled() {
+		return expired
+	}
+
+	httpError := checkSecondFactor(token.UserID, userTOTP.Secret, input.Code, conn)
+	recordLoginAttempt(r, httpError)
+	if httpError != nil {
+		return httpError
+	}
+	if err := conn.DeletePreAuthToken(token.ID); err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	return setSession(w, makeSession(token.UserID, r), conn)
+}
+
+// The second step of logging in, for users with two-factor authentication
+func VerifySessionCode(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input loginCodeInput
+	if resolverutils.ProcessHTTPError(w, resolverutils.GetRequestBody(r, &input)) {
+		return
+	}
+	if resolverutils.ProcessHTTPError(w, verifyLoginCode(w, r, &input, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type totpStatusOutput struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recoveryCodesLeft"`
+}
+
+func getTOTPStatusDatabase(userID int64, conn database.Connection) (*totpStatusOutput, *resolverutils.HTTPError) {
+	userTOTP, err := conn.GetTOTP(userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if !userTOTP.IsEnabled() {
+		return &totpStatusOutput{}, nil
+	}
+	count, err := conn.CountRecoveryCodes(userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return &totpStatusOutput{true, count}, nil
+}
+
+func GetTOTPStatus(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	status, httpError := getTOTPStatusDatabase(user.ID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteJSON(http.StatusOK, status)
+}
+
+// The secret is to be added to an authenticator app, by hand or through the URI
+type totpSetupOutput struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningURI"`
+}
+
+// Starts setting up two-factor authentication, it is only enabled once a code
+// has been confirmed (see enableTOTPDatabase)
+func startTOTPSetupDatabase(user *database.User, conn database.Connection) (*totpSetupOutput, *resolverutils.HTTPError) {
+	userTOTP, err := conn.GetTOTP(user.ID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if userTOTP.IsEnabled() {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusConflict,
+			Message: "two-factor authentication is already enabled",
+		}
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error("failed to generate TOTP secret: " + err.Error())
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to generate TOTP secret",
+		}
+	}
+	if err := conn.SetTOTP(user.ID, secret); err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return &totpSetupOutput{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(TOTP_ISSUER, user.Username, secret),
+	}, nil
+}
+
+func StartTOTPSetup(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	output, httpError := startTOTPSetupDatabase(user, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteJSON(http.StatusCreated, output)
+}
+
+type totpCodeInput struct {
+	Code string `json:"code"`
+}
+
+// Enables two-factor authentication if the code matches the secret being set
+// up, returns the recovery codes, which are only shown this once
+func enableTOTPDatabase(userID int64, code string, conn database.Connection) ([]string, *resolverutils.HTTPError) {
+	userTOTP, err := conn.GetTOTP(userID)
+	if err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	if userTOTP == nil {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "two-factor authentication setup has not been started",
+		}
+	}
+	if userTOTP.IsEnabled() {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusConflict,
+			Message: "two-factor authentication is already enabled",
+		}
+	}
+	step, ok := totp.Validate(userTOTP.Secret, normaliseCode(code), time.Now())
+	if !ok {
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "verification code is incorrect",
+		}
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logger.Error("failed to generate recovery codes: " + err.Error())
+		return nil, &resolverutils.HTTPError{
+			Status:  http.StatusInternalServerError,
+			Message: "failed to generate recovery codes",
+		}
+	}
+	if err := conn.EnableTOTP(userID, step, hashes); err != nil {
+		return nil, resolverutils.HandleDatabaseError(err)
+	}
+	return codes, nil
+}
+
+func EnableTOTP(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input totpCodeInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	codes, httpError := enableTOTPDatabase(user.ID, input.Code, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteJSON(http.StatusOK, map[string][]string{"recoveryCodes": codes})
+}
+
+// Turning two-factor authentication off takes a code, or a recovery code
+func disableTOTPDatabase(userID int64, code string, conn database.Connection) *resolverutils.HTTPError {
+	userTOTP, err := conn.GetTOTP(userID)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if !userTOTP.IsEnabled() {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "two-factor authentication is not enabled",
+		}
+	}
+	if httpError := checkSecondFactor(userID, userTOTP.Secret, code, conn); httpError != nil {
+		return httpError
+	}
+	return resolverutils.HandleDatabaseError(conn.DeleteTOTP(userID))
+}
+
+func DisableTOTP(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input totpCodeInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	if resolverutils.ProcessHTTPError(w, disableTOTPDatabase(user.ID, input.Code, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
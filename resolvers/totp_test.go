@@ -0,0 +1,214 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/totp"
+)
+
+// Enables two-factor authentication for the admin, returns the secret and recovery codes
+func enableAdminTOTP(t *testing.T, conn database.Connection) (string, []string) {
+	secret, err := totp.GenerateSecret()
+	assert.IsNil(t, err)
+	codes, hashes, err := generateRecoveryCodes()
+	assert.IsNil(t, err)
+	conn.SetTOTP(mocks.ADMIN_ID, secret)
+	conn.EnableTOTP(mocks.ADMIN_ID, 0, hashes)
+	return secret, codes
+}
+
+func currentCode(t *testing.T, secret string) string {
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	assert.IsNil(t, err)
+	return code
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		codes, hashes, err := generateRecoveryCodes()
+		assert.IsNil(t, err)
+		assert.HasLength(t, codes, RECOVERY_CODE_COUNT)
+		assert.HasLength(t, hashes, RECOVERY_CODE_COUNT)
+		assert.Equals(t, len(codes[0]), 11)
+		assert.Equals(t, codes[0][5:6], "-")
+		assert.Equals(t, hashRecoveryCode(codes[0]), hashes[0])
+		assert.Equals(t, hashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" "), hashes[0])
+	})
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		secret, _ := enableAdminTOTP(t, conn)
+
+		code := currentCode(t, secret)
+		httpError := checkSecondFactor(mocks.ADMIN_ID, secret, code, conn)
+		assert.IsNil(t, httpError)
+	})
+
+	t.Run("CodeReused", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		secret, _ := enableAdminTOTP(t, conn)
+
+		code := currentCode(t, secret)
+		checkSecondFactor(mocks.ADMIN_ID, secret, code, conn)
+		httpError := checkSecondFactor(mocks.ADMIN_ID, secret, code, conn)
+		xMessage := "verification code is incorrect"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, xMessage)
+	})
+
+	t.Run("RecoveryCode", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		secret, recoveryCodes := enableAdminTOTP(t, conn)
+
+		httpError := checkSecondFactor(mocks.ADMIN_ID, secret, recoveryCodes[3], conn)
+		assert.IsNil(t, httpError)
+		count, _ := conn.CountRecoveryCodes(mocks.ADMIN_ID)
+		assert.Equals(t, count, int64(RECOVERY_CODE_COUNT-1))
+
+		httpError = checkSecondFactor(mocks.ADMIN_ID, secret, recoveryCodes[3], conn)
+		xMessage := "verification code is incorrect"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, xMessage)
+	})
+}
+
+func TestVerifySessionCode(t *testing.T) {
+	config.CreateConfig()
+
+	setup := func(t *testing.T, code func(secret string) string) (string, *database.PreAuthToken, int) {
+		w, r, conn := resolverutils.CommonSetup("")
+		secret, _ := enableAdminTOTP(t, conn)
+		token, httpError := startLogin(w, r, mocks.ADMIN_ID, conn)
+		assert.IsNil(t, httpError)
+		assert.IsNotNil(t, token)
+		assert.HasLength(t, w.Header()["Set-Cookie"], 0)
+		body := fmt.Sprintf(`{"preAuthToken": "%s", "code": "%s"}`, token.ID, code(secret))
+		w, r, _ = resolverutils.CommonSetup(body)
+
+		VerifySessionCode(w, r, conn)
+		return string(w.Body), token, len(w.Header()["Set-Cookie"])
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		_, _, cookieCount := setup(t, func(secret string) string { return currentCode(t, secret) })
+		assert.Equals(t, cookieCount, 1)
+	})
+
+	t.Run("WrongCode", func(t *testing.T) {
+		body, _, cookieCount := setup(t, func(string) string { return "000000 " })
+		assert.Equals(t, cookieCount, 0)
+		assert.Contains(t, body, "verification code is incorrect")
+	})
+
+	t.Run("TooManyAttempts", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		secret, _ := enableAdminTOTP(t, conn)
+		token, _ := startLogin(w, r, mocks.ADMIN_ID, conn)
+		for i := int64(0); i < PRE_AUTH_MAX_ATTEMPTS; i++ {
+			input := &loginCodeInput{token.ID, "wrong"}
+			httpError := verifyLoginCode(w, r, input, conn)
+			resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, "verification code is incorrect")
+		}
+
+		input := &loginCodeInput{token.ID, currentCode(t, secret)}
+		httpError := verifyLoginCode(w, r, input, conn)
+		xMessage := "login has expired, please log in again"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, xMessage)
+	})
+}
+
+func TestStartTOTPSetup(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		StartTOTPSetup(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusCreated)
+		var output totpSetupOutput
+		json.Unmarshal(w.Body, &output)
+		assert.Contains(t, output.ProvisioningURI, "otpauth://totp/Beango:"+mocks.ADMIN_USERNAME, output.Secret)
+		userTOTP, _ := conn.GetTOTP(mocks.ADMIN_ID)
+		assert.Equals(t, userTOTP.Secret, output.Secret)
+		assert.Equals(t, userTOTP.IsEnabled(), false)
+	})
+
+	t.Run("AlreadyEnabled", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		enableAdminTOTP(t, conn)
+
+		StartTOTPSetup(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusConflict)
+		assert.Contains(t, string(w.Body), "two-factor authentication is already enabled")
+	})
+}
+
+func TestEnableTOTP(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		secret, _ := totp.GenerateSecret()
+		conn.SetTOTP(mocks.ADMIN_ID, secret)
+
+		codes, httpError := enableTOTPDatabase(mocks.ADMIN_ID, currentCode(t, secret), conn)
+		assert.IsNil(t, httpError)
+		assert.HasLength(t, codes, RECOVERY_CODE_COUNT)
+		userTOTP, _ := conn.GetTOTP(mocks.ADMIN_ID)
+		assert.Equals(t, userTOTP.IsEnabled(), true)
+		count, _ := conn.CountRecoveryCodes(mocks.ADMIN_ID)
+		assert.Equals(t, count, int64(RECOVERY_CODE_COUNT))
+
+		// the code used to enable it cannot be used to log in
+		httpError = checkSecondFactor(mocks.ADMIN_ID, secret, currentCode(t, secret), conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, "verification code is incorrect")
+	})
+
+	t.Run("NotStarted", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		_, httpError := enableTOTPDatabase(mocks.ADMIN_ID, "123456", conn)
+		xMessage := "two-factor authentication setup has not been started"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, xMessage)
+	})
+
+	t.Run("WrongCode", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		secret, _ := totp.GenerateSecret()
+		conn.SetTOTP(mocks.ADMIN_ID, secret)
+
+		_, httpError := enableTOTPDatabase(mocks.ADMIN_ID, "12345", conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusBadRequest, "verification code is incorrect")
+		userTOTP, _ := conn.GetTOTP(mocks.ADMIN_ID)
+		assert.Equals(t, userTOTP.IsEnabled(), false)
+	})
+}
+
+func TestDisableTOTP(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		_, recoveryCodes := enableAdminTOTP(t, conn)
+		w, r, _ = resolverutils.CommonSetup(fmt.Sprintf(`{"code": "%s"}`, recoveryCodes[0]))
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		DisableTOTP(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		userTOTP, _ := conn.GetTOTP(mocks.ADMIN_ID)
+		assert.IsNil(t, userTOTP)
+	})
+
+	t.Run("NotEnabled", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup(`{"code": "123456"}`)
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		DisableTOTP(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Contains(t, string(w.Body), "two-factor authentication is not enabled")
+	})
+}
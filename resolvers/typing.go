@@ -0,0 +1,195 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/events"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/response"
+)
+
+// Sent on a chat's stream when one of its members starts or stops typing
+const TYPING_EVENT = "typing"
+
+type typingEventData struct {
+	ChatID   int64 `json:"chatID"`
+	UserID   int64 `json:"userID"`
+	IsTyping bool  `json:"isTyping"`
+}
+
+type typingKey struct {
+	chatID int64
+	userID int64
+}
+
+// Tracks who is typing in each chat. It is only ever held in memory: every
+// server instance fills its own store from the typing events on the bus, and
+// expires entries on its own.
+type typingStore struct {
+	mu       sync.Mutex
+	expiries map[typingKey]time.Time
+	onExpire func(chatID, userID int64)
+}
+
+var typing = newTypingStore(func(chatID, userID int64) {
+	// every instance expires the entry, so the event is not sent to the bus
+	data, _ := json.Marshal(typingEventData{chatID, userID, false})
+	hub.publish(streamKey{CHAT_STREAM, chatID}, sseEvent{event: TYPING_EVENT, data: string(data)})
+})
+
+func newTypingStore(onExpire func(chatID, userID int64)) *typingStore {
+	return &typingStore{expiries: map[typingKey]time.Time{}, onExpire: onExpire}
+}
+
+// Records that a user is typing until the given duration has passed
+func (s *typingStore) start(chatID, userID int64, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := typingKey{chatID, userID}
+	_, isTyping := s.expiries[key]
+	s.expiries[key] = time.Now().Add(duration)
+	if !isTyping {
+		time.AfterFunc(duration, func() { s.expire(key) })
+	}
+}
+
+// Removes the entry once its expiry has passed, it may have been pushed back
+// since the timer was set
+func (s *typingStore) expire(key typingKey) {
+	s.mu.Lock()
+	expiry, ok := s.expiries[key]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	if remaining := time.Until(expiry); remaining > 0 {
+		time.AfterFunc(remaining, func() { s.expire(key) })
+		s.mu.Unlock()
+		return
+	}
+	delete(s.expiries, key)
+	s.mu.Unlock()
+	s.onExpire(key.chatID, key.userID)
+}
+
+func (s *typingStore) stop(chatID, userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expiries, typingKey{chatID, userID})
+}
+
+func (s *typingStore) isTyping(chatID, userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.expiries[typingKey{chatID, userID}]
+	return ok
+}
+
+// Lists the users typing in a chat
+func (s *typingStore) userIDs(chatID int64) map[int64]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userIDs := map[int64]bool{}
+	for key := range s.expiries {
+		if key.chatID == chatID {
+			userIDs[key.userID] = true
+		}
+	}
+	return userIDs
+}
+
+// Bus subscriber that keeps the store of this instance up to date
+func trackTyping(event events.Event) {
+	if event.Name != TYPING_EVENT {
+		return
+	}
+	var data typingEventData
+	if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+		return
+	}
+	if data.IsTyping {
+		duration := time.Duration(config.Values.Typing.SecondsUntilExpiry) * time.Second
+		typing.start(data.ChatID, data.UserID, duration)
+	} else {
+		typing.stop(data.ChatID, data.UserID)
+	}
+}
+
+func sendTypingEvent(chatID, userID int64, isTyping bool) {
+	data, _ := json.Marshal(typingEventData{chatID, userID, isTyping})
+	SendChatEvent(chatID, TYPING_EVENT, string(data))
+}
+
+func sendTypingDatabase(userID, chatID int64, conn database.Connection) *resolverutils.HTTPError {
+	if chat, _ := conn.GetChat(chatID, userID); chat == nil {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "chat not found",
+		}
+	}
+	sendTypingEvent(chatID, userID, true)
+	return nil
+}
+
+// A user stops typing once their message is sent
+func stopTyping(chatID, userID int64) {
+	if typing.isTyping(chatID, userID) {
+		sendTypingEvent(chatID, userID, false)
+	}
+}
+
+// Describes who is typing in a chat, other than the user
+func typingDatabase(userID, chatID int64, conn database.Connection) (string, *resolverutils.HTTPError) {
+	if chat, _ := conn.GetChat(chatID, userID); chat == nil {
+		return "", &resolverutils.HTTPError{
+			Status:  http.StatusNotFound,
+			Message: "chat not found",
+		}
+	}
+
+	typingUserIDs := typing.userIDs(chatID)
+	delete(typingUserIDs, userID)
+	if len(typingUserIDs) == 0 {
+		return "", nil
+	}
+	users, err := conn.GetUsersByChatID(chatID)
+	if err != nil {
+		return "", resolverutils.HandleDatabaseError(err)
+	}
+
+	var displayNames []string
+	for _, user := range users {
+		if typingUserIDs[user.ID] {
+			displayNames = append(displayNames, user.DisplayName)
+		}
+	}
+	sort.Strings(displayNames)
+	switch len(displayNames) {
+	case 0:
+		return "", nil
+	case 1:
+		return displayNames[0] + " is typing…", nil
+	default:
+		return strings.Join(displayNames, ", ") + " are typing…", nil
+	}
+}
+
+func SendTyping(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, params, httpError := resolverutils.GetRequestContext(r, resolverutils.CHAT_ID_KEY)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	httpError = sendTypingDatabase(user.ID, params.ChatID, conn)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
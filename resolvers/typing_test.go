@@ -0,0 +1,139 @@
+package resolvers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+)
+
+func TestTypingStore(t *testing.T) {
+	t.Run("Expires", func(t *testing.T) {
+		expired := make(chan typingKey, 1)
+		store := newTypingStore(func(chatID, userID int64) { expired <- typingKey{chatID, userID} })
+
+		store.start(1, 2, 10*time.Millisecond)
+		assert.Equals(t, store.isTyping(1, 2), true)
+		select {
+		case key := <-expired:
+			assert.Equals(t, key, typingKey{1, 2})
+		case <-time.After(1 * time.Second):
+			t.Error("timed out waiting for expiry")
+		}
+		assert.Equals(t, store.isTyping(1, 2), false)
+	})
+
+	t.Run("ExtendedByStart", func(t *testing.T) {
+		expired := make(chan typingKey, 1)
+		store := newTypingStore(func(chatID, userID int64) { expired <- typingKey{chatID, userID} })
+
+		store.start(1, 2, 20*time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		store.start(1, 2, 50*time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		assert.Equals(t, store.isTyping(1, 2), true)
+		<-expired
+		assert.Equals(t, store.isTyping(1, 2), false)
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		expired := make(chan typingKey, 1)
+		store := newTypingStore(func(chatID, userID int64) { expired <- typingKey{chatID, userID} })
+
+		store.start(1, 2, 10*time.Millisecond)
+		store.start(3, 2, time.Minute)
+		store.stop(1, 2)
+		assert.Equals(t, store.isTyping(1, 2), false)
+		assert.DeepEquals(t, store.userIDs(3), map[int64]bool{2: true})
+		time.Sleep(20 * time.Millisecond)
+		assert.Equals(t, len(expired), 0)
+	})
+}
+
+func TestSendTyping(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Normal", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, chat.ID}, 1)
+		params := map[string]string{resolverutils.CHAT_ID_KEY: fmt.Sprint(chat.ID)}
+		r = resolverutils.SetContext(t, r, mocks.Admin, params)
+		t.Cleanup(func() { typing.stop(chat.ID, mocks.ADMIN_ID) })
+
+		SendTyping(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		assert.Equals(t, typing.isTyping(chat.ID, mocks.ADMIN_ID), true)
+		event, _ := receiveEvent(t, client)
+		assert.Equals(t, event.event, TYPING_EVENT)
+		xData := fmt.Sprintf(`{"chatID":%d,"userID":%d,"isTyping":true}`, chat.ID, mocks.ADMIN_ID)
+		assert.Equals(t, event.data, xData)
+	})
+
+	t.Run("ChatNotFound", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+
+		httpError := sendTypingDatabase(mocks.ADMIN_ID, 99, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
+
+func TestStopTyping(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("OnlyWhenTyping", func(t *testing.T) {
+		client := registerTestClient(t, hub, streamKey{CHAT_STREAM, 77}, 2)
+
+		stopTyping(77, 2)
+		sendTypingEvent(77, 2, true)
+		stopTyping(77, 2)
+		event, _ := receiveEvent(t, client)
+		assert.Contains(t, event.data, `"isTyping":true`)
+		event, _ = receiveEvent(t, client)
+		assert.Contains(t, event.data, `"isTyping":false`)
+		assert.Equals(t, typing.isTyping(77, 2), false)
+	})
+}
+
+func TestTypingDatabase(t *testing.T) {
+	config.CreateConfig()
+	_, _, conn := resolverutils.CommonSetup("")
+	amy, _ := conn.SetUser(mocks.MakeUser())
+	george, _ := conn.SetUser(mocks.MakeUser2())
+	chat, _ := conn.SetChat(mocks.MakeGroupChat(), amy.ID, george.ID, mocks.ADMIN_ID)
+	t.Cleanup(func() {
+		for _, userID := range []int64{amy.ID, george.ID, mocks.ADMIN_ID} {
+			typing.stop(chat.ID, userID)
+		}
+	})
+
+	t.Run("NobodyTyping", func(t *testing.T) {
+		description, httpError := typingDatabase(mocks.ADMIN_ID, chat.ID, conn)
+		assert.IsNil(t, httpError)
+		assert.Equals(t, description, "")
+	})
+
+	t.Run("ExcludesViewer", func(t *testing.T) {
+		typing.start(chat.ID, mocks.ADMIN_ID, time.Minute)
+		typing.start(chat.ID, amy.ID, time.Minute)
+		description, _ := typingDatabase(mocks.ADMIN_ID, chat.ID, conn)
+		assert.Equals(t, description, amy.DisplayName+" is typing…")
+	})
+
+	t.Run("Several", func(t *testing.T) {
+		typing.start(chat.ID, george.ID, time.Minute)
+		description, _ := typingDatabase(mocks.ADMIN_ID, chat.ID, conn)
+		assert.Equals(t, description, george.DisplayName+", "+amy.DisplayName+" are typing…")
+	})
+
+	t.Run("ChatNotFound", func(t *testing.T) {
+		_, httpError := typingDatabase(mocks.ADMIN_ID, 99, conn)
+		resolverutils.AssertHTTPError(t, httpError, http.StatusNotFound, "chat not found")
+	})
+}
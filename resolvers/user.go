@@ -5,8 +5,10 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/raphael-p/beango/config"
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/cookies"
 	"github.com/raphael-p/beango/utils/response"
 	"github.com/raphael-p/beango/utils/validate"
 	"golang.org/x/crypto/bcrypt"
@@ -64,14 +66,41 @@ func validateCreateUserInput(input *createUserInput) *resolverutils.HTTPError {
 	return nil
 }
 
+// The rules for a new password, whether it is set at sign up, changed or reset
+func validatePassword(password string) *resolverutils.HTTPError {
+	if strings.TrimSpace(password) == "" {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "password may not be blank",
+		}
+	}
+	// bcrypt ignores anything past this, see bcrypt.ErrPasswordTooLong
+	if len(password) > 72 {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "password must be shorter than 73 bytes",
+		}
+	}
+	return nil
+}
+
+// Hashes a password with the configured bcrypt cost
+func hashPassword(password string) ([]byte, *resolverutils.HTTPError) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), int(config.Values.Password.HashCost))
+	if err != nil {
+		return nil, &resolverutils.HTTPError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	return hash, nil
+}
+
 func createUserDatabase(username, displayName, password string, conn database.Connection) (*userOutput, *resolverutils.HTTPError) {
 	if user, _ := conn.GetUserByUsername(username); user != nil {
 		return nil, &resolverutils.HTTPError{Status: http.StatusConflict, Message: "username is taken"}
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
-	if err != nil {
-		return nil, &resolverutils.HTTPError{Status: http.StatusBadRequest, Message: err.Error()}
+	hash, httpError := hashPassword(password)
+	if httpError != nil {
+		return nil, httpError
 	}
 
 	newUser := &database.User{
@@ -82,7 +111,8 @@ func createUserDatabase(username, displayName, password string, conn database.Co
 	if newUser.DisplayName == "" {
 		newUser.DisplayName = username
 	}
-	newUser, err = conn.SetUser(newUser)
+	// Every user gets a personal chat for notes to self
+	newUser, err := conn.SetUserWithNoteChat(newUser)
 	if err != nil {
 		return nil, resolverutils.HandleDatabaseError(err)
 	}
@@ -98,6 +128,9 @@ func CreateUser(w *response.Writer, r *http.Request, conn database.Connection) {
 	if resolverutils.ProcessHTTPError(w, validateCreateUserInput(&input)) {
 		return
 	}
+	if resolverutils.ProcessHTTPError(w, validatePassword(input.Password)) {
+		return
+	}
 
 	newUser, httpError := createUserDatabase(input.Username, input.DisplayName.Value, input.Password, conn)
 	if resolverutils.ProcessHTTPError(w, httpError) {
@@ -120,3 +153,75 @@ func GetUserByName(w *response.Writer, r *http.Request, conn database.Connection
 	}
 	w.WriteJSON(http.StatusOK, stripUserFields(*user)[0])
 }
+
+type changePasswordInput struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// Asks a logged in user for their password before a sensitive change to their
+// account, a wrong password counts as a failed login attempt
+func checkCurrentPassword(r *http.Request, userID int64, password string, conn database.Connection) *resolverutils.HTTPError {
+	user, err := conn.GetUser(userID)
+	if err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	if user == nil {
+		return &resolverutils.HTTPError{Status: http.StatusNotFound, Message: "user not found"}
+	}
+
+	var httpError *resolverutils.HTTPError
+	if bcrypt.CompareHashAndPassword(user.Key, []byte(password)) != nil {
+		httpError = &resolverutils.HTTPError{
+			Status:  http.StatusForbidden,
+			Message: "current password is incorrect",
+		}
+	}
+	recordLoginAttempt(r, httpError)
+	return httpError
+}
+
+// Changes the password of a user, and logs them out of every session except
+// the one making the request
+func changePasswordDatabase(
+	r *http.Request,
+	userID int64,
+	input *changePasswordInput,
+	conn database.Connection,
+) *resolverutils.HTTPError {
+	if httpError := checkCurrentPassword(r, userID, input.CurrentPassword, conn); httpError != nil {
+		return httpError
+	}
+	if input.NewPassword == input.CurrentPassword {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "new password must be different from the current one",
+		}
+	}
+	if httpError := validatePassword(input.NewPassword); httpError != nil {
+		return httpError
+	}
+
+	hash, httpError := hashPassword(input.NewPassword)
+	if httpError != nil {
+		return httpError
+	}
+	if err := conn.UpdateUserKey(userID, hash); err != nil {
+		return resolverutils.HandleDatabaseError(err)
+	}
+	currentSessionID, _ := cookies.Get(r, cookies.SESSION)
+	return resolverutils.HandleDatabaseError(conn.DeleteOtherSessions(userID, currentSessionID))
+}
+
+func ChangePassword(w *response.Writer, r *http.Request, conn database.Connection) {
+	var input changePasswordInput
+	user, _, httpError := resolverutils.GetRequestBodyAndContext(r, &input)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+
+	if resolverutils.ProcessHTTPError(w, changePasswordDatabase(r, user.ID, &input, conn)) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,15 +1,21 @@
 package resolvers
 
 import (
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/raphael-p/beango/config"
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/test/assert"
 	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/cookies"
 	"github.com/raphael-p/beango/utils/response"
 	"github.com/raphael-p/beango/utils/validate"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestStripUserFields(t *testing.T) {
@@ -120,7 +126,26 @@ func TestValidateCreateUserInput(t *testing.T) {
 	})
 }
 
+func TestValidatePassword(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		assert.IsNil(t, validatePassword("secretpass 123"))
+		assert.IsNil(t, validatePassword(strings.Repeat("a", 72)))
+	})
+
+	t.Run("Blank", func(t *testing.T) {
+		err := validatePassword("  ")
+		resolverutils.AssertHTTPError(t, err, http.StatusBadRequest, "password may not be blank")
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		err := validatePassword(strings.Repeat("é", 37))
+		resolverutils.AssertHTTPError(t, err, http.StatusBadRequest, "password must be shorter than 73 bytes")
+	})
+}
+
 func TestCreateUserDatabase(t *testing.T) {
+	config.CreateConfig()
+
 	t.Run("Normal", func(t *testing.T) {
 		username := "xXbeanXx"
 		display := "Bean The Cat"
@@ -135,6 +160,13 @@ func TestCreateUserDatabase(t *testing.T) {
 		assert.IsNil(t, err)
 		assert.IsNotNil(t, user)
 		assert.HasLength(t, user.Key, 60) // typical bcrypt hash length
+		cost, _ := bcrypt.Cost(user.Key)
+		assert.Equals(t, cost, int(config.Values.Password.HashCost))
+
+		chats, err := conn.GetChatsByUserID(output.ID)
+		assert.IsNil(t, err)
+		assert.HasLength(t, chats, 1)
+		assert.Equals(t, chats[0].Type, database.NOTE)
 	})
 
 	t.Run("UsernameTaken", func(t *testing.T) {
@@ -168,6 +200,8 @@ func TestCreateUserDatabase(t *testing.T) {
 }
 
 func TestCreateUser(t *testing.T) {
+	config.CreateConfig()
+
 	t.Run("Normal", func(t *testing.T) {
 		body := `{"Username": "xXbeanXx", "displayName": "Bean The Cat", "password":"abc123"}`
 		w, r, conn := resolverutils.CommonSetup(body)
@@ -176,6 +210,15 @@ func TestCreateUser(t *testing.T) {
 		assert.Equals(t, w.Status, http.StatusCreated)
 		assert.IsValidJSON(t, string(w.Body), &userOutput{})
 	})
+
+	t.Run("BlankPassword", func(t *testing.T) {
+		body := `{"Username": "xXbeanXx", "password":" \t"}`
+		w, r, conn := resolverutils.CommonSetup(body)
+
+		CreateUser(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "password may not be blank")
+	})
 }
 
 func TestGetUserByName(t *testing.T) {
@@ -223,3 +266,65 @@ func TestGetUserByName(t *testing.T) {
 		assert.Equals(t, string(w.Body), "user not found")
 	})
 }
+
+func TestChangePassword(t *testing.T) {
+	config.CreateConfig()
+
+	// Does not use CommonSetup, as it would replace mocks.AdminSesh
+	setup := func(t *testing.T, body string) (*response.Writer, *http.Request, database.Connection) {
+		conn := mocks.MakeMockConnection()
+		w := response.NewWriter(httptest.NewRecorder())
+		r := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body))
+		r.AddCookie(&http.Cookie{Name: string(cookies.SESSION), Value: mocks.AdminSesh.ID})
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		return w, r, conn
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		body := fmt.Sprintf(`{"currentPassword": "%s", "newPassword": "beans4ever"}`, mocks.PASSWORD)
+		w, r, conn := setup(t, body)
+		otherSession := mocks.MakeSession(mocks.ADMIN_ID)
+		conn.SetSession(otherSession)
+
+		ChangePassword(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusNoContent)
+		_, httpError := checkCredentials(mocks.ADMIN_USERNAME, "beans4ever", conn)
+		assert.IsNil(t, httpError)
+		_, httpError = checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD, conn)
+		assert.IsNotNil(t, httpError)
+		session, _ := conn.GetSession(otherSession.ID)
+		assert.IsNil(t, session)
+		session, _ = conn.GetSession(mocks.AdminSesh.ID)
+		assert.IsNotNil(t, session)
+	})
+
+	t.Run("WrongCurrentPassword", func(t *testing.T) {
+		w, r, conn := setup(t, `{"currentPassword": "beans", "newPassword": "beans4ever"}`)
+
+		ChangePassword(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusForbidden)
+		assert.Equals(t, string(w.Body), "current password is incorrect")
+		_, httpError := checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD, conn)
+		assert.IsNil(t, httpError)
+	})
+
+	t.Run("SamePassword", func(t *testing.T) {
+		body := fmt.Sprintf(`{"currentPassword": "%[1]s", "newPassword": "%[1]s"}`, mocks.PASSWORD)
+		w, r, conn := setup(t, body)
+
+		ChangePassword(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "new password must be different from the current one")
+	})
+
+	t.Run("BlankPassword", func(t *testing.T) {
+		body := fmt.Sprintf(`{"currentPassword": "%s", "newPassword": "   "}`, mocks.PASSWORD)
+		w, r, conn := setup(t, body)
+
+		ChangePassword(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+		assert.Equals(t, string(w.Body), "password may not be blank")
+		_, httpError := checkCredentials(mocks.ADMIN_USERNAME, mocks.PASSWORD, conn)
+		assert.IsNil(t, httpError)
+	})
+}
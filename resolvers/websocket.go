@@ -0,0 +1,237 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/utils/logger"
+	"github.com/raphael-p/beango/utils/response"
+	"golang.org/x/net/websocket"
+)
+
+const WS_MAX_FRAME_BYTES = 64 * 1024
+const WS_WRITE_TIMEOUT = 10 * time.Second
+
+// Types of the frames sent by the client
+const (
+	WS_SEND_MESSAGE = "send-message"
+	WS_TYPING       = "typing"
+)
+
+// Types of the frames sent by the server
+const (
+	WS_EVENT = "event"
+	WS_ACK   = "ack"
+	WS_ERROR = "error"
+)
+
+type webSocketInput struct {
+	Type             string `json:"type"`
+	RequestID        string `json:"requestID"`
+	ChatID           int64  `json:"chatID"`
+	Content          string `json:"content"`
+	ReplyToMessageID int64  `json:"replyToMessageID"`
+	ThreadID         int64  `json:"threadID"`
+}
+
+// Events carry the same name, ID and data as their SSE counterpart. Acks and
+// errors echo the request ID of the frame they answer.
+type webSocketOutput struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestID,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Event     string `json:"event,omitempty"`
+	Data      any    `json:"data,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Opens a bidirectional connection that receives the events of the user's
+// stream and of every chat they belong to, and accepts messages to send
+func RegisterWebSocket(w *response.Writer, r *http.Request, conn database.Connection) {
+	user, _, httpError := resolverutils.GetRequestContext(r)
+	if resolverutils.ProcessHTTPError(w, httpError) {
+		return
+	}
+	if resolverutils.ProcessHTTPError(w, checkWebSocketRequest(r)) {
+		return
+	}
+	chats, err := conn.GetChatsByUserID(user.ID)
+	if resolverutils.ProcessHTTPError(w, resolverutils.HandleDatabaseError(err)) {
+		return
+	}
+
+	chatIDs := make([]int64, len(chats))
+	for i, chat := range chats {
+		chatIDs[i] = chat.ID
+	}
+	serveWebSocketClient(w, r, hub, user.ID, chatIDs, conn)
+}
+
+// Checked before the handshake, which takes over the connection. Browsers
+// always send an Origin, so a page on another site cannot connect with the
+// user's session cookie. Other clients do not need to send one.
+func checkWebSocketRequest(r *http.Request) *resolverutils.HTTPError {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return &resolverutils.HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "missing websocket upgrade headers",
+		}
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		originURL, err := url.Parse(origin)
+		if err != nil || originURL.Host != r.Host {
+			return &resolverutils.HTTPError{
+				Status:  http.StatusForbidden,
+				Message: "websocket connections from another origin are not allowed",
+			}
+		}
+	}
+	return nil
+}
+
+// Registers a client with the hub and upgrades the connection, then writes
+// the events it receives until either side closes the connection or the client
+// is evicted. Registering first means no event is missed once the handshake
+// is done. Frames sent by the client are handled on a separate goroutine.
+func serveWebSocketClient(w *response.Writer, r *http.Request, h *sseHub, userID int64, chatIDs []int64, conn database.Connection) {
+	client := &sseClient{
+		id:     uuid.NewString(),
+		key:    streamKey{USER_STREAM, userID},
+		events: make(chan sseEvent, config.Values.SSE.BufferSize),
+	}
+	h.register <- client
+	for _, chatID := range chatIDs {
+		h.addStream(client, streamKey{CHAT_STREAM, chatID})
+	}
+	defer func() { h.unregister <- client }()
+
+	server := websocket.Server{Handler: func(wsConn *websocket.Conn) {
+		w.Status = http.StatusSwitchingProtocols
+		wsConn.MaxPayloadBytes = WS_MAX_FRAME_BYTES
+		streamWebSocketEvents(wsConn, h, client, userID, conn)
+	}}
+	server.ServeHTTP(w, r)
+}
+
+func streamWebSocketEvents(wsConn *websocket.Conn, h *sseHub, client *sseClient, userID int64, conn database.Connection) {
+	heartbeat := time.NewTicker(time.Duration(config.Values.SSE.SecondsBetweenHeartbeats) * time.Second)
+	logger.Info(fmt.Sprintf("[WebSocket connection %s] opened", client.id))
+	defer func() {
+		heartbeat.Stop()
+		wsConn.Close()
+		logger.Info(fmt.Sprintf("[WebSocket connection %s] closed", client.id))
+	}()
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for {
+			var payload []byte
+			if err := websocket.Message.Receive(wsConn, &payload); err != nil {
+				return
+			}
+			handleWebSocketFrame(wsConn, userID, payload, conn)
+		}
+	}()
+
+	for {
+		select {
+		case <-done: // client closed the connection
+			return
+		case event, ok := <-client.events:
+			if !ok { // evicted by the hub
+				logger.Warning(fmt.Sprintf("[WebSocket connection %s] closing, buffer is full", client.id))
+				return
+			}
+			updateWebSocketStreams(h, client, userID, event)
+			writeWebSocketJSON(wsConn, webSocketEventOutput(event))
+			logger.Info(fmt.Sprintf("[WebSocket connection %s] sent '%s' event", client.id, event.event))
+		case <-heartbeat.C:
+			writeWebSocketFrame(wsConn, pingCodec, nil)
+		}
+	}
+}
+
+// Follows the user's chats, so that the client stops receiving the events of a
+// chat once the user has left it
+func updateWebSocketStreams(h *sseHub, client *sseClient, userID int64, event sseEvent) {
+	switch event.event {
+	case NEW_CHAT_EVENT:
+		var data chatEventData
+		if json.Unmarshal([]byte(event.data), &data) == nil {
+			h.addStream(client, streamKey{CHAT_STREAM, data.ChatID})
+		}
+	case LEAVE_CHAT_EVENT:
+		var data chatMemberEventData
+		if json.Unmarshal([]byte(event.data), &data) == nil && data.UserID == userID {
+			h.removeStream(client, streamKey{CHAT_STREAM, data.ChatID})
+		}
+	}
+}
+
+// Sends a ping frame, the library answers the client's pings on its own
+var pingCodec = websocket.Codec{Marshal: func(any) ([]byte, byte, error) {
+	return nil, websocket.PingFrame, nil
+}}
+
+// Frames are written by the event loop and by the goroutine reading the
+// client's frames, the codec takes care of writing one at a time
+func writeWebSocketFrame(wsConn *websocket.Conn, codec websocket.Codec, value any) error {
+	wsConn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+	return codec.Send(wsConn, value)
+}
+
+func writeWebSocketJSON(wsConn *websocket.Conn, value any) error {
+	return writeWebSocketFrame(wsConn, websocket.JSON, value)
+}
+
+func webSocketEventOutput(event sseEvent) webSocketOutput {
+	output := webSocketOutput{Type: WS_EVENT, ID: event.id, Event: event.event}
+	if json.Valid([]byte(event.data)) {
+		output.Data = json.RawMessage(event.data)
+	} else if event.data != "" {
+		output.Data = event.data
+	}
+	return output
+}
+
+func webSocketErrorOutput(requestID, message string) webSocketOutput {
+	return webSocketOutput{Type: WS_ERROR, RequestID: requestID, Error: message}
+}
+
+func handleWebSocketFrame(wsConn *websocket.Conn, userID int64, payload []byte, conn database.Connection) {
+	var input webSocketInput
+	if err := json.Unmarshal(payload, &input); err != nil {
+		writeWebSocketJSON(wsConn, webSocketErrorOutput("", "frame is not valid JSON"))
+		return
+	}
+
+	switch input.Type {
+	case WS_SEND_MESSAGE:
+		if strings.TrimSpace(input.Content) == "" {
+			writeWebSocketJSON(wsConn, webSocketErrorOutput(input.RequestID, "cannot send an empty message"))
+			return
+		}
+		newMessage, httpError := sendMessageDatabase(userID, input.ChatID, input.Content, input.ReplyToMessageID, input.ThreadID, conn)
+		if httpError != nil {
+			writeWebSocketJSON(wsConn, webSocketErrorOutput(input.RequestID, httpError.Message))
+			return
+		}
+		sendNewMessageEvents(newMessage, conn)
+		writeWebSocketJSON(wsConn, webSocketOutput{Type: WS_ACK, RequestID: input.RequestID, Data: newMessage})
+	case WS_TYPING:
+		if httpError := sendTypingDatabase(userID, input.ChatID, conn); httpError != nil {
+			writeWebSocketJSON(wsConn, webSocketErrorOutput(input.RequestID, httpError.Message))
+		}
+	default:
+		writeWebSocketJSON(wsConn, webSocketErrorOutput(input.RequestID, fmt.Sprintf("unknown frame type '%s'", input.Type)))
+	}
+}
@@ -0,0 +1,205 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/config"
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/test/assert"
+	"github.com/raphael-p/beango/test/mocks"
+	"github.com/raphael-p/beango/utils/response"
+	"golang.org/x/net/websocket"
+)
+
+// Serves RegisterWebSocket as the admin user and connects to it
+func dialTestWebSocket(t *testing.T, conn database.Connection) *websocket.Conn {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+		RegisterWebSocket(response.NewWriter(w), r, conn)
+	}))
+	t.Cleanup(server.Close)
+
+	wsConn, err := websocket.Dial("ws://"+strings.TrimPrefix(server.URL, "http://"), "", server.URL)
+	assert.IsNil(t, err)
+	t.Cleanup(func() { wsConn.Close() })
+	return wsConn
+}
+
+func readTestFrame(t *testing.T, wsConn *websocket.Conn) map[string]any {
+	frames := make(chan []byte, 1)
+	go func() {
+		var payload []byte
+		websocket.Message.Receive(wsConn, &payload)
+		frames <- payload
+	}()
+
+	select {
+	case payload := <-frames:
+		var frame map[string]any
+		assert.IsNil(t, json.Unmarshal(payload, &frame))
+		return frame
+	case <-time.After(1 * time.Second):
+		t.Error("timed out waiting for frame")
+		return nil
+	}
+}
+
+func TestRegisterWebSocket(t *testing.T) {
+	config.CreateConfig()
+
+	t.Run("Typing", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		wsConn := dialTestWebSocket(t, conn)
+		t.Cleanup(func() { typing.stop(chat.ID, mocks.ADMIN_ID) })
+
+		websocket.JSON.Send(wsConn, webSocketInput{Type: WS_TYPING, ChatID: chat.ID})
+		frame := readTestFrame(t, wsConn)
+		assert.Equals(t, frame["type"], WS_EVENT)
+		assert.Equals(t, frame["event"], TYPING_EVENT)
+		assert.DeepEquals(t, frame["data"], map[string]any{
+			"chatID":   float64(chat.ID),
+			"userID":   float64(mocks.ADMIN_ID),
+			"isTyping": true,
+		})
+	})
+
+	t.Run("SendMessage", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		wsConn := dialTestWebSocket(t, conn)
+
+		websocket.JSON.Send(wsConn, webSocketInput{
+			Type:      WS_SEND_MESSAGE,
+			RequestID: "abc",
+			ChatID:    chat.ID,
+			Content:   " Hello World! ",
+		})
+		frames := map[string]map[string]any{}
+		for i := 0; i < 3; i++ { // the ack and the two events can arrive in any order
+			frame := readTestFrame(t, wsConn)
+			if frame["type"] == WS_EVENT {
+				frames[fmt.Sprint(frame["event"])] = frame
+			} else {
+				frames[fmt.Sprint(frame["type"])] = frame
+			}
+		}
+
+		ack := frames[WS_ACK]
+		assert.Equals(t, ack["requestID"], "abc")
+		message := ack["data"].(map[string]any)
+		assert.Equals(t, message["content"], "Hello World!")
+		assert.DeepEquals(t, frames[NEW_MESSAGE_EVENT]["data"], map[string]any{"chatID": float64(chat.ID)})
+		event := frames[NEW_MESSAGES_EVENT]
+		assert.Equals(t, event["id"], any(fmt.Sprint(message["id"])))
+	})
+
+	t.Run("ChatNotFound", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		wsConn := dialTestWebSocket(t, conn)
+
+		websocket.JSON.Send(wsConn, webSocketInput{
+			Type:      WS_SEND_MESSAGE,
+			RequestID: "abc",
+			ChatID:    99,
+			Content:   "Hello World!",
+		})
+		frame := readTestFrame(t, wsConn)
+		assert.DeepEquals(t, frame, map[string]any{
+			"type":      WS_ERROR,
+			"requestID": "abc",
+			"error":     "chat not found",
+		})
+	})
+
+	t.Run("UnknownFrame", func(t *testing.T) {
+		wsConn := dialTestWebSocket(t, mocks.MakeMockConnection())
+
+		websocket.Message.Send(wsConn, `{"type":"raisin"}`)
+		frame := readTestFrame(t, wsConn)
+		assert.Equals(t, frame["error"], "unknown frame type 'raisin'")
+
+		websocket.Message.Send(wsConn, "raisin")
+		frame = readTestFrame(t, wsConn)
+		assert.Equals(t, frame["error"], "frame is not valid JSON")
+	})
+
+	t.Run("NotAWebSocket", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r.Method = http.MethodGet
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		RegisterWebSocket(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusBadRequest)
+	})
+
+	t.Run("OtherOrigin", func(t *testing.T) {
+		w, r, conn := resolverutils.CommonSetup("")
+		r.Method = http.MethodGet
+		r.Host = "beango.example"
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Origin", "https://raisin.example")
+		r = resolverutils.SetContext(t, r, mocks.Admin, nil)
+
+		RegisterWebSocket(w, r, conn)
+		assert.Equals(t, w.Status, http.StatusForbidden)
+		assert.Equals(t, string(w.Body), "websocket connections from another origin are not allowed")
+	})
+
+	t.Run("SubscribesToNewChat", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		wsConn := dialTestWebSocket(t, conn)
+
+		chat, _ := conn.SetChat(mocks.MakePrivateChat(), user.ID, mocks.ADMIN_ID)
+		SendChatMembersEvent(chat.ID, NEW_CHAT_EVENT, conn)
+		frame := readTestFrame(t, wsConn)
+		assert.Equals(t, frame["event"], NEW_CHAT_EVENT)
+
+		SendChatEvent(chat.ID, "test-event", "Hello World!")
+		frame = readTestFrame(t, wsConn)
+		assert.Equals(t, frame["event"], "test-event")
+		assert.Equals(t, frame["data"], "Hello World!")
+	})
+
+	t.Run("UnsubscribesFromLeftChat", func(t *testing.T) {
+		conn := mocks.MakeMockConnection()
+		user, _ := conn.SetUser(mocks.MakeUser())
+		chat, _ := conn.SetChat(mocks.MakeGroupChat(), user.ID, mocks.ADMIN_ID)
+		wsConn := dialTestWebSocket(t, conn)
+
+		removeChatUserDatabase(user.ID, chat.ID, mocks.ADMIN_ID, conn)
+		frame := readTestFrame(t, wsConn)
+		assert.Equals[any](t, frame["event"], leaveChatEvent(mocks.ADMIN_ID))
+		frame = readTestFrame(t, wsConn)
+		assert.Equals(t, frame["event"], LEAVE_CHAT_EVENT)
+
+		SendChatEvent(chat.ID, "chat-event", "")
+		SendUserEvent(mocks.ADMIN_ID, "user-event", "")
+		frame = readTestFrame(t, wsConn)
+		assert.Equals(t, frame["event"], "user-event")
+	})
+}
+
+func TestWebSocketEventOutput(t *testing.T) {
+	t.Run("JSONData", func(t *testing.T) {
+		output := webSocketEventOutput(sseEvent{"1", "an-event", `{"chatID":1}`})
+		payload, _ := json.Marshal(output)
+		assert.Equals(t, string(payload), `{"type":"event","id":"1","event":"an-event","data":{"chatID":1}}`)
+	})
+
+	t.Run("NoData", func(t *testing.T) {
+		output := webSocketEventOutput(sseEvent{event: "an-event"})
+		payload, _ := json.Marshal(output)
+		assert.Equals(t, string(payload), `{"type":"event","event":"an-event"}`)
+	})
+}
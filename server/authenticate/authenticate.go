@@ -2,7 +2,9 @@ package authenticate
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
@@ -12,10 +14,41 @@ import (
 	"github.com/raphael-p/beango/utils/response"
 )
 
+var errSessionCheck = errors.New("failed to check session")
+
+// Authenticates the request with an API token if it has one, or with the session cookie otherwise
 func Auth(w *response.Writer, r *http.Request, conn database.Connection) (*http.Request, *resolverutils.HTTPError) {
-	userID, err := getUserIDFromCookie(w, r, conn)
-	if err != nil {
-		return r, &resolverutils.HTTPError{Status: http.StatusUnauthorized}
+	return authenticate(w, r, conn, true)
+}
+
+// Only accepts the session cookie, for requests that API tokens must not be able to make
+func SessionAuth(w *response.Writer, r *http.Request, conn database.Connection) (*http.Request, *resolverutils.HTTPError) {
+	return authenticate(w, r, conn, false)
+}
+
+func authenticate(w *response.Writer, r *http.Request, conn database.Connection, allowTokens bool) (*http.Request, *resolverutils.HTTPError) {
+	var userID int64
+	if token, ok := getBearerToken(r); ok {
+		if !allowTokens {
+			return r, &resolverutils.HTTPError{
+				Status:  http.StatusForbidden,
+				Message: "API tokens cannot be used for this request",
+			}
+		}
+		var httpError *resolverutils.HTTPError
+		userID, httpError = getUserIDFromToken(r, token, conn)
+		if httpError != nil {
+			return r, httpError
+		}
+	} else {
+		var err error
+		userID, err = getUserIDFromCookie(w, r, conn)
+		if errors.Is(err, errSessionCheck) {
+			return r, resolverutils.HandleDatabaseError(err)
+		}
+		if err != nil {
+			return r, &resolverutils.HTTPError{Status: http.StatusUnauthorized}
+		}
 	}
 
 	user, err := conn.GetUser(userID)
@@ -50,8 +83,11 @@ func getUserIDFromCookie(w *response.Writer, req *http.Request, conn database.Co
 		return 0, err
 	}
 
-	session, ok := conn.CheckSession(sessionID)
-	if !ok {
+	session, err := conn.CheckSession(sessionID)
+	if err != nil {
+		return 0, errors.Join(errSessionCheck, err)
+	}
+	if session == nil {
 		err := cookies.Invalidate(w, cookieName)
 		if err != nil {
 			logger.Error(err.Error())
@@ -60,3 +96,41 @@ func getUserIDFromCookie(w *response.Writer, req *http.Request, conn database.Co
 	}
 	return session.UserID, nil
 }
+
+func getBearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// Reading requests only need the read scope. WebSocket connections can send
+// messages, so they need the write scope like any other request.
+func requiredScope(r *http.Request) database.TokenScope {
+	isWebSocket := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !isWebSocket {
+		return database.READ_SCOPE
+	}
+	return database.WRITE_SCOPE
+}
+
+func getUserIDFromToken(r *http.Request, token string, conn database.Connection) (int64, *resolverutils.HTTPError) {
+	apiToken, err := conn.CheckAPIToken(HashAPIToken(token))
+	if err != nil {
+		return 0, resolverutils.HandleDatabaseError(err)
+	}
+	if apiToken == nil {
+		return 0, &resolverutils.HTTPError{
+			Status:  http.StatusUnauthorized,
+			Message: "API token is invalid or expired",
+		}
+	}
+	if scope := requiredScope(r); !apiToken.Scopes.Has(scope) {
+		return 0, &resolverutils.HTTPError{
+			Status:  http.StatusForbidden,
+			Message: fmt.Sprintf("API token does not have the '%s' scope", scope),
+		}
+	}
+	return apiToken.UserID, nil
+}
@@ -115,4 +115,131 @@ func TestGetUserIDFromCookie(t *testing.T) {
 		)
 		assert.Equals(t, resCookie, xResCookie)
 	})
+	t.Run("ExpiredSession", func(t *testing.T) {
+		sesh := mocks.MakeSession(mocks.Admin.ID)
+		sesh.ExpiryDate = time.Now().UTC().Add(-time.Minute)
+		w, req, conn := setup(sessionCookie, sesh.ID)
+		conn.SetSession(sesh)
+
+		userID, err := getUserIDFromCookie(w, req, conn)
+		assert.ErrorHasMessage(t, err, "cookie or session is invalid")
+		assert.Equals(t, userID, 0)
+	})
+
+	t.Run("MarksSessionSeen", func(t *testing.T) {
+		sesh := mocks.MakeSession(mocks.Admin.ID)
+		sesh.LastSeenAt = time.Now().UTC().Add(-2 * database.LAST_SEEN_PRECISION)
+		w, req, conn := setup(sessionCookie, sesh.ID)
+		conn.SetSession(sesh)
+
+		_, err := getUserIDFromCookie(w, req, conn)
+		assert.IsNil(t, err)
+		seenSesh, _ := conn.GetSession(sesh.ID)
+		assert.Equals(t, seenSesh.LastSeenAt.After(sesh.LastSeenAt), true)
+	})
+
+	t.Run("RecentlySeenSession", func(t *testing.T) {
+		sesh := mocks.MakeSession(mocks.Admin.ID)
+		sesh.LastSeenAt = time.Now().UTC().Add(-database.LAST_SEEN_PRECISION / 2)
+		w, req, conn := setup(sessionCookie, sesh.ID)
+		conn.SetSession(sesh)
+
+		_, err := getUserIDFromCookie(w, req, conn)
+		assert.IsNil(t, err)
+		seenSesh, _ := conn.GetSession(sesh.ID)
+		assert.Equals(t, seenSesh.LastSeenAt, sesh.LastSeenAt)
+	})
+}
+
+func TestAuthWithAPIToken(t *testing.T) {
+	setupToken := func(t *testing.T, method string, scopes ...database.TokenScope) (*response.Writer, *http.Request, database.Connection, string) {
+		w, req, conn := setup("", "")
+		req.Method = method
+		token, prefix, hash, err := NewAPIToken()
+		assert.IsNil(t, err)
+		conn.SetAPIToken(&database.APIToken{
+			UserID: mocks.ADMIN_ID,
+			Name:   "beans bot",
+			Hash:   hash,
+			Prefix: prefix,
+			Scopes: scopes,
+		})
+		req.Header.Set("Authorization", "Bearer "+token)
+		return w, req, conn, token
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		w, req, conn, _ := setupToken(t, http.MethodGet, database.READ_SCOPE)
+
+		req, httpError := Auth(w, req, conn)
+		assert.IsNil(t, httpError)
+		user, err := context.GetUser(req)
+		assert.IsNil(t, err)
+		assert.DeepEquals(t, user, mocks.Admin)
+		tokens, _ := conn.GetAPITokensByUserID(mocks.ADMIN_ID)
+		assert.IsNotNil(t, tokens[0].LastUsedAt)
+	})
+
+	t.Run("MissingScope", func(t *testing.T) {
+		w, req, conn, _ := setupToken(t, http.MethodPost, database.READ_SCOPE)
+
+		_, httpError := Auth(w, req, conn)
+		xMessage := "API token does not have the 'write' scope"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, xMessage)
+	})
+
+	t.Run("WebSocketNeedsWrite", func(t *testing.T) {
+		w, req, conn, _ := setupToken(t, http.MethodGet, database.READ_SCOPE)
+		req.Header.Set("Upgrade", "websocket")
+
+		_, httpError := Auth(w, req, conn)
+		xMessage := "API token does not have the 'write' scope"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, xMessage)
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		w, req, conn, token := setupToken(t, http.MethodGet, database.READ_SCOPE)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: mocks.AdminSesh.ID})
+		req.Header.Set("Authorization", "Bearer "+token+"x")
+
+		_, httpError := Auth(w, req, conn) // the cookie is not used as a fallback
+		xMessage := "API token is invalid or expired"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, xMessage)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		w, req, conn := setup("", "")
+		token, prefix, hash, _ := NewAPIToken()
+		yesterday := time.Now().UTC().AddDate(0, 0, -1)
+		conn.SetAPIToken(&database.APIToken{
+			UserID:     mocks.ADMIN_ID,
+			Hash:       hash,
+			Prefix:     prefix,
+			Scopes:     database.TOKEN_SCOPES,
+			ExpiryDate: &yesterday,
+		})
+		req.Header.Set("Authorization", "bearer "+token)
+
+		_, httpError := Auth(w, req, conn)
+		xMessage := "API token is invalid or expired"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusUnauthorized, xMessage)
+	})
+
+	t.Run("SessionOnly", func(t *testing.T) {
+		w, req, conn, _ := setupToken(t, http.MethodGet, database.TOKEN_SCOPES...)
+
+		_, httpError := SessionAuth(w, req, conn)
+		xMessage := "API tokens cannot be used for this request"
+		resolverutils.AssertHTTPError(t, httpError, http.StatusForbidden, xMessage)
+	})
+}
+
+func TestNewAPIToken(t *testing.T) {
+	token, prefix, hash, err := NewAPIToken()
+	assert.IsNil(t, err)
+	assert.Contains(t, token, API_TOKEN_PREFIX, prefix)
+	assert.Equals(t, hash, HashAPIToken(token))
+	assert.Equals(t, len(hash), 64)
+	otherToken, _, _, _ := NewAPIToken()
+	assert.NotContains(t, otherToken, token)
 }
@@ -0,0 +1,53 @@
+package authenticate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestSignedToken(t *testing.T) {
+	now := time.Now()
+	expiry := now.Add(time.Hour)
+
+	t.Run("Normal", func(t *testing.T) {
+		token := NewSignedToken("password-reset", expiry, "42", "bean@example.com")
+		fields, err := ParseSignedToken("password-reset", token, now)
+		assert.IsNil(t, err)
+		assert.DeepEquals(t, fields, []string{"42", "bean@example.com"})
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		token := NewSignedToken("password-reset", expiry, "42")
+		_, err := ParseSignedToken("password-reset", token, expiry)
+		assert.Equals(t, err, ErrInvalidSignedToken)
+	})
+
+	t.Run("WrongPurpose", func(t *testing.T) {
+		token := NewSignedToken("password-reset", expiry, "42")
+		_, err := ParseSignedToken("verify-email", token, now)
+		assert.Equals(t, err, ErrInvalidSignedToken)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		token := NewSignedToken("password-reset", expiry, "42")
+		other := NewSignedToken("password-reset", expiry, "43")
+		payload, _, _ := strings.Cut(other, ".")
+		_, signature, _ := strings.Cut(token, ".")
+		_, err := ParseSignedToken("password-reset", payload+"."+signature, now)
+		assert.Equals(t, err, ErrInvalidSignedToken)
+
+		_, err = ParseSignedToken("password-reset", "not-a-token", now)
+		assert.Equals(t, err, ErrInvalidSignedToken)
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		defer UseSigningKey(signingKey)
+		token := NewSignedToken("password-reset", expiry, "42")
+		UseSigningKey([]byte("another key"))
+		_, err := ParseSignedToken("password-reset", token, now)
+		assert.Equals(t, err, ErrInvalidSignedToken)
+	})
+}
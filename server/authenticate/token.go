@@ -0,0 +1,34 @@
+package authenticate
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	// Makes tokens easy to recognise, for instance by secret scanners
+	API_TOKEN_PREFIX string = "bgo_"
+	// How much of a token is kept in the clear, to tell tokens apart
+	API_TOKEN_VISIBLE_LENGTH int = len(API_TOKEN_PREFIX) + 6
+	API_TOKEN_RANDOM_BYTES   int = 32
+)
+
+// Generates a new API token. Only its hash and visible prefix may be stored,
+// the token itself is shown to the user once.
+func NewAPIToken() (token, prefix, hash string, err error) {
+	randomBytes := make([]byte, API_TOKEN_RANDOM_BYTES)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", "", err
+	}
+	token = API_TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(randomBytes)
+	return token, token[:API_TOKEN_VISIBLE_LENGTH], HashAPIToken(token), nil
+}
+
+// Tokens are long and random, so a fast hash is enough to store them safely,
+// and it lets them be looked up by their hash
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -1,27 +1,44 @@
 package routing
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/ratelimit"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
 	"github.com/raphael-p/beango/server/authenticate"
+	"github.com/raphael-p/beango/utils/context"
+	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/response"
 )
 
 type Middleware func(w *response.Writer, r *http.Request, conn database.Connection) (*http.Request, bool)
 
-// Adds user to request context.
-// On failure, returns a 401.
+// Adds user to request context, from an API token or the session cookie.
+// On failure, returns a 401, or a 403 if the API token lacks the scope.
 var Auth Middleware = func(w *response.Writer, newRequest *http.Request, conn database.Connection) (*http.Request, bool) {
 	newRequest, httpError := authenticate.Auth(w, newRequest, conn)
 	return newRequest, !resolverutils.ProcessHTTPError(w, httpError)
 }
 
-// Adds user to request context.
+// Adds user to request context, without accepting API tokens.
+// On failure, returns a 401, or a 403 if an API token was used.
+var AuthSession Middleware = func(w *response.Writer, newRequest *http.Request, conn database.Connection) (*http.Request, bool) {
+	newRequest, httpError := authenticate.SessionAuth(w, newRequest, conn)
+	return newRequest, !resolverutils.ProcessHTTPError(w, httpError)
+}
+
+// Adds user to request context, without accepting API tokens.
 // On failure, redirects to /login.
 var AuthRedirect Middleware = func(w *response.Writer, r *http.Request, conn database.Connection) (*http.Request, bool) {
-	newRequest, httpError := authenticate.Auth(w, r, conn)
+	newRequest, httpError := authenticate.SessionAuth(w, r, conn)
 	if httpError == nil {
 		return newRequest, true
 	}
@@ -38,9 +55,94 @@ var AuthRedirect Middleware = func(w *response.Writer, r *http.Request, conn dat
 	return newRequest, false
 }
 
-// Adds user to request context.
+// Adds user to request context, without accepting API tokens.
 // On failure, it proceeds anyway.
 var AuthWeak Middleware = func(w *response.Writer, newRequest *http.Request, conn database.Connection) (*http.Request, bool) {
-	newRequest, _ = authenticate.Auth(w, newRequest, conn)
+	newRequest, _ = authenticate.SessionAuth(w, newRequest, conn)
 	return newRequest, true
 }
+
+// Only lets through requests made from the server's own machine, for operator
+// endpoints. Forwarding headers are ignored, as clients can set them.
+var LocalOnly Middleware = func(w *response.Writer, r *http.Request, conn database.Connection) (*http.Request, bool) {
+	ip := net.ParseIP(resolverutils.GetRequestIPAddress(r))
+	if ip == nil || !ip.IsLoopback() {
+		w.WriteString(http.StatusForbidden, "only available from the server's own machine")
+		return r, false
+	}
+	return r, true
+}
+
+// Picks the key that a request's attempts are counted under, if it has one
+type KeyFunc func(r *http.Request) (ratelimit.Key, bool)
+
+var ByIPAddress KeyFunc = func(r *http.Request) (ratelimit.Key, bool) {
+	return ratelimit.Key{Value: "ip:" + resolverutils.GetRequestIPAddress(r)}, true
+}
+
+// Reads the username from a JSON body, which is left for the handler to read again
+var ByUsername KeyFunc = func(r *http.Request) (ratelimit.Key, bool) {
+	if r.Body == nil {
+		return ratelimit.Key{}, false
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ratelimit.Key{}, false
+	}
+
+	var input struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil || input.Username == "" {
+		return ratelimit.Key{}, false
+	}
+	return ratelimit.Key{Value: "username:" + input.Username, ClearOnSuccess: true}, true
+}
+
+// Counts attempts under the same value as the key function, in a separate
+// namespace, so that one kind of request cannot lock out another
+func WithPrefix(prefix string, keyFunc KeyFunc) KeyFunc {
+	return func(r *http.Request) (ratelimit.Key, bool) {
+		key, ok := keyFunc(r)
+		key.Value = prefix + key.Value
+		return key, ok
+	}
+}
+
+// Rejects requests while any of their keys is locked, with a 429 and a
+// Retry-After header. Otherwise, adds an attempt to the request context, for
+// the handler to report whether the credentials were correct.
+func RateLimit(limiter *ratelimit.Limiter, keyFuncs ...KeyFunc) Middleware {
+	return func(w *response.Writer, r *http.Request, conn database.Connection) (*http.Request, bool) {
+		keys := []ratelimit.Key{}
+		for _, keyFunc := range keyFuncs {
+			if key, ok := keyFunc(r); ok {
+				keys = append(keys, key)
+			}
+		}
+
+		wait, err := limiter.Check(keys...)
+		if err != nil {
+			logger.Error("failed to check rate limit: " + err.Error())
+			w.WriteString(http.StatusInternalServerError, "failed to check rate limit")
+			return r, false
+		}
+		if wait > 0 {
+			seconds := int64(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+			httpError := &resolverutils.HTTPError{
+				Status:  http.StatusTooManyRequests,
+				Message: fmt.Sprintf("too many failed attempts, try again in %d second(s)", seconds),
+			}
+			if r.Header.Get("HX-Request") == "true" {
+				resolverutils.DisplayHTTPErrorWithStatus(w, httpError)
+			} else {
+				resolverutils.ProcessHTTPError(w, httpError)
+			}
+			return r, false
+		}
+
+		return context.SetAttempt(r, limiter.NewAttempt(keys...)), true
+	}
+}
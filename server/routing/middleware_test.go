@@ -1,16 +1,35 @@
 package routing
 
 import (
+	"io"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/ratelimit"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
 	"github.com/raphael-p/beango/test/assert"
 	"github.com/raphael-p/beango/test/mocks"
 	"github.com/raphael-p/beango/utils/context"
 	"github.com/raphael-p/beango/utils/cookies"
 )
 
+// Gives the admin an API token with every scope, returns the token
+func addAdminAPIToken(t *testing.T, conn database.Connection) string {
+	token, prefix, hash, err := authenticate.NewAPIToken()
+	assert.IsNil(t, err)
+	conn.SetAPIToken(&database.APIToken{
+		UserID: mocks.ADMIN_ID,
+		Name:   "beans bot",
+		Hash:   hash,
+		Prefix: prefix,
+		Scopes: database.TOKEN_SCOPES,
+	})
+	return token
+}
+
 func TestAuth(t *testing.T) {
 	t.Run("AuthSucceeds", func(t *testing.T) {
 		w, req, conn := resolverutils.CommonSetup("")
@@ -33,6 +52,32 @@ func TestAuth(t *testing.T) {
 	})
 }
 
+func TestAuthSession(t *testing.T) {
+	t.Run("AuthSucceeds", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup("")
+		cookie := &http.Cookie{Name: string(cookies.SESSION), Value: mocks.AdminSesh.ID}
+		req.AddCookie(cookie)
+
+		newReq, proceed := AuthSession(w, req, conn)
+		assert.Equals(t, proceed, true)
+		user, err := context.GetUser(newReq)
+		assert.IsNil(t, err)
+		assert.DeepEquals(t, user, mocks.Admin)
+	})
+
+	t.Run("RejectsAPIToken", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup("")
+		cookie := &http.Cookie{Name: string(cookies.SESSION), Value: mocks.AdminSesh.ID}
+		req.AddCookie(cookie)
+		req.Header.Set("Authorization", "Bearer bgo_raisin")
+
+		_, proceed := AuthSession(w, req, conn)
+		assert.Equals(t, proceed, false)
+		assert.Equals(t, w.Status, http.StatusForbidden)
+		assert.Equals(t, string(w.Body), "API tokens cannot be used for this request")
+	})
+}
+
 func TestAuthRedirect(t *testing.T) {
 	t.Run("NoRedirectOnSuccess", func(t *testing.T) {
 		w, req, conn := resolverutils.CommonSetup("")
@@ -64,6 +109,16 @@ func TestAuthRedirect(t *testing.T) {
 		assert.Equals(t, w.Status, 200)
 		assert.Equals(t, w.Header().Get("HX-Redirect"), "/login")
 	})
+
+	t.Run("RedirectsAPIToken", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup("")
+		req.Header.Set("Authorization", "Bearer "+addAdminAPIToken(t, conn))
+
+		_, proceed := AuthRedirect(w, req, conn)
+		assert.Equals(t, proceed, false)
+		assert.Equals(t, w.Status, http.StatusSeeOther)
+		assert.Equals(t, w.Header().Get("Location"), "/login")
+	})
 }
 
 func TestAuthWeak(t *testing.T) {
@@ -87,4 +142,109 @@ func TestAuthWeak(t *testing.T) {
 		_, err := context.GetUser(newReq)
 		assert.ErrorHasMessage(t, err, "user not found in request context")
 	})
+
+	t.Run("IgnoresAPIToken", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup("")
+		req.Header.Set("Authorization", "Bearer "+addAdminAPIToken(t, conn))
+
+		newReq, proceed := AuthWeak(w, req, conn)
+		assert.Equals(t, proceed, true)
+		_, err := context.GetUser(newReq)
+		assert.ErrorHasMessage(t, err, "user not found in request context")
+	})
+}
+
+func TestLocalOnly(t *testing.T) {
+	t.Run("Loopback", func(t *testing.T) {
+		for _, address := range []string{"127.0.0.1:41000", "[::1]:41000"} {
+			w, req, conn := resolverutils.CommonSetup("")
+			req.RemoteAddr = address
+
+			_, proceed := LocalOnly(w, req, conn)
+			assert.Equals(t, proceed, true)
+			assert.Equals(t, w.Status, 0)
+		}
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		w, req, conn := resolverutils.CommonSetup("")
+		req.RemoteAddr = "198.51.100.7:41000"
+		req.Header.Set("X-Forwarded-For", "127.0.0.1")
+
+		_, proceed := LocalOnly(w, req, conn)
+		assert.Equals(t, proceed, false)
+		assert.Equals(t, w.Status, http.StatusForbidden)
+		assert.Equals(t, string(w.Body), "only available from the server's own machine")
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	policy := ratelimit.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, ResetAfter: time.Hour}
+	body := `{"username": "admin", "password": "wrong"}`
+
+	t.Run("Normal", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(ratelimit.NewLocalStore(), policy)
+		w, req, conn := resolverutils.CommonSetup(body)
+
+		newReq, proceed := RateLimit(limiter, ByIPAddress, ByUsername)(w, req, conn)
+		assert.Equals(t, proceed, true)
+		assert.Equals(t, w.Status, 0)
+		assert.IsNotNil(t, context.GetAttempt(newReq))
+		remainingBody, _ := io.ReadAll(newReq.Body)
+		assert.Equals(t, string(remainingBody), body)
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(ratelimit.NewLocalStore(), policy)
+		limiter.Fail(ratelimit.Key{Value: "username:admin"}, ratelimit.Key{Value: "username:admin"})
+		w, req, conn := resolverutils.CommonSetup(body)
+		req.RemoteAddr = "198.51.100.7:41000"
+
+		_, proceed := RateLimit(limiter, ByIPAddress, ByUsername)(w, req, conn)
+		assert.Equals(t, proceed, false)
+		assert.Equals(t, w.Status, http.StatusTooManyRequests)
+		assert.Equals(t, w.Header().Get("Retry-After"), "60")
+		assert.Equals(t, string(w.Body), "too many failed attempts, try again in 60 second(s)")
+	})
+
+	t.Run("LockedHTMX", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(ratelimit.NewLocalStore(), policy)
+		ip := ratelimit.Key{Value: "ip:192.0.2.1"}
+		limiter.Fail(ip, ip)
+		w, req, conn := resolverutils.CommonSetup(`{"username": "someone"}`)
+		req.Header.Set("HX-Request", "true")
+
+		_, proceed := RateLimit(limiter, ByIPAddress, ByUsername)(w, req, conn)
+		assert.Equals(t, proceed, false)
+		assert.Equals(t, w.Status, http.StatusTooManyRequests)
+		assert.Contains(t, string(w.Body), "<div id='errors'", "too many failed attempts")
+	})
+}
+
+func TestByUsername(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		_, req, _ := resolverutils.CommonSetup(`{"username": "admin"}`)
+		key, ok := ByUsername(req)
+		assert.Equals(t, ok, true)
+		assert.Equals(t, key, ratelimit.Key{Value: "username:admin", ClearOnSuccess: true})
+	})
+
+	t.Run("NoUsername", func(t *testing.T) {
+		_, req, _ := resolverutils.CommonSetup(`{"preAuthToken": "123", "code": "123456"}`)
+		_, ok := ByUsername(req)
+		assert.Equals(t, ok, false)
+		body, _ := io.ReadAll(req.Body)
+		assert.Equals(t, string(body), `{"preAuthToken": "123", "code": "123456"}`)
+	})
+}
+
+func TestWithPrefix(t *testing.T) {
+	_, req, _ := resolverutils.CommonSetup(`{"username": "admin"}`)
+	key, ok := WithPrefix("reset:", ByUsername)(req)
+	assert.Equals(t, ok, true)
+	assert.Equals(t, key, ratelimit.Key{Value: "reset:username:admin", ClearOnSuccess: true})
+
+	_, req, _ = resolverutils.CommonSetup("")
+	_, ok = WithPrefix("reset:", ByUsername)(req)
+	assert.Equals(t, ok, false)
 }
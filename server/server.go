@@ -5,11 +5,17 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/raphael-p/beango/blobs"
 	"github.com/raphael-p/beango/config"
 	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/events"
+	"github.com/raphael-p/beango/mailer"
+	"github.com/raphael-p/beango/ratelimit"
 	"github.com/raphael-p/beango/resolvers"
 	"github.com/raphael-p/beango/resolvers/resolverutils"
+	"github.com/raphael-p/beango/server/authenticate"
 	"github.com/raphael-p/beango/server/routing"
 	"github.com/raphael-p/beango/utils/logger"
 	"github.com/raphael-p/beango/utils/path"
@@ -34,6 +40,14 @@ func setup() (conn *database.MongoConnection, router *routing.Router, ok bool) {
 	}
 	logger.Trace("opened database connection")
 	database.Setup(conn)
+	sweepInterval := time.Duration(config.Values.Session.SecondsBetweenSweeps) * time.Second
+	conn.StartExpirySweeper(sweepInterval)
+	setupEventBus(conn)
+	setupBlobStore()
+	setupMailer()
+	setupSigningKey()
+	loginLimiter, resetLimiter := setupLimiters(conn)
+	loginLimiter.StartSweeper(sweepInterval) // the limiters share a store, so this sweeps both
 
 	router = routing.NewRouter()
 
@@ -45,41 +59,219 @@ func setup() (conn *database.MongoConnection, router *routing.Router, ok bool) {
 	// aliases for readability
 	chatID := resolverutils.CHAT_ID_KEY
 	username := resolverutils.USERNAME_KEY
+	userID := resolverutils.USER_ID_KEY
+	messageID := resolverutils.MESSAGE_ID_KEY
+	sessionID := resolverutils.SESSION_ID_KEY
+	attachmentID := resolverutils.ATTACHMENT_ID_KEY
+	tokenID := resolverutils.TOKEN_ID_KEY
+	rateLimitLogin := routing.RateLimit(loginLimiter, routing.ByIPAddress, routing.ByUsername)
+	// anyone can ask for a reset, so it must not count towards locking the login
+	rateLimitReset := routing.RateLimit(
+		resetLimiter,
+		routing.WithPrefix("reset:", routing.ByIPAddress),
+		routing.WithPrefix("reset:", routing.ByUsername),
+	)
 
 	// frontend endpoints
 	router.GET("/", func(w *response.Writer, r *http.Request, conn database.Connection) {
 		w.Redirect("/home", r)
 	}, routing.AuthRedirect)
 	router.GET("/login", resolvers.Login)
-	router.POST("/login/:action", resolvers.SubmitLogin)
+	router.GET("/login/reset", resolvers.ResetPasswordPage)
+	router.GET("/email/verify", resolvers.VerifyEmail)
+	router.POST("/login/forgot", resolvers.ForgotPasswordHTML, rateLimitReset)
+	router.POST("/login/reset", resolvers.ResetPasswordHTML, rateLimitReset)
+	router.POST("/login/:action", resolvers.SubmitLogin, rateLimitLogin)
 	router.GET("/logout", resolvers.Logout)
 	router.GET("/registerSSE/messages/:"+chatID, resolvers.RegisterChatSSE, routing.AuthWeak)
+	router.GET("/registerSSE/user", resolvers.RegisterUserSSE, routing.AuthWeak)
 	router.GET("/home", resolvers.Home, routing.AuthRedirect)
+	router.GET("/home/chats", resolvers.RefreshChatList, routing.AuthRedirect)
 	router.GET("/home/chat/:"+chatID, resolvers.OpenChat, routing.AuthRedirect)
 	router.GET("/home/chat/:"+chatID+"/scrollUp", resolvers.ScrollUp, routing.AuthRedirect)
 	router.GET("/home/chat/:"+chatID+"/refresh", resolvers.RefreshMessages, routing.AuthRedirect)
+	router.GET("/home/chat/:"+chatID+"/receipts", resolvers.GetReadReceiptsHTML, routing.AuthRedirect)
+	router.GET("/home/chat/:"+chatID+"/typing", resolvers.GetTypingHTML, routing.AuthRedirect)
+	router.POST("/home/chat/:"+chatID+"/typing", resolvers.SendTypingHTML, routing.AuthRedirect)
 	router.POST("/home/chat/:"+chatID+"/sendMessage", resolvers.SendMessageHTML, routing.AuthRedirect)
+	router.POST("/home/chat/:"+chatID+"/attachments", resolvers.SendAttachmentsHTML, routing.AuthRedirect)
+	router.GET("/home/chat/:"+chatID+"/message/:"+messageID, resolvers.GetMessageHTML, routing.AuthRedirect)
+	router.PATCH("/home/chat/:"+chatID+"/message/:"+messageID, resolvers.EditMessageHTML, routing.AuthRedirect)
+	router.DELETE("/home/chat/:"+chatID+"/message/:"+messageID, resolvers.DeleteMessageHTML, routing.AuthRedirect)
+	router.GET("/home/chat/:"+chatID+"/message/:"+messageID+"/edit", resolvers.OpenMessageEditor, routing.AuthRedirect)
+	router.GET("/home/chat/:"+chatID+"/message/:"+messageID+"/thread", resolvers.OpenThread, routing.AuthRedirect)
+	router.GET("/home/chat/:"+chatID+"/message/:"+messageID+"/reactions", resolvers.GetReactionsHTML, routing.AuthRedirect)
+	router.POST("/home/chat/:"+chatID+"/message/:"+messageID+"/reactions", resolvers.AddReactionHTML, routing.AuthRedirect)
+	router.DELETE("/home/chat/:"+chatID+"/message/:"+messageID+"/reactions", resolvers.RemoveReactionHTML, routing.AuthRedirect)
 	router.GET("/home/newChat", resolvers.OpenChatCreator, routing.AuthRedirect)
 	router.POST("/home/newChat/search", resolvers.UserSearch, routing.AuthRedirect)
 	router.POST("/home/newChat/create", resolvers.CreatePrivateChatHTML, routing.AuthRedirect)
+	router.GET("/home/search", resolvers.OpenMessageSearch, routing.AuthRedirect)
+	router.GET("/home/search/messages", resolvers.SearchMessagesHTML, routing.AuthRedirect)
 	router.GET("/home/rename", resolvers.OpenRenamer, routing.AuthRedirect)
 	router.POST("/home/rename", resolvers.RenameUser, routing.AuthRedirect)
+	router.GET("/home/password", resolvers.OpenPasswordChanger, routing.AuthRedirect)
+	router.POST("/home/password", resolvers.ChangePasswordHTML, routing.AuthRedirect, rateLimitLogin)
+	router.GET("/home/email", resolvers.OpenEmail, routing.AuthRedirect)
+	router.POST("/home/email", resolvers.SetEmailHTML, routing.AuthRedirect, rateLimitLogin)
+	router.DELETE("/home/email", resolvers.DeleteEmailHTML, routing.AuthRedirect, rateLimitLogin)
+	router.GET("/home/sessions", resolvers.OpenSessions, routing.AuthRedirect)
+	router.DELETE("/home/sessions", resolvers.DeleteOtherSessionsHTML, routing.AuthRedirect)
+	router.DELETE("/home/session/:"+sessionID, resolvers.DeleteSessionHTML, routing.AuthRedirect)
+	router.GET("/home/totp", resolvers.OpenTOTP, routing.AuthRedirect)
+	router.DELETE("/home/totp", resolvers.DisableTOTPHTML, routing.AuthRedirect)
+	router.POST("/home/totp/setup", resolvers.StartTOTPSetupHTML, routing.AuthRedirect)
+	router.POST("/home/totp/enable", resolvers.EnableTOTPHTML, routing.AuthRedirect)
 	router.GET("/resources/.*", func(w *response.Writer, r *http.Request, conn database.Connection) {
 		http.StripPrefix("/resources/", http.FileServer(http.Dir(path))).ServeHTTP(w, r)
 	})
 
 	// backend endpoints
-	router.POST("/session", resolvers.CreateSession)
+	router.POST("/session", resolvers.CreateSession, rateLimitLogin)
+	router.POST("/session/code", resolvers.VerifySessionCode, rateLimitLogin)
+	router.GET("/sessions", resolvers.GetSessions, routing.AuthSession)
+	router.DELETE("/sessions", resolvers.DeleteOtherSessions, routing.AuthSession)
+	router.DELETE("/session/:"+sessionID, resolvers.DeleteSession, routing.AuthSession)
+	router.GET("/tokens", resolvers.GetAPITokens, routing.AuthSession)
+	router.POST("/tokens", resolvers.CreateAPIToken, routing.AuthSession)
+	router.DELETE("/token/:"+tokenID, resolvers.DeleteAPIToken, routing.AuthSession)
+	router.GET("/totp", resolvers.GetTOTPStatus, routing.AuthSession)
+	router.POST("/totp", resolvers.StartTOTPSetup, routing.AuthSession)
+	router.DELETE("/totp", resolvers.DisableTOTP, routing.AuthSession)
+	router.POST("/totp/enable", resolvers.EnableTOTP, routing.AuthSession)
 	router.POST("/user", resolvers.CreateUser)
+	router.POST("/user/password", resolvers.ChangePassword, routing.AuthSession, rateLimitLogin)
+	router.POST("/user/email", resolvers.SetEmail, routing.AuthSession, rateLimitLogin)
+	router.DELETE("/user/email", resolvers.DeleteEmail, routing.AuthSession, rateLimitLogin)
+	router.POST("/password/forgot", resolvers.ForgotPassword, rateLimitReset)
+	router.POST("/password/reset", resolvers.ResetPassword, rateLimitReset)
 	router.GET("/user/:"+username, resolvers.GetUserByName, routing.Auth)
+	router.GET("/sse/metrics", resolvers.GetSSEMetrics, routing.LocalOnly)
+	router.GET("/ws", resolvers.RegisterWebSocket, routing.Auth)
+	router.GET("/search/messages", resolvers.SearchMessages, routing.Auth)
 	router.GET("/chats", resolvers.GetChats, routing.Auth)
 	router.POST("/chat", resolvers.CreatePrivateChat, routing.Auth)
+	router.POST("/chat/group", resolvers.CreateGroupChat, routing.Auth)
+	router.POST("/chat/:"+chatID+"/users", resolvers.AddChatUsers, routing.Auth)
+	router.DELETE("/chat/:"+chatID+"/user/:"+userID, resolvers.RemoveChatUser, routing.Auth)
+	router.POST("/chat/:"+chatID+"/leave", resolvers.LeaveChat, routing.Auth)
+	router.POST("/chat/:"+chatID+"/read", resolvers.MarkChatRead, routing.Auth)
+	router.POST("/chat/:"+chatID+"/typing", resolvers.SendTyping, routing.Auth)
 	router.GET("/chat/:"+chatID+"/messages", resolvers.GetChatMessages, routing.Auth)
 	router.POST("/chat/:"+chatID+"/message", resolvers.SendMessage, routing.Auth)
+	router.POST("/chat/:"+chatID+"/attachments", resolvers.SendAttachments, routing.Auth)
+	router.GET("/chat/:"+chatID+"/attachment/:"+attachmentID, resolvers.GetAttachment, routing.Auth)
+	router.PATCH("/chat/:"+chatID+"/message/:"+messageID, resolvers.EditMessage, routing.Auth)
+	router.DELETE("/chat/:"+chatID+"/message/:"+messageID, resolvers.DeleteMessage, routing.Auth)
+	router.GET("/chat/:"+chatID+"/message/:"+messageID+"/revisions", resolvers.GetMessageRevisions, routing.Auth)
+	router.GET("/chat/:"+chatID+"/message/:"+messageID+"/thread", resolvers.GetThread, routing.Auth)
+	router.POST("/chat/:"+chatID+"/message/:"+messageID+"/reactions", resolvers.AddReaction, routing.Auth)
+	router.DELETE("/chat/:"+chatID+"/message/:"+messageID+"/reactions", resolvers.RemoveReaction, routing.Auth)
 
 	return conn, router, ok
 }
 
+// The local bus is used by default, which only reaches this instance
+func setupEventBus(conn *database.MongoConnection) {
+	switch config.Values.Events.Bus {
+	case "local":
+	case "postgres":
+		connectionString, err := database.ConnectionString()
+		if err != nil {
+			panic("failed to start event bus: " + err.Error())
+		}
+		bus, err := events.NewPostgresBus(conn.DB, connectionString)
+		if err != nil {
+			panic("failed to start event bus: " + err.Error())
+		}
+		resolvers.UseEventBus(bus)
+		logger.Trace("listening on postgres event bus")
+	default:
+		panic("unknown event bus: " + config.Values.Events.Bus)
+	}
+}
+
+func setupBlobStore() {
+	attachmentsConfig := config.Values.Attachments
+	var store blobs.Store
+	var err error
+	switch attachmentsConfig.Store {
+	case "local":
+		store, err = blobs.NewLocalStore(attachmentsConfig.Directory)
+	case "s3":
+		store, err = blobs.NewS3Store(
+			attachmentsConfig.S3.Endpoint.Value,
+			attachmentsConfig.S3.Region.Value,
+			attachmentsConfig.S3.Bucket.Value,
+			os.Getenv(config.Envars.S3AccessKeyID),
+			os.Getenv(config.Envars.S3SecretAccessKey),
+		)
+	default:
+		panic("unknown attachments store: " + attachmentsConfig.Store)
+	}
+	if err != nil {
+		panic("failed to set up attachments store: " + err.Error())
+	}
+	resolvers.UseBlobStore(store)
+}
+
+func setupMailer() {
+	mailConfig := config.Values.Mail
+	var sender mailer.Mailer
+	var err error
+	switch mailConfig.Mailer {
+	case "log":
+		sender = mailer.NewLogMailer()
+	case "file":
+		sender, err = mailer.NewFileMailer(mailConfig.File.Value, mailConfig.From)
+	case "smtp":
+		sender, err = mailer.NewSMTPMailer(
+			mailConfig.SMTP.Host.Value,
+			mailConfig.SMTP.Port.Value,
+			mailConfig.From,
+			os.Getenv(config.Envars.SMTPUsername),
+			os.Getenv(config.Envars.SMTPPassword),
+		)
+	default:
+		panic("unknown mailer: " + mailConfig.Mailer)
+	}
+	if err != nil {
+		panic("failed to set up mailer: " + err.Error())
+	}
+	resolvers.UseMailer(sender)
+}
+
+// Without a key, links sent by email stop working when the server restarts
+func setupSigningKey() {
+	key := os.Getenv(config.Envars.SigningKey)
+	if key == "" {
+		logger.Warning(fmt.Sprintf("$%s not set, using a random signing key", config.Envars.SigningKey))
+		return
+	}
+	authenticate.UseSigningKey([]byte(key))
+}
+
+// Password resets are limited separately from logins, under their own keys
+func setupLimiters(conn *database.MongoConnection) (*ratelimit.Limiter, *ratelimit.Limiter) {
+	rateLimitConfig := config.Values.RateLimit
+	var store ratelimit.Store
+	switch rateLimitConfig.Store {
+	case "local":
+		store = ratelimit.NewLocalStore()
+	case "postgres":
+		store = ratelimit.NewPostgresStore(conn.DB)
+	default:
+		panic("unknown rate limit store: " + rateLimitConfig.Store)
+	}
+	policy := ratelimit.Policy{
+		FreeAttempts: int64(rateLimitConfig.FreeAttempts),
+		BaseDelay:    time.Duration(rateLimitConfig.BaseDelaySeconds) * time.Second,
+		MaxDelay:     time.Duration(rateLimitConfig.MaxDelaySeconds) * time.Second,
+		ResetAfter:   time.Duration(rateLimitConfig.SecondsUntilReset) * time.Second,
+	}
+	return ratelimit.NewLimiter(store, policy), ratelimit.NewLimiter(store, policy)
+}
+
 func teardown(conn *database.MongoConnection) {
 	if conn != nil {
 		err := conn.Close()
@@ -2,6 +2,8 @@ package mocks
 
 import (
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/raphael-p/beango/database"
 	"github.com/raphael-p/beango/utils/collections"
@@ -17,12 +19,30 @@ func populateMockDB(conn database.Connection) {
 	conn.SetSession(AdminSesh)
 }
 
+// Generates an ID that is not yet used in the mock table, so that
+// deleting rows does not lead to collisions
+func nextID[V any](table map[int64]V) int64 {
+	var maxID int64
+	for id := range table {
+		maxID = max(maxID, id)
+	}
+	return maxID + 1
+}
+
 type MockConnection struct {
-	users     map[int64]database.User
-	chats     map[int64]database.Chat
-	chatUsers map[int64]database.ChatUser
-	messages  map[int64]database.MessageDatabase
-	sessions  map[string]database.Session
+	users         map[int64]database.User
+	chats         map[int64]database.Chat
+	chatUsers     map[int64]database.ChatUser
+	messages      map[int64]database.MessageDatabase
+	revisions     map[int64]database.MessageRevision
+	reactions     []database.MessageReaction
+	attachments   map[int64]database.Attachment
+	sessions      map[string]database.Session
+	apiTokens     map[int64]database.APIToken
+	totps         map[int64]database.TOTP
+	recoveryCodes map[int64]map[string]bool // hashes of the codes of a user, true once used
+	preAuthTokens map[string]database.PreAuthToken
+	resets        map[string]database.PasswordReset
 }
 
 func MakeMockConnection() *MockConnection {
@@ -31,7 +51,15 @@ func MakeMockConnection() *MockConnection {
 		make(map[int64]database.Chat),
 		make(map[int64]database.ChatUser),
 		make(map[int64]database.MessageDatabase),
+		make(map[int64]database.MessageRevision),
+		[]database.MessageReaction{},
+		make(map[int64]database.Attachment),
 		make(map[string]database.Session),
+		make(map[int64]database.APIToken),
+		make(map[int64]database.TOTP),
+		make(map[int64]map[string]bool),
+		make(map[string]database.PreAuthToken),
+		make(map[string]database.PasswordReset),
 	}
 	populateMockDB(conn)
 	return conn
@@ -104,11 +132,11 @@ func (mc *MockConnection) GetPrivateChatByUserIDs(userID1, userID2 int64) (*data
 }
 
 func (mc *MockConnection) SetChat(chat *database.Chat, userIDs ...int64) (*database.Chat, error) {
-	chat.ID = int64(len(mc.chats) + 1)
+	chat.ID = nextID(mc.chats)
 	mc.chats[chat.ID] = *chat
 	for _, userID := range userIDs {
 		chatUser := database.ChatUser{
-			ID:     int64(len(mc.chatUsers) + 1),
+			ID:     nextID(mc.chatUsers),
 			ChatID: chat.ID,
 			UserID: userID,
 		}
@@ -118,21 +146,232 @@ func (mc *MockConnection) SetChat(chat *database.Chat, userIDs ...int64) (*datab
 	return chat, nil
 }
 
+func (mc *MockConnection) AddChatUsers(chatID int64, userIDs ...int64) error {
+	for _, userID := range userIDs {
+		isMember := false
+		for _, chatUser := range mc.chatUsers {
+			if chatUser.ChatID == chatID && chatUser.UserID == userID {
+				isMember = true
+				break
+			}
+		}
+		if !isMember {
+			chatUser := database.ChatUser{
+				ID:     nextID(mc.chatUsers),
+				ChatID: chatID,
+				UserID: userID,
+			}
+			mc.chatUsers[chatUser.ID] = chatUser
+		}
+	}
+	return nil
+}
+
+func (mc *MockConnection) GetChatOwnerID(chatID int64) (int64, error) {
+	var owner database.ChatUser
+	for _, chatUser := range mc.chatUsers {
+		if chatUser.ChatID == chatID && (owner.ID == 0 || chatUser.ID < owner.ID) {
+			owner = chatUser
+		}
+	}
+	return owner.UserID, nil
+}
+
+func (mc *MockConnection) RemoveChatUser(chatID, userID int64) ([]database.Attachment, error) {
+	isEmpty := true
+	for id, chatUser := range mc.chatUsers {
+		if chatUser.ChatID == chatID && chatUser.UserID == userID {
+			delete(mc.chatUsers, id)
+		} else if chatUser.ChatID == chatID {
+			isEmpty = false
+		}
+	}
+	if !isEmpty {
+		return nil, nil
+	}
+
+	attachments := []database.Attachment{}
+	for messageID, message := range mc.messages {
+		if message.ChatID != chatID {
+			continue
+		}
+		for id, attachment := range mc.attachments {
+			if attachment.MessageID == messageID {
+				attachments = append(attachments, attachment)
+				delete(mc.attachments, id)
+			}
+		}
+		for id, revision := range mc.revisions {
+			if revision.MessageID == messageID {
+				delete(mc.revisions, id)
+			}
+		}
+		mc.reactions = slices.DeleteFunc(mc.reactions, func(r database.MessageReaction) bool {
+			return r.MessageID == messageID
+		})
+		delete(mc.messages, messageID)
+	}
+	delete(mc.chats, chatID)
+	return attachments, nil
+}
+
+func (mc *MockConnection) GetUnreadCounts(userID int64) ([]database.UnreadCount, error) {
+	counts := []database.UnreadCount{}
+	for _, chatUser := range mc.chatUsers {
+		if chatUser.UserID != userID {
+			continue
+		}
+		count := database.UnreadCount{ChatID: chatUser.ChatID}
+		for _, m := range mc.messages {
+			if m.ChatID == chatUser.ChatID && m.ID > chatUser.LastReadMessageID &&
+				m.UserID != userID && m.DeletedAt == nil {
+				count.Count++
+			}
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+func (mc *MockConnection) MarkChatRead(chatID, userID, messageID int64) (int64, error) {
+	if messageID == 0 {
+		for _, m := range mc.messages {
+			if m.ChatID == chatID {
+				messageID = max(messageID, m.ID)
+			}
+		}
+	}
+	for id, chatUser := range mc.chatUsers {
+		if chatUser.ChatID == chatID && chatUser.UserID == userID && chatUser.LastReadMessageID < messageID {
+			chatUser.LastReadMessageID = messageID
+			mc.chatUsers[id] = chatUser
+			return messageID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (mc *MockConnection) GetReadReceipts(chatID int64) ([]database.ReadReceipt, error) {
+	receipts := []database.ReadReceipt{}
+	for _, chatUser := range mc.chatUsers {
+		if chatUser.ChatID == chatID {
+			receipts = append(receipts, database.ReadReceipt{
+				UserID:            chatUser.UserID,
+				UserDisplayName:   mc.users[chatUser.UserID].DisplayName,
+				LastReadMessageID: chatUser.LastReadMessageID,
+			})
+		}
+	}
+	// reflects ordering from database
+	slices.SortFunc(receipts, func(a, b database.ReadReceipt) int {
+		return strings.Compare(a.UserDisplayName, b.UserDisplayName)
+	})
+	return receipts, nil
+}
+
+// Converts a stored message to the shape returned by message queries
+func (mc *MockConnection) toMessage(m database.MessageDatabase) database.Message {
+	content := m.Content
+	if m.DeletedAt != nil {
+		content = database.DELETED_MESSAGE_CONTENT
+	}
+	message := database.Message{
+		ID:               m.ID,
+		UserID:           m.UserID,
+		ChatID:           m.ChatID,
+		Content:          content,
+		CreatedAt:        m.CreatedAt,
+		LastUpdatedAt:    m.LastUpdatedAt,
+		DeletedAt:        m.DeletedAt,
+		ReplyToMessageID: m.ReplyToMessageID,
+		ThreadID:         m.ThreadID,
+		UserDisplayName:  mc.users[m.UserID].DisplayName,
+		ChatType:         mc.chats[m.ChatID].Type,
+	}
+	for _, reply := range mc.messages {
+		if reply.ThreadID != nil && *reply.ThreadID == m.ID && reply.DeletedAt == nil {
+			message.ThreadReplyCount++
+		}
+	}
+	message.Reactions = database.ReactionCounts{}
+	for _, reaction := range mc.reactions { // kept in the order they were added
+		if reaction.MessageID != m.ID {
+			continue
+		}
+		i := slices.IndexFunc(message.Reactions, func(r database.ReactionCount) bool {
+			return r.Emoji == reaction.Emoji
+		})
+		if i == -1 {
+			message.Reactions = append(message.Reactions, database.ReactionCount{Emoji: reaction.Emoji})
+			i = len(message.Reactions) - 1
+		}
+		message.Reactions[i].Count++
+		message.Reactions[i].UserIDs = append(message.Reactions[i].UserIDs, reaction.UserID)
+	}
+	message.Attachments = database.Attachments{}
+	if m.DeletedAt == nil {
+		for _, attachment := range mc.attachments {
+			if attachment.MessageID == m.ID {
+				attachment.BlobKey = "" // not aggregated by the database
+				message.Attachments = append(message.Attachments, attachment)
+			}
+		}
+		// reflects ordering from database
+		slices.SortFunc(message.Attachments, func(a, b database.Attachment) int { return int(a.ID - b.ID) })
+	}
+	message.SeenBy = database.ReadReceipts{}
+	receipts, _ := mc.GetReadReceipts(m.ChatID) // sorted as in the database
+	for _, receipt := range receipts {
+		if receipt.UserID != m.UserID && receipt.LastReadMessageID >= m.ID {
+			message.SeenBy = append(message.SeenBy, receipt)
+		}
+	}
+	if m.ReplyToMessageID != nil {
+		reply := mc.messages[*m.ReplyToMessageID]
+		message.ReplyToUserDisplayName = mc.users[reply.UserID].DisplayName
+		message.ReplyToSnippet = database.DELETED_MESSAGE_CONTENT
+		if reply.DeletedAt == nil {
+			snippet := []rune(reply.Content)
+			message.ReplyToSnippet = string(snippet[:min(len(snippet), database.REPLY_SNIPPET_LENGTH)])
+		}
+	}
+	return message
+}
+
 func (mc *MockConnection) GetMessagesByChatID(chatID, fromMessageID, toMessageID int64, limit int) ([]database.Message, error) {
 	messages := []database.Message{}
 	for _, m := range mc.messages {
-		if m.ChatID == chatID {
-			messages = append(messages, database.Message{
-				ID:            m.ID,
-				UserID:        m.UserID,
-				ChatID:        m.ChatID,
-				Content:       m.Content,
-				CreatedAt:     m.CreatedAt,
-				LastUpdatedAt: m.LastUpdatedAt,
-			})
+		if m.ChatID == chatID && m.ThreadID == nil && m.ID > fromMessageID &&
+			(toMessageID == 0 || m.ID < toMessageID) {
+			messages = append(messages, mc.toMessage(m))
+		}
+	}
+	// reflects ordering from database
+	slices.SortFunc(messages, func(a, b database.Message) int { return int(b.ID - a.ID) })
+	if limit != 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (mc *MockConnection) GetMessage(id int64) (*database.Message, error) {
+	m, ok := mc.messages[id]
+	if !ok {
+		return nil, nil
+	}
+	message := mc.toMessage(m)
+	return &message, nil
+}
+
+func (mc *MockConnection) GetThreadMessages(threadID int64) ([]database.Message, error) {
+	messages := []database.Message{}
+	for _, m := range mc.messages {
+		if m.ThreadID != nil && *m.ThreadID == threadID {
+			messages = append(messages, mc.toMessage(m))
 		}
 	}
-	slices.Reverse(messages) // reflects ordering from database
+	// reflects ordering from database
+	slices.SortFunc(messages, func(a, b database.Message) int { return int(a.ID - b.ID) })
 	return messages, nil
 }
 
@@ -142,6 +381,132 @@ func (mc *MockConnection) SetMessage(message *database.MessageDatabase) (*databa
 	return message, nil
 }
 
+func (mc *MockConnection) SetMessageWithAttachments(message *database.MessageDatabase, attachments []database.Attachment) (*database.MessageDatabase, error) {
+	message, _ = mc.SetMessage(message)
+	for i := range attachments {
+		attachments[i].MessageID = message.ID
+		mc.SetAttachment(&attachments[i])
+	}
+	return message, nil
+}
+
+func (mc *MockConnection) UpdateMessage(id int64, content string) (*database.MessageDatabase, error) {
+	message := mc.messages[id]
+	revision := database.MessageRevision{
+		ID:        nextID(mc.revisions),
+		MessageID: id,
+		Content:   message.Content,
+		CreatedAt: message.LastUpdatedAt,
+	}
+	mc.revisions[revision.ID] = revision
+	message.Content = content
+	message.LastUpdatedAt = time.Now().UTC()
+	mc.messages[id] = message
+	return &message, nil
+}
+
+func (mc *MockConnection) DeleteMessage(id int64) error {
+	message := mc.messages[id]
+	if message.DeletedAt == nil {
+		now := time.Now().UTC()
+		message.DeletedAt = &now
+		mc.messages[id] = message
+	}
+	return nil
+}
+
+func (mc *MockConnection) AddReaction(messageID, userID int64, emoji string) error {
+	reaction := database.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, r := range mc.reactions {
+		if r.MessageID == messageID && r.UserID == userID && r.Emoji == emoji {
+			return nil
+		}
+	}
+	mc.reactions = append(mc.reactions, reaction)
+	return nil
+}
+
+func (mc *MockConnection) RemoveReaction(messageID, userID int64, emoji string) error {
+	mc.reactions = slices.DeleteFunc(mc.reactions, func(r database.MessageReaction) bool {
+		return r.MessageID == messageID && r.UserID == userID && r.Emoji == emoji
+	})
+	return nil
+}
+
+func (mc *MockConnection) GetAttachment(id int64) (*database.Attachment, error) {
+	attachment, ok := mc.attachments[id]
+	if !ok {
+		return nil, nil
+	}
+	return &attachment, nil
+}
+
+func (mc *MockConnection) SetAttachment(attachment *database.Attachment) (*database.Attachment, error) {
+	attachment.ID = nextID(mc.attachments)
+	mc.attachments[attachment.ID] = *attachment
+	return attachment, nil
+}
+
+func (mc *MockConnection) GetMessageRevisions(messageID int64) ([]database.MessageRevision, error) {
+	revisions := []database.MessageRevision{}
+	for _, revision := range mc.revisions {
+		if revision.MessageID == messageID {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, nil
+}
+
+// Matches messages that contain every word of the query, ignoring case, and
+// highlights the words of their content that contain one of the query's
+func (mc *MockConnection) SearchMessages(userID int64, query string, beforeMessageID int64, limit int) ([]database.MessageSearchResult, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	results := []database.MessageSearchResult{}
+	for _, m := range mc.messages {
+		chat, _ := mc.GetChat(m.ChatID, userID)
+		if chat == nil || m.DeletedAt != nil || (beforeMessageID != 0 && m.ID >= beforeMessageID) {
+			continue
+		}
+
+		content := strings.ToLower(m.Content)
+		if len(terms) == 0 || slices.ContainsFunc(terms, func(term string) bool {
+			return !strings.Contains(content, term)
+		}) {
+			continue
+		}
+
+		words := strings.Fields(m.Content)
+		for i, word := range words {
+			if slices.ContainsFunc(terms, func(term string) bool {
+				return strings.Contains(strings.ToLower(word), term)
+			}) {
+				words[i] = database.SEARCH_MATCH_START + word + database.SEARCH_MATCH_END
+			}
+		}
+		results = append(results, database.MessageSearchResult{
+			ID:              m.ID,
+			ChatID:          m.ChatID,
+			ThreadID:        m.ThreadID,
+			ChatName:        chat.Name,
+			ChatType:        chat.Type,
+			UserDisplayName: mc.users[m.UserID].DisplayName,
+			Snippet:         strings.Join(words, " "),
+			CreatedAt:       m.CreatedAt,
+		})
+	}
+	// reflects ordering from database
+	slices.SortFunc(results, func(a, b database.MessageSearchResult) int { return int(b.ID - a.ID) })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
 func (mc *MockConnection) GetUser(id int64) (*database.User, error) {
 	user, ok := mc.users[id]
 	if !ok {
@@ -165,6 +530,12 @@ func (mc *MockConnection) SetUser(user *database.User) (*database.User, error) {
 	return user, nil
 }
 
+func (mc *MockConnection) SetUserWithNoteChat(user *database.User) (*database.User, error) {
+	mc.SetUser(user)
+	mc.SetChat(&database.Chat{Type: database.NOTE}, user.ID)
+	return user, nil
+}
+
 func (mc *MockConnection) SearchUsers(username string, searchUserID int64) ([]database.User, error) {
 	_, users := collections.MapEntries(mc.users)
 	return users, nil
@@ -177,35 +548,239 @@ func (mc *MockConnection) RenameUser(id int64, displayName string) error {
 	return nil
 }
 
-func (mc *MockConnection) GetSession(id string) *database.Session {
+func (mc *MockConnection) UpdateUserKey(id int64, key []byte) error {
+	user := mc.users[id]
+	user.Key = key
+	mc.users[id] = user
+	return nil
+}
+
+func (mc *MockConnection) SetUserEmail(id int64, email *string) error {
+	user := mc.users[id]
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	mc.users[id] = user
+	return nil
+}
+
+func (mc *MockConnection) VerifyUserEmail(id int64, email string) (bool, error) {
+	user, ok := mc.users[id]
+	if !ok || user.Email == nil || *user.Email != email {
+		return false, nil
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now().UTC()
+		user.EmailVerifiedAt = &now
+		mc.users[id] = user
+	}
+	return true, nil
+}
+
+func (mc *MockConnection) GetSession(id string) (*database.Session, error) {
 	session, ok := mc.sessions[id]
 	if !ok {
-		return nil
+		return nil, nil
 	}
-	return &session
+	return &session, nil
 }
 
-func (mc *MockConnection) GetSessionByUserID(userID int64) (*database.Session, error) {
+func (mc *MockConnection) GetSessionByHandle(handle string) (*database.Session, error) {
 	for _, session := range mc.sessions {
-		if session.UserID == userID {
+		if session.Handle == handle {
 			return &session, nil
 		}
 	}
 	return nil, nil
 }
 
-func (mc *MockConnection) SetSession(session database.Session) {
+func (mc *MockConnection) GetSessionsByUserID(userID int64) ([]database.Session, error) {
+	sessions := []database.Session{}
+	for _, session := range mc.sessions {
+		if session.UserID == userID && session.ExpiryDate.After(time.Now().UTC()) {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b database.Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (mc *MockConnection) SetSession(session database.Session) error {
 	mc.sessions[session.ID] = session
+	return nil
 }
 
-func (mc *MockConnection) CheckSession(id string) (*database.Session, bool) {
-	session := mc.GetSession(id)
-	if session == nil {
-		return nil, false
+func (mc *MockConnection) CheckSession(id string) (*database.Session, error) {
+	session, _ := mc.GetSession(id)
+	now := time.Now().UTC()
+	if session == nil || session.ExpiryDate.Before(now) {
+		return nil, nil
+	}
+	if session.LastSeenAt.Before(now.Add(-database.LAST_SEEN_PRECISION)) {
+		session.LastSeenAt = now
+		mc.sessions[id] = *session
 	}
-	return session, true
+	return session, nil
 }
 
-func (mc *MockConnection) DeleteSession(id string) {
+func (mc *MockConnection) DeleteSession(id string) error {
 	delete(mc.sessions, id)
+	return nil
+}
+
+func (mc *MockConnection) DeleteOtherSessions(userID int64, keepID string) error {
+	for id, session := range mc.sessions {
+		if session.UserID == userID && id != keepID {
+			delete(mc.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (mc *MockConnection) GetAPITokensByUserID(userID int64) ([]database.APIToken, error) {
+	tokens := []database.APIToken{}
+	for _, token := range mc.apiTokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	// reflects ordering from database
+	slices.SortFunc(tokens, func(a, b database.APIToken) int {
+		return int(a.ID - b.ID)
+	})
+	return tokens, nil
+}
+
+func (mc *MockConnection) SetAPIToken(token *database.APIToken) (*database.APIToken, error) {
+	token.ID = nextID(mc.apiTokens)
+	mc.apiTokens[token.ID] = *token
+	return token, nil
+}
+
+func (mc *MockConnection) DeleteAPIToken(id, userID int64) (bool, error) {
+	token, ok := mc.apiTokens[id]
+	if !ok || token.UserID != userID {
+		return false, nil
+	}
+	delete(mc.apiTokens, id)
+	return true, nil
+}
+
+func (mc *MockConnection) CheckAPIToken(hash string) (*database.APIToken, error) {
+	for id, token := range mc.apiTokens {
+		if token.Hash != hash {
+			continue
+		}
+		if token.ExpiryDate != nil && token.ExpiryDate.Before(time.Now().UTC()) {
+			return nil, nil
+		}
+		now := time.Now().UTC()
+		token.LastUsedAt = &now
+		mc.apiTokens[id] = token
+		return &token, nil
+	}
+	return nil, nil
+}
+
+func (mc *MockConnection) GetTOTP(userID int64) (*database.TOTP, error) {
+	totp, ok := mc.totps[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &totp, nil
+}
+
+func (mc *MockConnection) SetTOTP(userID int64, secret string) error {
+	mc.totps[userID] = database.TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (mc *MockConnection) EnableTOTP(userID, step int64, recoveryCodeHashes []string) error {
+	totp := mc.totps[userID]
+	now := time.Now().UTC()
+	totp.EnabledAt = &now
+	totp.LastUsedStep = step
+	mc.totps[userID] = totp
+	mc.recoveryCodes[userID] = make(map[string]bool)
+	for _, hash := range recoveryCodeHashes {
+		mc.recoveryCodes[userID][hash] = false
+	}
+	return nil
+}
+
+func (mc *MockConnection) DeleteTOTP(userID int64) error {
+	delete(mc.totps, userID)
+	delete(mc.recoveryCodes, userID)
+	return nil
+}
+
+func (mc *MockConnection) UseTOTPStep(userID, step int64) (bool, error) {
+	totp, ok := mc.totps[userID]
+	if !ok || totp.LastUsedStep >= step {
+		return false, nil
+	}
+	totp.LastUsedStep = step
+	mc.totps[userID] = totp
+	return true, nil
+}
+
+func (mc *MockConnection) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	used, ok := mc.recoveryCodes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	mc.recoveryCodes[userID][hash] = true
+	return true, nil
+}
+
+func (mc *MockConnection) CountRecoveryCodes(userID int64) (int64, error) {
+	var count int64
+	for _, used := range mc.recoveryCodes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (mc *MockConnection) SetPreAuthToken(token database.PreAuthToken) error {
+	mc.preAuthTokens[token.ID] = token
+	return nil
+}
+
+func (mc *MockConnection) CheckPreAuthToken(id string, maxAttempts int64) (*database.PreAuthToken, error) {
+	token, ok := mc.preAuthTokens[id]
+	if !ok || token.Attempts >= maxAttempts || token.ExpiryDate.Before(time.Now().UTC()) {
+		return nil, nil
+	}
+	token.Attempts++
+	mc.preAuthTokens[id] = token
+	return &token, nil
+}
+
+func (mc *MockConnection) DeletePreAuthToken(id string) error {
+	delete(mc.preAuthTokens, id)
+	return nil
+}
+
+func (mc *MockConnection) SetPasswordReset(reset database.PasswordReset) error {
+	mc.resets[reset.ID] = reset
+	return nil
+}
+
+func (mc *MockConnection) UsePasswordReset(id string) (*database.PasswordReset, error) {
+	reset, ok := mc.resets[id]
+	if !ok || reset.UsedAt != nil || reset.ExpiryDate.Before(time.Now().UTC()) {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	for otherID, other := range mc.resets {
+		if other.UserID == reset.UserID && other.UsedAt == nil {
+			other.UsedAt = &now
+			mc.resets[otherID] = other
+		}
+	}
+	reset.UsedAt = &now
+	return &reset, nil
 }
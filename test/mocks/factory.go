@@ -40,10 +40,16 @@ func MakeAdminUser() *database.User {
 }
 
 func MakeSession(userID int64) database.Session {
+	now := time.Now().UTC()
 	return database.Session{
 		ID:         uuid.NewString(),
 		UserID:     userID,
-		ExpiryDate: time.Now().UTC().Add(time.Hour),
+		ExpiryDate: now.Add(time.Hour),
+		Handle:     uuid.NewString(),
+		UserAgent:  "Mozilla/5.0",
+		IPAddress:  "127.0.0.1",
+		CreatedAt:  now,
+		LastSeenAt: now,
 	}
 }
 
@@ -53,6 +59,13 @@ func MakePrivateChat() *database.Chat {
 	}
 }
 
+func MakeGroupChat() *database.Chat {
+	return &database.Chat{
+		Type: database.GROUP_CHAT,
+		Name: "The Group",
+	}
+}
+
 func MakeMessage(userID, chatID int64) *database.MessageDatabase {
 	return &database.MessageDatabase{
 		UserID:  userID,
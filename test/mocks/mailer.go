@@ -0,0 +1,13 @@
+package mocks
+
+import "github.com/raphael-p/beango/mailer"
+
+// Keeps the emails that it is asked to send
+type Mailer struct {
+	Messages []mailer.Message
+}
+
+func (m *Mailer) Send(message mailer.Message) error {
+	m.Messages = append(m.Messages, message)
+	return nil
+}
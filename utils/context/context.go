@@ -7,11 +7,13 @@ import (
 	"net/http"
 
 	"github.com/raphael-p/beango/database"
+	"github.com/raphael-p/beango/ratelimit"
 )
 
 // context keys, used to avoid clashes
 type paramKey string
 type userKey struct{}
+type attemptKey struct{}
 
 func GetUser(r *http.Request) (*database.User, error) {
 	rawUser := r.Context().Value(userKey{})
@@ -60,3 +62,14 @@ func SetParam(r *http.Request, key string, value string) (*http.Request, error)
 	ctx := context.WithValue(r.Context(), paramKey(key), value)
 	return r.WithContext(ctx), nil
 }
+
+// Returns nil if the route is not rate limited
+func GetAttempt(r *http.Request) *ratelimit.Attempt {
+	attempt, _ := r.Context().Value(attemptKey{}).(*ratelimit.Attempt)
+	return attempt
+}
+
+func SetAttempt(r *http.Request, attempt *ratelimit.Attempt) *http.Request {
+	ctx := context.WithValue(r.Context(), attemptKey{}, attempt)
+	return r.WithContext(ctx)
+}
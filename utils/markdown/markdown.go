@@ -0,0 +1,312 @@
+package markdown
+
+import (
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FENCE      string = "```"
+	LINK_ATTRS string = ` target="_blank" rel="noopener noreferrer nofollow"`
+	// Characters that are kept as they are when preceded by a backslash
+	ESCAPABLE string = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+var languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
+
+// Renders a restricted subset of Markdown, suited to chat messages:
+//   - **strong** or __strong__, *emphasis* or _emphasis_, and ~~strikethrough~~
+//   - `inline code`, and blocks of code between lines starting with ```
+//   - [links](https://example.com), and URLs which are linked automatically,
+//     with or without angle brackets
+//
+// Anything else, HTML included, is escaped. Line breaks are kept, and only
+// http, https and mailto links are allowed.
+//
+// A general purpose renderer would have to be paired with an HTML sanitiser to
+// strip what chat messages cannot contain, whereas here there is no way to
+// produce anything outside of the subset. Where it overlaps with CommonMark the
+// output follows the spec examples, except for emphasis: it is only closed by
+// a run of exactly the same delimiter, so it cannot be nested within emphasis
+// of the same kind, and runs like ***this*** are left as they are.
+func Render(content string) template.HTML {
+	var out strings.Builder
+	var text []string
+	flushText := func() {
+		if len(text) > 0 {
+			out.WriteString(renderInline(strings.Join(text, "\n"), false))
+			text = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		// an info string cannot contain backticks, or the line could be inline code
+		info, isFence := strings.CutPrefix(strings.TrimSpace(lines[i]), FENCE)
+		if !isFence || strings.Contains(info, "`") {
+			text = append(text, lines[i])
+			continue
+		}
+		flushText()
+
+		// an unclosed block runs to the end of the content
+		var code []string
+		for i++; i < len(lines) && strings.TrimSpace(lines[i]) != FENCE; i++ {
+			code = append(code, lines[i])
+		}
+		out.WriteString("<pre><code")
+		if language := strings.TrimSpace(info); languagePattern.MatchString(language) {
+			out.WriteString(` class="language-` + template.HTMLEscapeString(language) + `"`)
+		}
+		out.WriteString(">" + template.HTMLEscapeString(strings.Join(code, "\n")) + "</code></pre>")
+	}
+	flushText()
+	return template.HTML(out.String())
+}
+
+func escapeText(text string) string {
+	return strings.ReplaceAll(template.HTMLEscapeString(text), "\n", "<br>")
+}
+
+// Text within a link cannot contain other links
+func renderInline(text string, inLink bool) string {
+	var out strings.Builder
+	plainStart := 0
+	for i := 0; i < len(text); {
+		if html, length := matchInline(text, i, inLink); length > 0 {
+			out.WriteString(escapeText(text[plainStart:i]))
+			out.WriteString(html)
+			i += length
+			plainStart = i
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	out.WriteString(escapeText(text[plainStart:]))
+	return out.String()
+}
+
+// Returns the HTML for the element starting at index i of the text, and how
+// many bytes of the text it takes up. The length is zero if there is none.
+func matchInline(text string, i int, inLink bool) (string, int) {
+	switch text[i] {
+	case '\\':
+		if i+1 < len(text) && strings.IndexByte(ESCAPABLE, text[i+1]) >= 0 {
+			return template.HTMLEscapeString(text[i+1 : i+2]), 2
+		}
+	case '`':
+		return matchCode(text, i)
+	case '*', '_', '~':
+		return matchEmphasis(text, i, inLink)
+	case '[':
+		if !inLink {
+			return matchLink(text, i)
+		}
+	case '<':
+		if !inLink {
+			return matchBracketedURL(text, i)
+		}
+	case 'h':
+		if !inLink && (i == 0 || !isWordByte(text[i-1])) {
+			return matchURL(text, i)
+		}
+	}
+	return "", 0
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= utf8.RuneSelf
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n'
+}
+
+// The length of the run of the character at index i
+func runLength(text string, i int) int {
+	length := 1
+	for i+length < len(text) && text[i+length] == text[i] {
+		length++
+	}
+	return length
+}
+
+// A code span is closed by a run of as many backticks as it was opened with.
+// Line breaks within it become spaces, and a single space is stripped from
+// each end if it has one at both, so that a span can start or end with a
+// backtick.
+func matchCode(text string, i int) (string, int) {
+	length := runLength(text, i)
+	for j := i + length; j < len(text); {
+		if text[j] != '`' {
+			j++
+			continue
+		}
+		closing := runLength(text, j)
+		if closing == length {
+			code := strings.ReplaceAll(text[i+length:j], "\n", " ")
+			if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			return "<code>" + template.HTMLEscapeString(code) + "</code>", j + closing - i
+		}
+		j += closing
+	}
+	// without a closing run, the backticks are plain text
+	return template.HTMLEscapeString(text[i : i+length]), length
+}
+
+var emphasisTags = map[string]string{
+	"*":  "em",
+	"_":  "em",
+	"**": "strong",
+	"__": "strong",
+	"~~": "del",
+}
+
+// Emphasis is closed by a run of exactly the same delimiter, which is not
+// escaped or within a code span or URL. It must not be next to whitespace on the inside, and underscores are
+// ignored within words.
+func matchEmphasis(text string, i int, inLink bool) (string, int) {
+	length := runLength(text, i)
+	delimiter := text[i : i+length]
+	tag, ok := emphasisTags[delimiter]
+	start := i + length
+	isUnderscore := text[i] == '_'
+	if !ok || start >= len(text) || isSpaceByte(text[start]) || isUnderscore && i > 0 && isWordByte(text[i-1]) {
+		return template.HTMLEscapeString(delimiter), length
+	}
+
+	for j := start; j < len(text); {
+		if text[j] == '`' { // delimiters within code spans are ignored
+			_, length := matchCode(text, j)
+			j += length
+			continue
+		}
+		if text[j] == '<' { // as are those within URLs
+			if _, length := matchBracketedURL(text, j); length > 0 {
+				j += length
+				continue
+			}
+		}
+		if text[j] == '\\' { // and escaped ones
+			j += 2
+			continue
+		}
+		if text[j] != text[i] {
+			j++
+			continue
+		}
+		closing := runLength(text, j)
+		end := j + closing
+		if closing == length && !isSpaceByte(text[j-1]) && !(isUnderscore && end < len(text) && isWordByte(text[end])) {
+			inner := renderInline(text[start:j], inLink)
+			return "<" + tag + ">" + inner + "</" + tag + ">", end - i
+		}
+		j = end
+	}
+	return template.HTMLEscapeString(delimiter), length
+}
+
+// Only absolute http and https URLs, or mailto addresses, are allowed
+func safeURL(rawURL string, allowMailto bool) (string, bool) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	switch parsedURL.Scheme {
+	case "http", "https":
+		if parsedURL.Host == "" {
+			return "", false
+		}
+	case "mailto":
+		if !allowMailto || parsedURL.Opaque == "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return parsedURL.String(), true
+}
+
+func link(href, html string) string {
+	return `<a href="` + template.HTMLEscapeString(href) + `"` + LINK_ATTRS + ">" + html + "</a>"
+}
+
+// A link is [text](url), the url may contain balanced parentheses
+func matchLink(text string, i int) (string, int) {
+	closeText := strings.IndexByte(text[i:], ']')
+	if closeText <= 1 || i+closeText+1 >= len(text) || text[i+closeText+1] != '(' {
+		return "", 0
+	}
+	closeText += i
+	urlStart := closeText + 2
+	depth := 0
+	for j := urlStart; j < len(text); j++ {
+		switch {
+		case isSpaceByte(text[j]):
+			return "", 0
+		case text[j] == '(':
+			depth++
+		case text[j] == ')' && depth > 0:
+			depth--
+		case text[j] == ')':
+			href, ok := safeURL(text[urlStart:j], true)
+			if !ok {
+				return "", 0
+			}
+			return link(href, renderInline(text[i+1:closeText], true)), j + 1 - i
+		}
+	}
+	return "", 0
+}
+
+// A URL runs up to the next whitespace, without any trailing punctuation or
+// unbalanced closing parenthesis
+func matchURL(text string, i int) (string, int) {
+	if !strings.HasPrefix(text[i:], "http://") && !strings.HasPrefix(text[i:], "https://") {
+		return "", 0
+	}
+	end := i
+	for end < len(text) && !isSpaceByte(text[end]) && text[end] != '<' && text[end] != '>' {
+		end++
+	}
+	for end > i {
+		last := text[end-1]
+		if strings.IndexByte(`.,:;!?'"*_~`, last) >= 0 {
+			end--
+		} else if last == ')' && strings.Count(text[i:end], "(") < strings.Count(text[i:end], ")") {
+			end--
+		} else {
+			break
+		}
+	}
+
+	href, ok := safeURL(text[i:end], false)
+	if !ok {
+		return "", 0
+	}
+	return link(href, template.HTMLEscapeString(text[i:end])), end - i
+}
+
+// A URL between angle brackets is linked as it is, without the brackets
+func matchBracketedURL(text string, i int) (string, int) {
+	end := strings.IndexByte(text[i:], '>')
+	if end < 0 {
+		return "", 0
+	}
+	end += i
+	rawURL := text[i+1 : end]
+	if strings.ContainsAny(rawURL, " \t\n<") {
+		return "", 0
+	}
+	href, ok := safeURL(rawURL, false)
+	if !ok {
+		return "", 0
+	}
+	return link(href, template.HTMLEscapeString(rawURL)), end + 1 - i
+}
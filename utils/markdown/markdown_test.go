@@ -0,0 +1,254 @@
+package markdown
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+const LINK_START string = `<a href="https://example.com"` + LINK_ATTRS + ">"
+
+func TestRender(t *testing.T) {
+	testCases := map[string]map[string]string{
+		"Plain": {
+			"beans":             "beans",
+			"one\ntwo\r\nthree": "one<br>two<br>three",
+			"":                  "",
+		},
+		"Emphasis": {
+			"*beans*":                    "<em>beans</em>",
+			"_beans_":                    "<em>beans</em>",
+			"**beans**":                  "<strong>beans</strong>",
+			"__beans__":                  "<strong>beans</strong>",
+			"~~beans~~":                  "<del>beans</del>",
+			"**baked *beans***":          "**baked *beans***",
+			"**baked *beans* on toast**": "<strong>baked <em>beans</em> on toast</strong>",
+			"snake_case_name":            "snake_case_name",
+			"2 * 3 * 4":                  "2 * 3 * 4",
+			"*not closed":                "*not closed",
+			"~single~":                   "~single~",
+			"*a `*` b*":                  "<em>a <code>*</code> b</em>",
+			`\*escaped\*`:                "*escaped*",
+		},
+		"Code": {
+			"`x < y`":                   "<code>x &lt; y</code>",
+			"`` a ` b ``":               "<code>a ` b</code>",
+			"`*not emphasis*`":          "<code>*not emphasis*</code>",
+			"`unclosed":                 "`unclosed",
+			"```\n<b>\n  **x**\n```":    "<pre><code>&lt;b&gt;\n  **x**</code></pre>",
+			"```go\nfunc()\n```\nafter": `<pre><code class="language-go">func()</code></pre>after`,
+			"```\"><script>\nx\n```":    "<pre><code>x</code></pre>",
+			"before\n```\nunclosed":     "before<pre><code>unclosed</code></pre>",
+		},
+		"Links": {
+			"[here](https://example.com)":        LINK_START + "here</a>",
+			"[**bold**](https://example.com)":    LINK_START + "<strong>bold</strong></a>",
+			"[mail](mailto:beans@example.com)":   `<a href="mailto:beans@example.com"` + LINK_ATTRS + ">mail</a>",
+			"[x](https://example.com/a_(b))":     `<a href="https://example.com/a_(b)"` + LINK_ATTRS + ">x</a>",
+			"[x](javascript:alert(1))":           "[x](javascript:alert(1))",
+			"[x](/relative)":                     "[x](/relative)",
+			"[x](https://example.com \"title\")": "[x](" + LINK_START + "https://example.com</a> &#34;title&#34;)",
+			"[](https://example.com)":            "[](" + LINK_START + "https://example.com</a>)",
+		},
+		"AutoLinks": {
+			"see https://example.com.":     "see " + LINK_START + "https://example.com</a>.",
+			"(https://example.com)":        "(" + LINK_START + "https://example.com</a>)",
+			"**https://example.com**":      "<strong>" + LINK_START + "https://example.com</a></strong>",
+			"https://example.com/?a=1&b=2": `<a href="https://example.com/?a=1&amp;b=2"` + LINK_ATTRS + ">https://example.com/?a=1&amp;b=2</a>",
+			"xhttps://example.com":         "xhttps://example.com",
+			"https://":                     "https://",
+			"mailto:beans@example.com":     "mailto:beans@example.com",
+		},
+		"HTML": {
+			"<script>alert('beans')</script>":  "&lt;script&gt;alert(&#39;beans&#39;)&lt;/script&gt;",
+			`*<img src=x onerror="alert(1)">*`: "<em>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</em>",
+			`[x](https://example.com/"onmouseover="alert(1))`: `<a href="https://example.com/%22onmouseover=%22alert%281%29"` +
+				LINK_ATTRS + ">x</a>",
+			`<https://example.com/"onclick="alert(1)>`: `<a href="https://example.com/%22onclick=%22alert%281%29"` + LINK_ATTRS +
+				`>https://example.com/&#34;onclick=&#34;alert(1)</a>`,
+		},
+		"UnsafeURLs": {
+			"[x](JavaScript:alert(1))":                "[x](JavaScript:alert(1))",
+			"<javascript:alert(1)>":                   "&lt;javascript:alert(1)&gt;",
+			"[x](data:text/html;base64,PHNjcmlwdD4=)": "[x](data:text/html;base64,PHNjcmlwdD4=)",
+			"[x](//example.com)":                      "[x](//example.com)",
+			"[x](https:example.com)":                  "[x](https:example.com)",
+			"ftp://example.com":                       "ftp://example.com",
+			"<mailto:beans@example.com>":              "&lt;mailto:beans@example.com&gt;",
+		},
+	}
+
+	for name, cases := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for content, expected := range cases {
+				assert.Equals(t, Render(content), template.HTML(expected))
+			}
+		})
+	}
+}
+
+// Adapts the HTML of a spec example to how chat messages are rendered: there
+// are no paragraphs, line breaks are kept, blocks of code have no trailing
+// newline, and links open in a new tab
+func fromSpec(html string) string {
+	if strings.HasPrefix(html, "<pre>") {
+		return strings.Replace(html, "\n</code></pre>", "</code></pre>", 1)
+	}
+	html = strings.TrimSuffix(strings.TrimPrefix(html, "<p>"), "</p>")
+	html = strings.ReplaceAll(html, "&quot;", "&#34;")
+	html = strings.ReplaceAll(html, "\n", "<br>")
+	return strings.ReplaceAll(html, `">`, `"`+LINK_ATTRS+">")
+}
+
+// Examples from the CommonMark spec (version 0.31.2) within the subset that is
+// supported. Links to relative URLs are left as text, so the link examples
+// only cover what is not a link.
+func TestRenderCommonMark(t *testing.T) {
+	examples := []struct {
+		number   int
+		markdown string
+		html     string
+	}{
+		// Backslash escapes
+		{13, "\\\t\\A\\a\\ \\3\\\u03c6\\\u00ab", "<p>\\\t\\A\\a\\ \\3\\\u03c6\\\u00ab</p>"},
+		{14, "\\*not emphasized*\n\\<br/> not a tag\n\\[not a link](/foo)\n\\`not code`\n1\\. not a list\n\\* not a list\n\\# not a heading\n\\[foo]: /url \"not a reference\"\n\\&ouml; not a character entity", "<p>*not emphasized*\n&lt;br/&gt; not a tag\n[not a link](/foo)\n`not code`\n1. not a list\n* not a list\n# not a heading\n[foo]: /url &quot;not a reference&quot;\n&amp;ouml; not a character entity</p>"},
+		{15, "\\\\*emphasis*", "<p>\\<em>emphasis</em></p>"},
+		{17, "`` \\[\\` ``", "<p><code>\\[\\`</code></p>"},
+		// Fenced code blocks
+		{119, "```\n<\n >\n```", "<pre><code>&lt;\n &gt;\n</code></pre>"},
+		{121, "``\nfoo\n``", "<p><code>foo</code></p>"},
+		{126, "```", "<pre><code></code></pre>"},
+		{129, "```\n\n  \n```", "<pre><code>\n  \n</code></pre>"},
+		{138, "``` ```\naaa", "<p><code> </code>\naaa</p>"},
+		{142, "```ruby\ndef foo(x)\n  return 3\nend\n```", "<pre><code class=\"language-ruby\">def foo(x)\n  return 3\nend\n</code></pre>"},
+		{145, "``` aa ```\nfoo", "<p><code>aa</code>\nfoo</p>"},
+		{147, "```\n``` aaa\n```", "<pre><code>``` aaa\n</code></pre>"},
+		// Code spans
+		{328, "`foo`", "<p><code>foo</code></p>"},
+		{329, "`` foo ` bar ``", "<p><code>foo ` bar</code></p>"},
+		{330, "` `` `", "<p><code>``</code></p>"},
+		{331, "`  ``  `", "<p><code> `` </code></p>"},
+		{332, "` a`", "<p><code> a</code></p>"},
+		{333, "`\u00a0b\u00a0`", "<p><code>\u00a0b\u00a0</code></p>"},
+		{334, "`\u00a0`\n`  `", "<p><code>\u00a0</code>\n<code>  </code></p>"},
+		{335, "``\nfoo\nbar  \nbaz\n``", "<p><code>foo bar   baz</code></p>"},
+		{336, "``\nfoo \n``", "<p><code>foo </code></p>"},
+		{337, "`foo   bar \nbaz`", "<p><code>foo   bar  baz</code></p>"},
+		{338, "`foo\\`bar`", "<p><code>foo\\</code>bar`</p>"},
+		{339, "``foo`bar``", "<p><code>foo`bar</code></p>"},
+		{340, "` foo `` bar `", "<p><code>foo `` bar</code></p>"},
+		{341, "*foo`*`", "<p>*foo<code>*</code></p>"},
+		{342, "[not a `link](/foo`)", "<p>[not a <code>link](/foo</code>)</p>"},
+		{343, "`<a href=\"`\">`", "<p><code>&lt;a href=&quot;</code>&quot;&gt;`</p>"},
+		{345, "`<https://foo.bar.`baz>`", "<p><code>&lt;https://foo.bar.</code>baz&gt;`</p>"},
+		{347, "```foo``", "<p>```foo``</p>"},
+		{348, "`foo", "<p>`foo</p>"},
+		{349, "`foo``bar``", "<p>`foo<code>bar</code></p>"},
+		// Emphasis and strong emphasis
+		{350, "*foo bar*", "<p><em>foo bar</em></p>"},
+		{351, "a * foo bar*", "<p>a * foo bar*</p>"},
+		{355, "foo*bar*", "<p>foo<em>bar</em></p>"},
+		{356, "5*6*78", "<p>5<em>6</em>78</p>"},
+		{357, "_foo bar_", "<p><em>foo bar</em></p>"},
+		{358, "_ foo bar_", "<p>_ foo bar_</p>"},
+		{359, "a_\"foo\"_", "<p>a_&quot;foo&quot;_</p>"},
+		{360, "foo_bar_", "<p>foo_bar_</p>"},
+		{361, "5_6_78", "<p>5_6_78</p>"},
+		{362, "\u043f\u0440\u0438\u0441\u0442\u0430\u043d\u044f\u043c_\u0441\u0442\u0440\u0435\u043c\u044f\u0442\u0441\u044f_", "<p>\u043f\u0440\u0438\u0441\u0442\u0430\u043d\u044f\u043c_\u0441\u0442\u0440\u0435\u043c\u044f\u0442\u0441\u044f_</p>"},
+		{363, "aa_\"bb\"_cc", "<p>aa_&quot;bb&quot;_cc</p>"},
+		{364, "foo-_(bar)_", "<p>foo-<em>(bar)</em></p>"},
+		{365, "_foo*", "<p>_foo*</p>"},
+		{366, "*foo bar *", "<p>*foo bar *</p>"},
+		{367, "*foo bar\n*", "<p>*foo bar\n*</p>"},
+		{370, "*foo*bar", "<p><em>foo</em>bar</p>"},
+		{371, "_foo bar _", "<p>_foo bar _</p>"},
+		{376, "_foo_bar_baz_", "<p><em>foo_bar_baz</em></p>"},
+		{377, "_(bar)_.", "<p><em>(bar)</em>.</p>"},
+		{378, "**foo bar**", "<p><strong>foo bar</strong></p>"},
+		{379, "** foo bar**", "<p>** foo bar**</p>"},
+		{381, "foo**bar**", "<p>foo<strong>bar</strong></p>"},
+		{383, "__ foo bar__", "<p>__ foo bar__</p>"},
+		{385, "a__\"foo\"__", "<p>a__&quot;foo&quot;__</p>"},
+		{387, "5__6__78", "<p>5__6__78</p>"},
+		{388, "\u043f\u0440\u0438\u0441\u0442\u0430\u043d\u044f\u043c__\u0441\u0442\u0440\u0435\u043c\u044f\u0442\u0441\u044f__", "<p>\u043f\u0440\u0438\u0441\u0442\u0430\u043d\u044f\u043c__\u0441\u0442\u0440\u0435\u043c\u044f\u0442\u0441\u044f__</p>"},
+		{398, "__(__foo)", "<p>__(__foo)</p>"},
+		{399, "_(__foo__)_", "<p><em>(<strong>foo</strong>)</em></p>"},
+		{400, "__foo__bar", "<p>__foo__bar</p>"},
+		{401, "__\u043f\u0440\u0438\u0441\u0442\u0430\u043d\u044f\u043c__\u0441\u0442\u0440\u0435\u043c\u044f\u0442\u0441\u044f", "<p>__\u043f\u0440\u0438\u0441\u0442\u0430\u043d\u044f\u043c__\u0441\u0442\u0440\u0435\u043c\u044f\u0442\u0441\u044f</p>"},
+		{402, "__foo__bar__baz__", "<p><strong>foo__bar__baz</strong></p>"},
+		{403, "__(bar)__.", "<p><strong>(bar)</strong>.</p>"},
+		{405, "*foo\nbar*", "<p><em>foo\nbar</em></p>"},
+		{406, "_foo __bar__ baz_", "<p><em>foo <strong>bar</strong> baz</em></p>"},
+		{410, "*foo **bar** baz*", "<p><em>foo <strong>bar</strong> baz</em></p>"},
+		{411, "*foo**bar**baz*", "<p><em>foo<strong>bar</strong>baz</em></p>"},
+		{437, "foo *\\**", "<p>foo <em>*</em></p>"},
+		{440, "foo **\\***", "<p>foo <strong>*</strong></p>"},
+		{449, "foo _\\__", "<p>foo <em>_</em></p>"},
+		{452, "foo __\\___", "<p>foo <strong>_</strong></p>"},
+		{460, "**foo**", "<p><strong>foo</strong></p>"},
+		{463, "_*foo*_", "<p><em><em>foo</em></em></p>"},
+		{469, "*foo _bar* baz_", "<p><em>foo _bar</em> baz_</p>"},
+		{470, "*foo __bar *baz bim__ bam*", "<p><em>foo <strong>bar *baz bim</strong> bam</em></p>"},
+		{478, "*a `*`*", "<p><em>a <code>*</code></em></p>"},
+		{479, "_a `_`_", "<p><em>a <code>_</code></em></p>"},
+		{480, "**a<https://foo.bar/?q=**>", "<p>**a<a href=\"https://foo.bar/?q=**\">https://foo.bar/?q=**</a></p>"},
+		{481, "__a<https://foo.bar/?q=__>", "<p>__a<a href=\"https://foo.bar/?q=__\">https://foo.bar/?q=__</a></p>"},
+		// Links
+		{488, "[link](/my uri)", "<p>[link](/my uri)</p>"},
+		{490, "[link](foo\nbar)", "<p>[link](foo\nbar)</p>"},
+		{493, "[link](<foo\\>)", "<p>[link](&lt;foo&gt;)</p>"},
+		{497, "[link](foo(and(bar))", "<p>[link](foo(and(bar))</p>"},
+		{511, "[link] (/uri)", "<p>[link] (/uri)</p>"},
+		{513, "[link] bar](/uri)", "<p>[link] bar](/uri)</p>"},
+		{523, "*foo [bar* baz]", "<p><em>foo [bar</em> baz]</p>"},
+		{525, "[foo`](/uri)`", "<p>[foo<code>](/uri)</code></p>"},
+		// Autolinks
+		{594, "<http://foo.bar.baz>", "<p><a href=\"http://foo.bar.baz\">http://foo.bar.baz</a></p>"},
+		{595, "<https://foo.bar.baz/test?q=hello&id=22&boolean>", "<p><a href=\"https://foo.bar.baz/test?q=hello&amp;id=22&amp;boolean\">https://foo.bar.baz/test?q=hello&amp;id=22&amp;boolean</a></p>"},
+		{600, "<https://../>", "<p><a href=\"https://../\">https://../</a></p>"},
+		{603, "<https://example.com/\\[\\>", "<p><a href=\"https://example.com/%5C%5B%5C\">https://example.com/\\[\\</a></p>"},
+		{606, "<foo\\+@bar.example.com>", "<p>&lt;foo+@bar.example.com&gt;</p>"},
+		{607, "<>", "<p>&lt;&gt;</p>"},
+		{609, "<m:abc>", "<p>&lt;m:abc&gt;</p>"},
+		{610, "<foo.bar.baz>", "<p>&lt;foo.bar.baz&gt;</p>"},
+		{612, "foo@bar.example.com", "<p>foo@bar.example.com</p>"},
+		// Raw HTML
+		{618, "<33> <__>", "<p>&lt;33&gt; &lt;__&gt;</p>"},
+		{619, "<a h*#ref=\"hi\">", "<p>&lt;a h*#ref=&quot;hi&quot;&gt;</p>"},
+		{621, "< a><\nfoo><bar/ >\n<foo bar=baz\nbim!bop />", "<p>&lt; a&gt;&lt;\nfoo&gt;&lt;bar/ &gt;\n&lt;foo bar=baz\nbim!bop /&gt;</p>"},
+		{624, "</a href=\"foo\">", "<p>&lt;/a href=&quot;foo&quot;&gt;</p>"},
+		{632, "<a href=\"\\\"\">", "<p>&lt;a href=&quot;&quot;&quot;&gt;</p>"},
+	}
+
+	for _, example := range examples {
+		if html := Render(example.markdown); html != template.HTML(fromSpec(example.html)) {
+			t.Errorf("example %d: expected %q, got %q", example.number, fromSpec(example.html), html)
+		}
+	}
+}
+
+// Examples from the GitHub Flavored Markdown spec, for the extensions to
+// CommonMark which are supported
+func TestRenderGFM(t *testing.T) {
+	testCases := map[string]map[string]string{
+		"Strikethrough": {
+			"~~Hi~~ Hello, world!":        "<p><del>Hi</del> Hello, world!</p>",
+			"This will ~~~not~~~ strike.": "<p>This will ~~~not~~~ strike.</p>",
+		},
+		"AutoLinks": {
+			"http://commonmark.org": `<p><a href="http://commonmark.org">http://commonmark.org</a></p>`,
+			"(Visit https://encrypted.google.com/search?q=Markup+(business))": `<p>(Visit <a href="https://encrypted.google.com/search?q=Markup+(business)">` +
+				`https://encrypted.google.com/search?q=Markup+(business)</a>)</p>`,
+		},
+	}
+
+	for name, cases := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for content, expected := range cases {
+				assert.Equals(t, Render(content), template.HTML(fromSpec(expected)))
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Only what is needed for short texts such as TOTP provisioning URIs is
+// supported: byte mode, error correction level M, and versions 1 to 10.
+const (
+	MIN_VERSION int = 1
+	MAX_VERSION int = 10
+	// Light modules around the code, as required by the standard
+	QUIET_ZONE int = 4
+)
+
+var ErrTooLong = errors.New("text is too long to encode as a QR code")
+
+type blockLayout struct {
+	ecPerBlock     int
+	group1Blocks   int
+	group1DataSize int
+	group2Blocks   int
+	group2DataSize int
+}
+
+// Error correction level M, indexed by version
+var blockLayouts = [MAX_VERSION + 1]blockLayout{
+	1:  {10, 1, 16, 0, 0},
+	2:  {16, 1, 28, 0, 0},
+	3:  {26, 1, 44, 0, 0},
+	4:  {18, 2, 32, 0, 0},
+	5:  {24, 2, 43, 0, 0},
+	6:  {16, 4, 27, 0, 0},
+	7:  {18, 4, 31, 0, 0},
+	8:  {22, 2, 38, 2, 39},
+	9:  {22, 3, 36, 2, 37},
+	10: {26, 4, 43, 1, 44},
+}
+
+var alignmentPositions = [MAX_VERSION + 1][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+func (l blockLayout) dataSize() int {
+	return l.group1Blocks*l.group1DataSize + l.group2Blocks*l.group2DataSize
+}
+
+// A QR code, where true modules are dark
+type Code struct {
+	Version int
+	Modules [][]bool
+	// modules that are part of a fixed pattern, rather than data
+	isFunction [][]bool
+}
+
+func (c *Code) Size() int {
+	return len(c.Modules)
+}
+
+// Encodes the text in the smallest version it fits in.
+//
+// The only use is showing a TOTP secret at enrolment, which takes a fraction
+// of the standard, so it is encoded here rather than by a third-party package.
+// The tests hold it to the examples in ISO/IEC 18004.
+func Encode(text string) (*Code, error) {
+	version := MIN_VERSION
+	for ; version <= MAX_VERSION; version++ {
+		if len(text) <= capacity(version) {
+			break
+		}
+	}
+	if version > MAX_VERSION {
+		return nil, ErrTooLong
+	}
+
+	size := 17 + 4*version
+	code := &Code{
+		Version:    version,
+		Modules:    makeGrid(size),
+		isFunction: makeGrid(size),
+	}
+	code.drawFunctionPatterns()
+	code.drawCodewords(addErrorCorrection(version, encodeData(version, text)))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		if penalty := code.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		code.applyMask(mask) // masking twice undoes it
+	}
+	code.applyMask(bestMask)
+	code.drawFormatBits(bestMask)
+	return code, nil
+}
+
+func makeGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+func characterCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// How many bytes can be encoded in a version
+func capacity(version int) int {
+	return (blockLayouts[version].dataSize()*8 - 4 - characterCountBits(version)) / 8
+}
+
+type bitBuffer []byte // one bit per byte, for simplicity
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, byte(value>>i&1))
+	}
+}
+
+// Makes the data codewords: the mode, length and bytes of the text, padded up
+// to the capacity of the version
+func encodeData(version int, text string) []byte {
+	dataSize := blockLayouts[version].dataSize()
+	var bits bitBuffer
+	bits.append(0b0100, 4) // byte mode
+	bits.append(len(text), characterCountBits(version))
+	for i := 0; i < len(text); i++ {
+		bits.append(int(text[i]), 8)
+	}
+	bits.append(0, min(4, dataSize*8-len(bits))) // terminator
+	bits.append(0, (8-len(bits)%8)%8)
+
+	data := make([]byte, 0, dataSize)
+	for i := 0; i < len(bits); i += 8 {
+		var value byte
+		for _, bit := range bits[i : i+8] {
+			value = value<<1 | bit
+		}
+		data = append(data, value)
+	}
+	for pad := byte(0xEC); len(data) < dataSize; pad ^= 0xEC ^ 0x11 {
+		data = append(data, pad)
+	}
+	return data
+}
+
+// Splits the data into blocks, adds error correction codewords to each, and
+// interleaves them
+func addErrorCorrection(version int, data []byte) []byte {
+	layout := blockLayouts[version]
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for i := 0; i < layout.group1Blocks+layout.group2Blocks; i++ {
+		size := layout.group1DataSize
+		if i >= layout.group1Blocks {
+			size = layout.group2DataSize
+		}
+		block := data[offset : offset+size]
+		offset += size
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	var result []byte
+	for _, blocks := range [][][]byte{dataBlocks, ecBlocks} {
+		for i := 0; i < max(layout.group1DataSize, layout.group2DataSize, layout.ecPerBlock); i++ {
+			for _, block := range blocks {
+				if i < len(block) {
+					result = append(result, block[i])
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Multiplies in GF(2^8), modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// The coefficients of the generator polynomial of the given degree, without
+// the leading term
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.Modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	size := c.Size()
+	for i := 0; i < size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					distance := max(abs(dx), abs(dy))
+					c.setFunction(x, y, distance != 2 && distance != 4)
+				}
+			}
+		}
+	}
+
+	positions := alignmentPositions[c.Version]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// overlaps a finder pattern
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	c.drawFormatBits(0) // reserves the area, drawn again once the mask is chosen
+	c.drawVersionBits()
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// The error correction level and mask, protected by a BCH code
+func formatBits(mask int) int {
+	const levelM = 0b00
+	data := levelM<<3 | mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	return (data<<10 | remainder) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	size := c.Size()
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, size-15+i, bit(i))
+	}
+	c.setFunction(8, size-8, true) // always dark
+}
+
+// The version, protected by a BCH code, only from version 7
+func versionBits(version int) int {
+	remainder := version
+	for i := 0; i < 12; i++ {
+		remainder = remainder<<1 ^ (remainder>>11)*0x1F25
+	}
+	return version<<12 | remainder
+}
+
+func (c *Code) drawVersionBits() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionBits(c.Version)
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 == 1
+		a, b := c.Size()-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// Places the codewords in a zigzag, going up and down columns two modules
+// wide, from the bottom right corner
+func (c *Code) drawCodewords(codewords []byte) {
+	size := c.Size()
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 { // skips the vertical timing pattern
+			right = 5
+		}
+		for vertical := 0; vertical < size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 { // going up
+					y = size - 1 - vertical
+				}
+				if !c.isFunction[y][x] && i < len(codewords)*8 {
+					c.Modules[y][x] = codewords[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y, row := range c.Modules {
+		for x := range row {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.isFunction[y][x] {
+				row[x] = !row[x]
+			}
+		}
+	}
+}
+
+// Scores how hard the code would be to scan, masks are chosen to minimise it
+func (c *Code) penalty() int {
+	size := c.Size()
+	penalty := 0
+	finderLike := []string{"10111010000", "00001011101"}
+
+	for _, vertical := range []bool{false, true} {
+		for i := 0; i < size; i++ {
+			var line strings.Builder
+			for j := 0; j < size; j++ {
+				dark := c.Modules[i][j]
+				if vertical {
+					dark = c.Modules[j][i]
+				}
+				if dark {
+					line.WriteByte('1')
+				} else {
+					line.WriteByte('0')
+				}
+			}
+			modules := line.String()
+
+			run := 1
+			for j := 1; j <= size; j++ {
+				if j < size && modules[j] == modules[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			for _, pattern := range finderLike {
+				for j := 0; j+len(pattern) <= size; j++ {
+					if modules[j:j+len(pattern)] == pattern {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if c.Modules[y][x] {
+				dark++
+			}
+			if x+1 < size && y+1 < size {
+				color := c.Modules[y][x]
+				if c.Modules[y][x+1] == color && c.Modules[y+1][x] == color && c.Modules[y+1][x+1] == color {
+					penalty += 3
+				}
+			}
+		}
+	}
+	deviation := abs(dark*100/(size*size) - 50)
+	return penalty + deviation/5*10
+}
+
+// Renders the code as an SVG image, with one unit per module
+func (c *Code) SVG() string {
+	size := c.Size() + 2*QUIET_ZONE
+	var path strings.Builder
+	for y, row := range c.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QUIET_ZONE, y+QUIET_ZONE)
+			}
+		}
+	}
+	return fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+			`<rect width="100%%" height="100%%" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		size, size, path.String(),
+	)
+}
@@ -0,0 +1,131 @@
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	t.Run("ThonkyExample", func(t *testing.T) {
+		// "HELLO WORLD" at version 1-M, from the Thonky QR code tutorial
+		data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+		remainder := reedSolomonRemainder(data, reedSolomonDivisor(10))
+		assert.DeepEquals(t, remainder, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23})
+	})
+
+	t.Run("StandardExample", func(t *testing.T) {
+		// "01234567" at version 1-M, from annex I of ISO/IEC 18004
+		data := []byte{16, 32, 12, 86, 97, 128, 236, 17, 236, 17, 236, 17, 236, 17, 236, 17}
+		remainder := reedSolomonRemainder(data, reedSolomonDivisor(10))
+		assert.DeepEquals(t, remainder, []byte{165, 36, 212, 193, 237, 54, 199, 135, 44, 85})
+	})
+}
+
+// The number of codewords and the byte mode capacity at level M of each
+// version, from tables 1 and 7 of ISO/IEC 18004
+func TestBlockLayouts(t *testing.T) {
+	codewords := []int{26, 44, 70, 100, 134, 172, 196, 242, 292, 346}
+	capacities := []int{14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+	for version := MIN_VERSION; version <= MAX_VERSION; version++ {
+		layout := blockLayouts[version]
+		ecSize := (layout.group1Blocks + layout.group2Blocks) * layout.ecPerBlock
+		assert.Equals(t, layout.dataSize()+ecSize, codewords[version-1])
+		assert.Equals(t, capacity(version), capacities[version-1])
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	assert.Equals(t, fmt.Sprintf("%015b", formatBits(0)), "101010000010010")
+	assert.Equals(t, fmt.Sprintf("%015b", formatBits(5)), "100000011001110")
+	assert.Equals(t, fmt.Sprintf("%018b", versionBits(7)), "000111110010010100")
+	assert.Equals(t, fmt.Sprintf("%018b", versionBits(10)), "001010010011010011")
+}
+
+func TestEncodeData(t *testing.T) {
+	data := encodeData(1, "hi")
+	assert.HasLength(t, data, 16)
+	// mode 0100, length 00000010, then 'h' and 'i', the terminator and padding
+	assert.DeepEquals(t, data[:4], []byte{0b01000000, 0b00100110, 0b10000110, 0b10010000})
+	assert.DeepEquals(t, data[4:6], []byte{0xEC, 0x11})
+}
+
+func TestEncode(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		text := "otpauth://totp/Beango:johnny?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=Beango"
+		code, err := Encode(text)
+		assert.IsNil(t, err)
+		assert.Equals(t, code.Version, 5)
+		assert.Equals(t, code.Size(), 37)
+
+		// the finder patterns are the same in every code
+		for _, corner := range [][2]int{{0, 0}, {code.Size() - 7, 0}, {0, code.Size() - 7}} {
+			for i := 0; i < 7; i++ {
+				assert.Equals(t, code.Modules[corner[1]][corner[0]+i], true)
+				assert.Equals(t, code.Modules[corner[1]+i][corner[0]], true)
+				assert.Equals(t, code.Modules[corner[1]+1][corner[0]+i], i == 0 || i == 6)
+			}
+		}
+		assert.Equals(t, code.Modules[code.Size()-8][8], true) // dark module
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		for version, length := range map[int]int{1: 14, 2: 26, 7: 122, 10: 213} {
+			code, err := Encode(strings.Repeat("a", length))
+			assert.IsNil(t, err)
+			assert.Equals(t, code.Version, version)
+		}
+	})
+
+	t.Run("Modules", func(t *testing.T) {
+		// matches the symbol encoded by rsc.io/qr with the same mask
+		expected := []string{
+			"#######..#.#..#######",
+			"#.....#...#...#.....#",
+			"#.###.#.#..#..#.###.#",
+			"#.###.#.#####.#.###.#",
+			"#.###.#.#.#.#.#.###.#",
+			"#.....#.#.##..#.....#",
+			"#######.#.#.#.#######",
+			"........#.#..........",
+			"#.#####...##..#####..",
+			"##..##.###.####..##.#",
+			"####..#####.#.##.###.",
+			".#####..##.####..##.#",
+			"##.#####..#.#..#.....",
+			"........#...#..#..#.#",
+			"#######...##.#..####.",
+			"#.....#.#.#....#####.",
+			"#.###.#.#.##.#..#..#.",
+			"#.###.#.########.#...",
+			"#.###.#.#.#.#.##.....",
+			"#.....#...#####.###..",
+			"#######.#...#..#.#.#.",
+		}
+		code, _ := Encode("beans")
+		for y, row := range code.Modules {
+			var line strings.Builder
+			for _, dark := range row {
+				if dark {
+					line.WriteByte('#')
+				} else {
+					line.WriteByte('.')
+				}
+			}
+			assert.Equals(t, line.String(), expected[y])
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		_, err := Encode(strings.Repeat("a", 214))
+		assert.Equals(t, err, ErrTooLong)
+	})
+
+	t.Run("SVG", func(t *testing.T) {
+		code, _ := Encode("beans")
+		svg := code.SVG()
+		assert.Contains(t, svg, `viewBox="0 0 29 29"`, "M4,4h1v1h-1z")
+	})
+}
@@ -1,9 +1,11 @@
 package response
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 )
 
@@ -63,6 +65,15 @@ func (w *Writer) WriteHTML(code int, response string) {
 }
 
 func (w *Writer) WriteSSE(event, data string) error {
+	return w.WriteSSEWithID("", event, data)
+}
+
+// Writes an SSE event with an ID, which the client sends back in the
+// Last-Event-ID header when it reconnects. The ID is omitted if empty.
+func (w *Writer) WriteSSEWithID(id, event, data string) error {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
 	if event == "" {
 		fmt.Fprint(w, "event: message\n") // default sse event
 	} else {
@@ -79,6 +90,28 @@ func (w *Writer) WriteSSE(event, data string) error {
 	return nil
 }
 
+// Writes an SSE comment line, which clients ignore, to keep the connection alive
+func (w *Writer) WriteSSEComment(comment string) error {
+	fmt.Fprintf(w, ": %s\n\n", comment)
+
+	flusher, ok := w.ResponseWriter.(http.Flusher)
+	if !ok || flusher == nil {
+		return errors.New("response writer does not have a flusher")
+	}
+
+	flusher.Flush()
+	return nil
+}
+
+// Hands the underlying connection over to the caller, e.g. for WebSockets
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer cannot be hijacked")
+	}
+	return hijacker.Hijack()
+}
+
 func (w *Writer) Redirect(location string, r *http.Request) {
 	if r != nil && r.Header.Get("HX-Request") == "true" {
 		w.Header().Set("HX-Redirect", location)
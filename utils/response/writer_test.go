@@ -134,6 +134,47 @@ func TestWriteSSE(t *testing.T) {
 	})
 }
 
+func TestWriteSSEWithID(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		w := NewWriter(recorder)
+
+		err := w.WriteSSEWithID("42", "event-one", "the event's data")
+		assert.IsNil(t, err)
+		assert.Equals(t, string(w.Body), "id: 42\nevent: event-one\ndata: the event's data\n\n")
+		assert.Equals(t, recorder.Flushed, true)
+	})
+
+	t.Run("EmptyID", func(t *testing.T) {
+		w := NewWriter(httptest.NewRecorder())
+
+		w.WriteSSEWithID("", "event-one", "the event's data")
+		assert.Equals(t, string(w.Body), "event: event-one\ndata: the event's data\n\n")
+	})
+}
+
+func TestWriteSSEComment(t *testing.T) {
+	t.Run("Normal", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		w := NewWriter(recorder)
+
+		err := w.WriteSSEComment("heartbeat")
+		assert.IsNil(t, err)
+		assert.Equals(t, w.Status, http.StatusOK)
+		assert.Equals(t, string(w.Body), ": heartbeat\n\n")
+		assert.Equals(t, recorder.Flushed, true)
+	})
+}
+
+func TestHijack(t *testing.T) {
+	t.Run("NotSupported", func(t *testing.T) {
+		w := NewWriter(httptest.NewRecorder())
+
+		_, _, err := w.Hijack()
+		assert.ErrorHasMessage(t, err, "response writer cannot be hijacked")
+	})
+}
+
 func TestRedirect(t *testing.T) {
 	t.Run("Normal", func(t *testing.T) {
 		r := httptest.NewRequest(http.MethodGet, "/test", nil)
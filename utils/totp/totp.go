@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Time-based one-time passwords (RFC 6238), with the parameters that
+// authenticator apps expect by default: SHA-1, 6 digits and 30 second steps.
+const (
+	DIGITS       int           = 6
+	PERIOD       time.Duration = 30 * time.Second
+	SECRET_BYTES int           = 20
+	// Codes from this many steps before or after the current one are accepted,
+	// to allow for clock drift and slow typing
+	SKEW int64 = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generates a random secret, encoded in base 32
+func GenerateSecret() (string, error) {
+	secret := make([]byte, SECRET_BYTES)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// The URI that authenticator apps read from a QR code to add an account
+func ProvisioningURI(issuer, accountName, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+	query := url.Values{"secret": {secret}, "issuer": {issuer}}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// The number of the time step that a time falls in
+func Step(now time.Time) int64 {
+	return now.Unix() / int64(PERIOD/time.Second)
+}
+
+// The code for a time step (RFC 4226)
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %w", err)
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0F
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
+	modulo := uint32(1)
+	for i := 0; i < DIGITS; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", DIGITS, value%modulo), nil
+}
+
+// Checks a code against the steps around the current time. Returns the step
+// it matched, so that callers can refuse to accept the same code twice.
+func Validate(secret, code string, now time.Time) (int64, bool) {
+	if len(code) != DIGITS {
+		return 0, false
+	}
+	current := Step(now)
+	for step := current - SKEW; step <= current+SKEW; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raphael-p/beango/test/assert"
+)
+
+// The ASCII key "12345678901234567890" from RFC 6238, encoded in base 32
+const testSecret string = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The SHA-1 test vectors from RFC 6238, cut down to 6 digits
+func TestCode(t *testing.T) {
+	testCases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unixTime, expected := range testCases {
+		code, err := Code(testSecret, Step(time.Unix(unixTime, 0)))
+		assert.IsNil(t, err)
+		assert.Equals(t, code, expected)
+	}
+
+	_, err := Code("not base 32!", 1)
+	assert.IsNotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	t.Run("Normal", func(t *testing.T) {
+		matched, ok := Validate(testSecret, "050471", now)
+		assert.Equals(t, ok, true)
+		assert.Equals(t, matched, step)
+	})
+
+	t.Run("Skew", func(t *testing.T) {
+		previous, _ := Code(testSecret, step-1)
+		matched, ok := Validate(testSecret, previous, now)
+		assert.Equals(t, ok, true)
+		assert.Equals(t, matched, step-1)
+
+		tooOld, _ := Code(testSecret, step-2)
+		_, ok = Validate(testSecret, tooOld, now)
+		assert.Equals(t, ok, false)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, code := range []string{"", "050472", "0504710", "abcdef"} {
+			_, ok := Validate(testSecret, code, now)
+			assert.Equals(t, ok, false)
+		}
+	})
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.IsNil(t, err)
+	assert.Equals(t, len(secret), 32)
+	_, err = Code(secret, 1)
+	assert.IsNil(t, err)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Beango", "johnny d", testSecret)
+	assert.Equals(t, uri, "otpauth://totp/Beango:johnny%20d?issuer=Beango&secret="+testSecret)
+}